@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+// AuthConfig 玩家登录配置
+type AuthConfig struct {
+	EmailCode EmailCodeConfig `yaml:"email_code"`
+}
+
+// EmailCodeConfig 邮箱验证码登录
+// 开启后玩家只能凭邮箱验证码登录，用户 ID 即验证过的邮箱；admin.email 为管理员邮箱
+type EmailCodeConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CodeTTLMinutes 验证码有效期（分钟）
+	CodeTTLMinutes int `yaml:"code_ttl_minutes"`
+	// MaxAttempts 每个验证码最多校验次数，用完后需重新获取
+	MaxAttempts int `yaml:"max_attempts"`
+	// ResendSeconds 同一邮箱两次获取验证码的最小间隔（秒），-1 表示不限制
+	ResendSeconds int `yaml:"resend_seconds"`
+	// HourlyLimit 同一邮箱每小时最多获取验证码的次数
+	HourlyLimit int        `yaml:"hourly_limit"`
+	Subject     string     `yaml:"subject"` // 邮件标题
+	SMTP        SMTPConfig `yaml:"smtp"`
+}
+
+// SMTP 连接加密方式
+const (
+	SMTPSecurityNone     = "none"     // 明文（本地收信服务）
+	SMTPSecurityStartTLS = "starttls" // 明文连接后升级为 TLS（通常为 587 端口）
+	SMTPSecurityTLS      = "tls"      // 直接建立 TLS 连接（通常为 465 端口）
+)
+
+// SMTPConfig 发信服务器配置
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"` // 留空时不认证
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`     // 发件人，如 "AI 守护者 <noreply@example.com>"
+	Security string `yaml:"security"` // starttls（默认）/ tls / none
+}
+
+// CodeTTL 验证码有效期
+func (e EmailCodeConfig) CodeTTL() time.Duration {
+	return time.Duration(e.CodeTTLMinutes) * time.Minute
+}
+
+// ResendInterval 同一邮箱两次获取验证码的最小间隔
+func (e EmailCodeConfig) ResendInterval() time.Duration {
+	return time.Duration(max(e.ResendSeconds, 0)) * time.Second
+}
+
+// validateEmailCode 校验邮箱验证码登录配置
+func (c *Config) validateEmailCode() error {
+	e := c.Auth.EmailCode
+	if !e.Enabled {
+		return nil
+	}
+
+	if e.CodeTTLMinutes < 1 {
+		return fmt.Errorf("auth.email_code.code_ttl_minutes 必须大于 0，当前为 %d", e.CodeTTLMinutes)
+	}
+	if e.MaxAttempts < 1 {
+		return fmt.Errorf("auth.email_code.max_attempts 必须大于 0，当前为 %d", e.MaxAttempts)
+	}
+	if e.ResendSeconds < -1 {
+		return fmt.Errorf("auth.email_code.resend_seconds 必须大于 0 或为 -1，当前为 %d", e.ResendSeconds)
+	}
+	if e.HourlyLimit < 1 {
+		return fmt.Errorf("auth.email_code.hourly_limit 必须大于 0，当前为 %d", e.HourlyLimit)
+	}
+
+	s := e.SMTP
+	if s.Host == "" {
+		return fmt.Errorf("开启邮箱验证码登录时必须填写 auth.email_code.smtp.host")
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		return fmt.Errorf("auth.email_code.smtp.from 不是有效的发件人地址: %q", s.From)
+	}
+	switch s.Security {
+	case SMTPSecurityNone, SMTPSecurityStartTLS, SMTPSecurityTLS:
+	default:
+		return fmt.Errorf("auth.email_code.smtp.security 只能为 none、starttls 或 tls，当前为 %q", s.Security)
+	}
+	return nil
+}
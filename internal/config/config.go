@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -9,44 +11,378 @@ import (
 
 // Config 全局配置结构体
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	AI     AIConfig     `yaml:"ai"`
-	Game   GameConfig   `yaml:"game"`
-	Admin  AdminConfig  `yaml:"admin"`
+	Server   ServerConfig   `yaml:"server"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Database DatabaseConfig `yaml:"database"`
+	AI       AIConfig       `yaml:"ai"`
+	Game     GameConfig     `yaml:"game"`
+	Admin    AdminConfig    `yaml:"admin"`
 }
 
 // ServerConfig HTTP 服务器配置
 type ServerConfig struct {
-	Port int `yaml:"port"`
+	Port    int           `yaml:"port"`
+	Session SessionConfig `yaml:"session"`
+}
+
+// Cookie 的 SameSite 模式
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
+
+// SessionConfig 登录会话配置
+type SessionConfig struct {
+	// TTLHours 会话有效期（小时），期间每次访问都从访问时起重新计算（滑动续期）
+	TTLHours int `yaml:"ttl_hours"`
+	// Secure Cookie 只通过 HTTPS 发送（默认 true）；仅通过 HTTP 访问时需设为 false，否则无法登录
+	Secure   *bool  `yaml:"secure"`
+	SameSite string `yaml:"same_site"` // lax（默认）/ strict / none
+	// SweepIntervalMinutes 清理过期会话的间隔（分钟），-1 表示不清理（过期会话仍无法使用）
+	SweepIntervalMinutes int `yaml:"sweep_interval_minutes"`
+}
+
+// validate 校验会话配置
+func (s SessionConfig) validate() error {
+	if s.TTLHours < 1 {
+		return fmt.Errorf("server.session.ttl_hours 必须大于 0，当前为 %d", s.TTLHours)
+	}
+	if s.SweepIntervalMinutes < -1 {
+		return fmt.Errorf("server.session.sweep_interval_minutes 必须大于 0 或为 -1，当前为 %d", s.SweepIntervalMinutes)
+	}
+	switch s.SameSite {
+	case SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		// 浏览器拒绝未设置 Secure 的 SameSite=None Cookie
+		if !*s.Secure {
+			return fmt.Errorf("server.session.same_site 为 none 时 server.session.secure 必须为 true")
+		}
+	default:
+		return fmt.Errorf("server.session.same_site 只能为 lax、strict 或 none，当前为 %q", s.SameSite)
+	}
+	return nil
+}
+
+// TTL 会话有效期
+func (s SessionConfig) TTL() time.Duration {
+	return time.Duration(s.TTLHours) * time.Hour
+}
+
+// SweepInterval 清理过期会话的间隔（0 表示不清理）
+func (s SessionConfig) SweepInterval() time.Duration {
+	return time.Duration(max(s.SweepIntervalMinutes, 0)) * time.Minute
+}
+
+// 数据库类型
+const (
+	DatabaseSQLite   = "sqlite"
+	DatabasePostgres = "postgres"
+)
+
+// DatabaseConfig 数据库配置
+// SQLite 只能单机部署；多个服务实例（负载均衡）需共用 PostgreSQL
+type DatabaseConfig struct {
+	Driver string `yaml:"driver"` // sqlite（默认）/ postgres
+	Path   string `yaml:"path"`   // SQLite 数据库文件（相对于可执行文件所在目录）
+	DSN    string `yaml:"dsn"`    // PostgreSQL 连接串
+}
+
+// Source 返回存储后端的数据源：SQLite 为数据库文件，PostgreSQL 为连接串
+func (d DatabaseConfig) Source() string {
+	if d.Driver == DatabasePostgres {
+		return d.DSN
+	}
+	return d.Path
 }
 
 // AIConfig AI 提供商配置
 type AIConfig struct {
+	Provider     string `yaml:"provider"` // openai（默认）/ anthropic / ollama
 	APIURL       string `yaml:"api_url"`
 	APIKey       string `yaml:"api_key"`
 	Model        string `yaml:"model"`
 	SystemPrompt string `yaml:"system_prompt"`
+	// 生成参数：temperature 未填写时为 0.7；top_p 为 0 时不发送（使用上游默认值）；max_tokens 为单条回复的最大长度
+	Temperature *float64 `yaml:"temperature"`
+	TopP        float64  `yaml:"top_p"`
+	MaxTokens   int      `yaml:"max_tokens"`
+	// 按顺序尝试的端点列表；为空时使用上面的单端点配置
+	Endpoints      []AIEndpointConfig   `yaml:"endpoints"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// 单次生成的总时长上限 / 上游两次数据之间的最长间隔（秒，-1 表示不限制）
+	RequestTimeoutSeconds int `yaml:"request_timeout_seconds"`
+	IdleTimeoutSeconds    int `yaml:"idle_timeout_seconds"`
+	// 模型价格表（键为模型名称，"default" 作为未列出模型的兜底）
+	Pricing map[string]ModelPrice `yaml:"pricing"`
+	// 口令泄露二次判定
+	Judge JudgeConfig `yaml:"judge"`
+	// 用户输入的提示词注入检测
+	InputGuard InputGuardConfig `yaml:"input_guard"`
+	// 回复的口令过滤（防守模式）
+	OutputGuard OutputGuardConfig `yaml:"output_guard"`
+	// 长对话的上下文窗口管理
+	Context ContextConfig `yaml:"context"`
+}
+
+// ContextConfig 上下文窗口管理配置
+// 每轮请求都会带上完整的对话历史，估算的 token 数超出模型的上下文窗口时按 strategy 裁剪最早的轮次
+type ContextConfig struct {
+	// 各模型的上下文窗口（token），键为模型名称，"default" 作为未列出模型的兜底；都未配置时不裁剪
+	Windows map[string]int `yaml:"windows"`
+	// 超出窗口时的处理方式：truncate 丢弃最早的轮次（默认）/ summarize 将最早的轮次压缩为摘要
+	Strategy string `yaml:"strategy"`
+	// 摘要模型（仅 summarize 使用）
+	Summary SummaryConfig `yaml:"summary"`
+}
+
+// SummaryConfig 对话摘要模型配置；provider 留空时沿用对话的首个端点
+type SummaryConfig struct {
+	Provider       string `yaml:"provider"`
+	APIURL         string `yaml:"api_url"`
+	APIKey         string `yaml:"api_key"`
+	Model          string `yaml:"model"`
+	MaxTokens      int    `yaml:"max_tokens"`      // 摘要的最大长度
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // 单次摘要的超时秒数，超时后改为直接丢弃
+}
+
+// 上下文裁剪方式
+const (
+	ContextTruncate  = "truncate"
+	ContextSummarize = "summarize"
+)
+
+// OutputGuardConfig 输出过滤配置（防守模式）
+// 开启后回复先经过前瞻缓冲，字面出现的口令在发送给玩家之前被遮盖或整条替换为拒绝提示，并记录为被拦截的泄露
+type OutputGuardConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 命中后的处理方式：redact（遮盖为 ***，默认）/ refuse（整条回复替换为 refuse_message）
+	Action        string `yaml:"action"`
+	RefuseMessage string `yaml:"refuse_message"`
+}
+
+// 输出过滤的处理方式
+const (
+	OutputRedact = "redact"
+	OutputRefuse = "refuse"
+)
+
+// InputGuardConfig 输入检测配置
+// 每条用户消息发送给 AI 前先经过内置规则（及可选的分类模型）检测，命中的类别按 policies 处理
+type InputGuardConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 各类别的处理方式：allow / tag / warn / refuse，未列出的类别使用 default_policy（默认 tag）
+	Policies      map[string]string `yaml:"policies"`
+	DefaultPolicy string            `yaml:"default_policy"`
+	// warn 时推送给玩家的提醒、refuse 时的拒绝提示
+	WarnMessage   string `yaml:"warn_message"`
+	RefuseMessage string `yaml:"refuse_message"`
+	// 分类模型（可选）
+	Classifier ClassifierConfig `yaml:"classifier"`
+}
+
+// ClassifierConfig 输入检测分类模型配置；provider 留空时沿用对话的首个端点
+type ClassifierConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	Provider       string  `yaml:"provider"`
+	APIURL         string  `yaml:"api_url"`
+	APIKey         string  `yaml:"api_key"`
+	Model          string  `yaml:"model"`
+	Threshold      float64 `yaml:"threshold"`       // 分数达到此值才记为命中
+	TimeoutSeconds int     `yaml:"timeout_seconds"` // 单次分类的超时秒数，超时后只使用规则检测的结果
+}
+
+// 输入检测的处理方式
+const (
+	GuardAllow  = "allow"
+	GuardTag    = "tag"
+	GuardWarn   = "warn"
+	GuardRefuse = "refuse"
+)
+
+// JudgeConfig 口令泄露二次判定配置
+// 每条回复结束后请单独配置的模型判断是否间接泄露了口令；provider 留空时沿用对话的首个端点
+type JudgeConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	Provider       string  `yaml:"provider"`
+	APIURL         string  `yaml:"api_url"`
+	APIKey         string  `yaml:"api_key"`
+	Model          string  `yaml:"model"`
+	Threshold      float64 `yaml:"threshold"`       // 置信度达到此值才进入审核队列（或自动发奖）
+	AutoAward      bool    `yaml:"auto_award"`      // 为 true 时直接发奖，否则交由管理员审核
+	TimeoutSeconds int     `yaml:"timeout_seconds"` // 单次判定的超时秒数
+}
+
+// ModelPrice 模型单价（每百万 token，货币单位自定）
+type ModelPrice struct {
+	InputPerMillion  float64 `yaml:"input_per_million"`
+	OutputPerMillion float64 `yaml:"output_per_million"`
+}
+
+// AIEndpointConfig 单个上游端点配置
+type AIEndpointConfig struct {
+	Name     string `yaml:"name"`
+	Provider string `yaml:"provider"`
+	APIURL   string `yaml:"api_url"`
+	APIKey   string `yaml:"api_key"`
+	Model    string `yaml:"model"`
+}
+
+// CircuitBreakerConfig 端点熔断配置
+type CircuitBreakerConfig struct {
+	FailureThreshold int `yaml:"failure_threshold"` // 连续失败多少次后熔断
+	CooldownSeconds  int `yaml:"cooldown_seconds"`  // 熔断持续秒数
+}
+
+// EndpointList 返回按优先级排列的端点列表
+// 未配置 endpoints 时，将顶层的 provider / api_url / api_key / model 视为唯一端点
+func (c *AIConfig) EndpointList() []AIEndpointConfig {
+	endpoints := c.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []AIEndpointConfig{{
+			Provider: c.Provider,
+			APIURL:   c.APIURL,
+			APIKey:   c.APIKey,
+			Model:    c.Model,
+		}}
+	}
+
+	list := make([]AIEndpointConfig, len(endpoints))
+	for i, ep := range endpoints {
+		if ep.Name == "" {
+			ep.Name = fmt.Sprintf("#%d", i+1)
+			if ep.Model != "" {
+				ep.Name = fmt.Sprintf("#%d %s", i+1, ep.Model)
+			}
+		}
+		list[i] = ep
+	}
+	return list
 }
 
 // GameConfig 游戏规则配置
 type GameConfig struct {
-	Deadline         string          `yaml:"deadline"`
-	MaxTurns         int             `yaml:"max_turns"`
-	MaxMessageLength int             `yaml:"max_message_length"`
-	Passwords        PasswordsConfig `yaml:"passwords"`
-	Prizes           PrizesConfig    `yaml:"prizes"`
+	Deadline         string `yaml:"deadline"`
+	MaxTurns         int    `yaml:"max_turns"`
+	MaxMessageLength int    `yaml:"max_message_length"`
+	// 奖项列表（按 priority 排序后依次检测）；为空时由旧版 passwords + prizes 生成主口令与彩蛋口令两档
+	Tiers     []TierConfig    `yaml:"tiers"`
+	Passwords PasswordsConfig `yaml:"passwords"`
+	Prizes    PrizesConfig    `yaml:"prizes"`
 	// 福利机制：当用户总对话轮次达到阈值时，自动在 AI 回复中附带口令
 	BonusConsolationThreshold int `yaml:"bonus_consolation_threshold"`
 	BonusGrandThreshold       int `yaml:"bonus_grand_threshold"`
+	// 福利机制使用的奖项 ID（默认 consolation / grand）
+	BonusConsolationTier string `yaml:"bonus_consolation_tier"`
+	BonusGrandTier       string `yaml:"bonus_grand_tier"`
+	// 消耗预算：超出后拒绝继续调用 AI
+	Budgets BudgetsConfig `yaml:"budgets"`
+	// 口令检测参数
+	Detection DetectionConfig `yaml:"detection"`
+	// 随机口令：每个对话（或用户）按奖项模板生成独立口令
+	RandomSecrets RandomSecretsConfig `yaml:"random_secrets"`
+	// 猜口令：玩家根据提示推断出口令后直接提交
+	Guess GuessConfig `yaml:"guess"`
+	// 闯关模式：按顺序排列的关卡，为空时不开启
+	Levels []LevelConfig `yaml:"levels"`
 }
 
-// PasswordsConfig 口令配置
+// GuessConfig 猜口令配置
+type GuessConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 每个用户每日可提交的次数，-1 表示不限
+	MaxAttempts int `yaml:"max_attempts"`
+	// 同一用户两次提交之间的最短间隔（秒），-1 表示不限
+	CooldownSeconds int `yaml:"cooldown_seconds"`
+}
+
+// 随机口令的生成范围
+const (
+	SecretScopeConversation = "conversation" // 每个对话一套口令
+	SecretScopeUser         = "user"         // 每个用户一套口令，该用户的所有对话共用
+)
+
+// RandomSecretsConfig 随机口令配置
+// 开启后配置了 template 的奖项不再使用固定口令，获奖记录公开后也无法被他人直接复用
+type RandomSecretsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Scope   string `yaml:"scope"` // conversation（默认）/ user
+	// 加密密钥：生成的口令加密后保存在对话记录中，更换密钥后已有对话的口令将无法还原
+	Key string `yaml:"key"`
+	// 词表：模板中的 {name} 占位符从同名词表中随机取词
+	WordLists map[string][]string `yaml:"word_lists"`
+}
+
+// DetectionConfig 口令检测配置
+type DetectionConfig struct {
+	// 拼音匹配的最低覆盖率（0~1）：口令拼音中被回复连续命中的字母比例达到该值即判定泄露，-1 表示关闭
+	PinyinMinCoverage float64 `yaml:"pinyin_min_coverage"`
+	// 跨消息片段累计：对话中所有 AI 回复透露的口令片段合计覆盖口令的比例（0~1）达到该值即判定泄露，-1 表示关闭（默认）
+	FragmentMinCoverage float64 `yaml:"fragment_min_coverage"`
+	// 计入片段累计的最短片段字数（默认 5，常见的双字词和四字祝福语不计入）
+	FragmentMinLength int `yaml:"fragment_min_length"`
+	// 位置模式：从藏头 / 藏尾 / 每句首尾字拼出的序列中检测口令（未填写时默认开启）
+	Patterns *bool `yaml:"patterns"`
+	// 固定间隔取字（"每隔 N 个字"）检测的最大间隔，-1 表示关闭
+	MaxStride int `yaml:"max_stride"`
+	// 编辑距离匹配的默认发奖相似度 / 疑似泄露记录相似度（0~1，-1 表示关闭），奖项可在 match.fuzzy 中单独设置
+	FuzzyMinSimilarity    float64 `yaml:"fuzzy_min_similarity"`
+	FuzzyReviewSimilarity float64 `yaml:"fuzzy_review_similarity"`
+}
+
+// BudgetsConfig 消耗预算（token 数与费用任一达到上限即视为耗尽，0 表示不限制）
+// "每日"按活动截止时间所在时区的自然日计算
+type BudgetsConfig struct {
+	DailyTokens        int64   `yaml:"daily_tokens"`        // 全站每日 token 上限
+	DailyCost          float64 `yaml:"daily_cost"`          // 全站每日费用上限
+	UserDailyTokens    int64   `yaml:"user_daily_tokens"`   // 单个用户每日 token 上限
+	UserDailyCost      float64 `yaml:"user_daily_cost"`     // 单个用户每日费用上限
+	ConversationTokens int64   `yaml:"conversation_tokens"` // 单个对话 token 上限
+	ConversationCost   float64 `yaml:"conversation_cost"`   // 单个对话费用上限
+}
+
+// PasswordsConfig 口令配置（旧版，未配置 tiers 时使用）
 type PasswordsConfig struct {
 	Grand       string `yaml:"grand"`
 	Consolation string `yaml:"consolation"`
+	// 各口令的检测规则
+	GrandMatch       MatchConfig `yaml:"grand_match"`
+	ConsolationMatch MatchConfig `yaml:"consolation_match"`
+}
+
+// MatchConfig 单条口令的检测规则
+type MatchConfig struct {
+	// 关键词片段（必须是口令原文的子串），回复中出现足够多的片段即判定泄露
+	Keywords []string `yaml:"keywords"`
+	// 关键词层至少命中的片段数，0 表示全部
+	MinKeywords int          `yaml:"min_keywords"`
+	Layers      LayersConfig `yaml:"layers"`
+	Fuzzy       FuzzyConfig  `yaml:"fuzzy"`
 }
 
-// PrizesConfig 奖品配置
+// FuzzyConfig 单条口令的编辑距离匹配容忍度（未填写时沿用 game.detection 中的默认值）
+type FuzzyConfig struct {
+	// 最大编辑距离：配置后按距离判断是否发奖，忽略 min_similarity
+	MaxDistance int `yaml:"max_distance"`
+	// 发奖所需的最低相似度（1 - 编辑距离 / 口令字数），-1 表示不发奖
+	MinSimilarity float64 `yaml:"min_similarity"`
+	// 未达发奖标准、但相似度不低于该值时记为疑似泄露进入审核队列，-1 表示不记录
+	ReviewSimilarity float64 `yaml:"review_similarity"`
+}
+
+// LayersConfig 各检测层开关（未填写时除片段累计外默认开启）
+type LayersConfig struct {
+	Exact    *bool `yaml:"exact"`    // 精确匹配
+	Stripped *bool `yaml:"stripped"` // 去标点匹配
+	Keywords *bool `yaml:"keywords"` // 关键词片段匹配
+	Pinyin   *bool `yaml:"pinyin"`   // 拼音 / 谐音匹配
+	// 编辑距离匹配
+	Fuzzy *bool `yaml:"fuzzy"`
+	// 跨消息片段累计（默认关闭）
+	Fragments *bool `yaml:"fragments"`
+}
+
+// PrizesConfig 奖品配置（旧版，未配置 tiers 时使用）
 type PrizesConfig struct {
 	GrandAmount       string `yaml:"grand_amount"`
 	ConsolationAmount string `yaml:"consolation_amount"`
@@ -93,12 +429,435 @@ func Load(path string) (*Config, error) {
 	if cfg.Server.Port == 0 {
 		cfg.Server.Port = 8080
 	}
+	if cfg.Server.Session.TTLHours == 0 {
+		cfg.Server.Session.TTLHours = 168
+	}
+	if cfg.Server.Session.Secure == nil {
+		on := true
+		cfg.Server.Session.Secure = &on
+	}
+	if cfg.Server.Session.SameSite == "" {
+		cfg.Server.Session.SameSite = SameSiteLax
+	}
+	if cfg.Server.Session.SweepIntervalMinutes == 0 {
+		cfg.Server.Session.SweepIntervalMinutes = 60
+	}
+	if cfg.Auth.EmailCode.CodeTTLMinutes == 0 {
+		cfg.Auth.EmailCode.CodeTTLMinutes = 10
+	}
+	if cfg.Auth.EmailCode.MaxAttempts == 0 {
+		cfg.Auth.EmailCode.MaxAttempts = 5
+	}
+	if cfg.Auth.EmailCode.ResendSeconds == 0 {
+		cfg.Auth.EmailCode.ResendSeconds = 60
+	}
+	if cfg.Auth.EmailCode.HourlyLimit == 0 {
+		cfg.Auth.EmailCode.HourlyLimit = 5
+	}
+	if cfg.Auth.EmailCode.Subject == "" {
+		cfg.Auth.EmailCode.Subject = "AI 守护者挑战登录验证码"
+	}
+	if cfg.Auth.EmailCode.SMTP.Security == "" {
+		cfg.Auth.EmailCode.SMTP.Security = SMTPSecurityStartTLS
+	}
+	if cfg.Auth.EmailCode.SMTP.Port == 0 {
+		switch cfg.Auth.EmailCode.SMTP.Security {
+		case SMTPSecurityTLS:
+			cfg.Auth.EmailCode.SMTP.Port = 465
+		case SMTPSecurityStartTLS:
+			cfg.Auth.EmailCode.SMTP.Port = 587
+		default:
+			cfg.Auth.EmailCode.SMTP.Port = 25
+		}
+	}
+	if cfg.Database.Driver == "" {
+		cfg.Database.Driver = DatabaseSQLite
+	}
+	if cfg.Database.Path == "" {
+		cfg.Database.Path = "data.db"
+	}
 	if cfg.Game.MaxTurns == 0 {
 		cfg.Game.MaxTurns = 20
 	}
 	if cfg.Game.MaxMessageLength == 0 {
 		cfg.Game.MaxMessageLength = 1500
 	}
+	if cfg.AI.CircuitBreaker.FailureThreshold == 0 {
+		cfg.AI.CircuitBreaker.FailureThreshold = 3
+	}
+	if cfg.AI.CircuitBreaker.CooldownSeconds == 0 {
+		cfg.AI.CircuitBreaker.CooldownSeconds = 60
+	}
+	if cfg.AI.Judge.Threshold == 0 {
+		cfg.AI.Judge.Threshold = 0.8
+	}
+	if cfg.AI.Judge.TimeoutSeconds == 0 {
+		cfg.AI.Judge.TimeoutSeconds = 30
+	}
+	if cfg.AI.RequestTimeoutSeconds == 0 {
+		cfg.AI.RequestTimeoutSeconds = 180
+	}
+	if cfg.AI.IdleTimeoutSeconds == 0 {
+		cfg.AI.IdleTimeoutSeconds = 30
+	}
+	if cfg.AI.InputGuard.DefaultPolicy == "" {
+		cfg.AI.InputGuard.DefaultPolicy = GuardTag
+	}
+	if cfg.AI.InputGuard.WarnMessage == "" {
+		cfg.AI.InputGuard.WarnMessage = "守护者察觉到了你的小动作，已提高警惕"
+	}
+	if cfg.AI.InputGuard.RefuseMessage == "" {
+		cfg.AI.InputGuard.RefuseMessage = "这条消息包含不被允许的指令，守护者拒绝回应（仍计入轮次）"
+	}
+	if cfg.AI.Temperature == nil {
+		t := 0.7
+		cfg.AI.Temperature = &t
+	}
+	if cfg.AI.MaxTokens == 0 {
+		cfg.AI.MaxTokens = 2000
+	}
+	if cfg.AI.Context.Strategy == "" {
+		cfg.AI.Context.Strategy = ContextTruncate
+	}
+	if cfg.AI.Context.Summary.MaxTokens == 0 {
+		cfg.AI.Context.Summary.MaxTokens = 500
+	}
+	if cfg.AI.Context.Summary.TimeoutSeconds == 0 {
+		cfg.AI.Context.Summary.TimeoutSeconds = 30
+	}
+	if cfg.AI.OutputGuard.Action == "" {
+		cfg.AI.OutputGuard.Action = OutputRedact
+	}
+	if cfg.AI.OutputGuard.RefuseMessage == "" {
+		cfg.AI.OutputGuard.RefuseMessage = "守护者的回复触发了口令过滤，已被拦截"
+	}
+	if cfg.AI.InputGuard.Classifier.Threshold == 0 {
+		cfg.AI.InputGuard.Classifier.Threshold = 0.7
+	}
+	if cfg.AI.InputGuard.Classifier.TimeoutSeconds == 0 {
+		cfg.AI.InputGuard.Classifier.TimeoutSeconds = 10
+	}
+	if cfg.Game.Guess.MaxAttempts == 0 {
+		cfg.Game.Guess.MaxAttempts = 5
+	}
+	if cfg.Game.Guess.CooldownSeconds == 0 {
+		cfg.Game.Guess.CooldownSeconds = 30
+	}
+	if cfg.Game.Detection.PinyinMinCoverage == 0 {
+		cfg.Game.Detection.PinyinMinCoverage = 0.9
+	}
+	if cfg.Game.Detection.FragmentMinCoverage == 0 {
+		cfg.Game.Detection.FragmentMinCoverage = -1
+	}
+	if cfg.Game.Detection.FragmentMinLength == 0 {
+		cfg.Game.Detection.FragmentMinLength = 5
+	}
+	if cfg.Game.Detection.Patterns == nil {
+		on := true
+		cfg.Game.Detection.Patterns = &on
+	}
+	if cfg.Game.Detection.MaxStride == 0 {
+		cfg.Game.Detection.MaxStride = 5
+	}
+	if cfg.Game.Detection.FuzzyMinSimilarity == 0 {
+		cfg.Game.Detection.FuzzyMinSimilarity = 0.9
+	}
+	if cfg.Game.Detection.FuzzyReviewSimilarity == 0 {
+		cfg.Game.Detection.FuzzyReviewSimilarity = 0.75
+	}
+	if cfg.Game.RandomSecrets.Scope == "" {
+		cfg.Game.RandomSecrets.Scope = SecretScopeConversation
+	}
+	if cfg.Game.BonusConsolationTier == "" {
+		cfg.Game.BonusConsolationTier = TierConsolation
+	}
+	if cfg.Game.BonusGrandTier == "" {
+		cfg.Game.BonusGrandTier = TierGrand
+	}
+	// 闯关模式可以不配置奖项；仍填写了旧版口令时照常生成
+	legacy := cfg.Game.Passwords.Grand != "" || cfg.Game.Passwords.Consolation != ""
+	if len(cfg.Game.Tiers) == 0 && (len(cfg.Game.Levels) == 0 || legacy) {
+		cfg.Game.Tiers = cfg.Game.legacyTiers()
+	}
+	sortTiers(cfg.Game.Tiers)
+	for i := range cfg.Game.Tiers {
+		cfg.Game.Tiers[i].Match.Layers.setDefaults()
+		cfg.Game.Tiers[i].Match.Fuzzy.setDefaults(cfg.Game.Detection)
+	}
+	for i := range cfg.Game.Levels {
+		cfg.Game.Levels[i].Match.Layers.setDefaults()
+		cfg.Game.Levels[i].Match.Fuzzy.setDefaults(cfg.Game.Detection)
+	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+// setDefaults 未填写的检测层默认开启（片段累计容易误报，默认关闭）
+func (l *LayersConfig) setDefaults() {
+	for _, p := range []**bool{&l.Exact, &l.Stripped, &l.Keywords, &l.Pinyin, &l.Fuzzy} {
+		if *p == nil {
+			on := true
+			*p = &on
+		}
+	}
+	if l.Fragments == nil {
+		off := false
+		l.Fragments = &off
+	}
+}
+
+// validate 校验输入检测的处理方式（类别名称由 service.NewInputGuard 校验）
+func (g *InputGuardConfig) validate() error {
+	if !validGuardPolicy(g.DefaultPolicy) {
+		return fmt.Errorf("ai.input_guard.default_policy 只能为 allow、tag、warn 或 refuse，当前为 %q", g.DefaultPolicy)
+	}
+	for category, p := range g.Policies {
+		if !validGuardPolicy(p) {
+			return fmt.Errorf("ai.input_guard.policies.%s 只能为 allow、tag、warn 或 refuse，当前为 %q", category, p)
+		}
+	}
+	if t := g.Classifier.Threshold; t <= 0 || t > 1 {
+		return fmt.Errorf("ai.input_guard.classifier.threshold 必须在 0~1 之间，当前为 %v", t)
+	}
+	return nil
+}
+
+// validateGeneration 校验生成参数与上下文窗口配置
+func (c *AIConfig) validateGeneration() error {
+	if t := *c.Temperature; t < 0 || t > 2 {
+		return fmt.Errorf("ai.temperature 必须在 0~2 之间，当前为 %v", t)
+	}
+	if p := c.TopP; p < 0 || p > 1 {
+		return fmt.Errorf("ai.top_p 必须在 0~1 之间，当前为 %v", p)
+	}
+	if c.MaxTokens < 1 {
+		return fmt.Errorf("ai.max_tokens 必须大于 0，当前为 %d", c.MaxTokens)
+	}
+	for model, n := range c.Context.Windows {
+		// 窗口至少要容纳单条回复
+		if n != 0 && n <= c.MaxTokens {
+			return fmt.Errorf("ai.context.windows.%s 必须大于 ai.max_tokens（%d），当前为 %d", model, c.MaxTokens, n)
+		}
+	}
+	if s := c.Context.Strategy; s != ContextTruncate && s != ContextSummarize {
+		return fmt.Errorf("ai.context.strategy 只能为 truncate 或 summarize，当前为 %q", s)
+	}
+	if c.Context.Summary.MaxTokens < 1 {
+		return fmt.Errorf("ai.context.summary.max_tokens 必须大于 0，当前为 %d", c.Context.Summary.MaxTokens)
+	}
+	return nil
+}
+
+// validGuardPolicy 判断是否为已知的输入检测处理方式
+func validGuardPolicy(p string) bool {
+	return p == GuardAllow || p == GuardTag || p == GuardWarn || p == GuardRefuse
+}
+
+// setDefaults 未填写的相似度沿用 game.detection 中的默认值
+func (f *FuzzyConfig) setDefaults(d DetectionConfig) {
+	if f.MinSimilarity == 0 {
+		f.MinSimilarity = d.FuzzyMinSimilarity
+	}
+	if f.ReviewSimilarity == 0 {
+		f.ReviewSimilarity = d.FuzzyReviewSimilarity
+	}
+}
+
+// Validate 校验配置的一致性，口令相关的错误会导致误判，必须在启动时暴露
+func (c *Config) Validate() error {
+	if err := c.Server.Session.validate(); err != nil {
+		return err
+	}
+
+	switch c.Database.Driver {
+	case DatabaseSQLite:
+	case DatabasePostgres:
+		if c.Database.DSN == "" {
+			return fmt.Errorf("database.driver 为 postgres 时必须填写 database.dsn")
+		}
+	default:
+		return fmt.Errorf("database.driver 只能为 sqlite 或 postgres，当前为 %q", c.Database.Driver)
+	}
+
+	if err := c.Game.validateTiers(); err != nil {
+		return err
+	}
+
+	if err := c.validateEmailCode(); err != nil {
+		return err
+	}
+
+	if err := c.validateRandomSecrets(); err != nil {
+		return err
+	}
+
+	if err := c.validateLevels(); err != nil {
+		return err
+	}
+
+	if cov := c.Game.Detection.PinyinMinCoverage; cov > 1 || (cov < 0 && cov != -1) {
+		return fmt.Errorf("game.detection.pinyin_min_coverage 必须在 0~1 之间或为 -1，当前为 %v", cov)
+	}
+	if cov := c.Game.Detection.FragmentMinCoverage; cov > 1 || (cov < 0 && cov != -1) {
+		return fmt.Errorf("game.detection.fragment_min_coverage 必须在 0~1 之间或为 -1，当前为 %v", cov)
+	}
+	if n := c.Game.Detection.FragmentMinLength; n < 1 {
+		return fmt.Errorf("game.detection.fragment_min_length 必须大于 0，当前为 %d", n)
+	}
+	if n := c.Game.Detection.MaxStride; n < 2 && n != -1 {
+		return fmt.Errorf("game.detection.max_stride 必须不小于 2 或为 -1，当前为 %d", n)
+	}
+	for name, v := range map[string]float64{
+		"fuzzy_min_similarity":    c.Game.Detection.FuzzyMinSimilarity,
+		"fuzzy_review_similarity": c.Game.Detection.FuzzyReviewSimilarity,
+	} {
+		if !validRatio(v) {
+			return fmt.Errorf("game.detection.%s 必须在 0~1 之间或为 -1，当前为 %v", name, v)
+		}
+	}
+	if err := c.AI.InputGuard.validate(); err != nil {
+		return err
+	}
+	if a := c.AI.OutputGuard.Action; a != OutputRedact && a != OutputRefuse {
+		return fmt.Errorf("ai.output_guard.action 只能为 redact 或 refuse，当前为 %q", a)
+	}
+	if err := c.AI.validateGeneration(); err != nil {
+		return err
+	}
+	if n := c.Game.Guess.MaxAttempts; n < 1 && n != -1 {
+		return fmt.Errorf("game.guess.max_attempts 必须大于 0 或为 -1，当前为 %d", n)
+	}
+	if n := c.Game.Guess.CooldownSeconds; n < 1 && n != -1 {
+		return fmt.Errorf("game.guess.cooldown_seconds 必须大于 0 或为 -1，当前为 %d", n)
+	}
+	return nil
+}
+
+// validateMatch 校验单条口令及其检测规则
+func validateMatch(name, secret string, m MatchConfig) error {
+	if strings.TrimSpace(secret) == "" {
+		// 空口令会被任何回复"包含"
+		return fmt.Errorf("%s.secret 不能为空", name)
+	}
+	for i, kw := range m.Keywords {
+		if kw == "" {
+			return fmt.Errorf("%s.match.keywords[%d] 不能为空", name, i)
+		}
+		if !strings.Contains(secret, kw) {
+			return fmt.Errorf("%s.match.keywords[%d] %q 不是口令 %q 的子串", name, i, kw, secret)
+		}
+	}
+	if m.MinKeywords < 0 || m.MinKeywords > len(m.Keywords) {
+		return fmt.Errorf("%s.match.min_keywords 必须在 0~%d 之间，当前为 %d", name, len(m.Keywords), m.MinKeywords)
+	}
+	return validateFuzzy(name, m.Fuzzy)
+}
+
+// validateFuzzy 校验编辑距离匹配的容忍度
+func validateFuzzy(name string, f FuzzyConfig) error {
+	if f.MaxDistance < 0 {
+		return fmt.Errorf("%s.match.fuzzy.max_distance 不能为负数", name)
+	}
+	if !validRatio(f.MinSimilarity) {
+		return fmt.Errorf("%s.match.fuzzy.min_similarity 必须在 0~1 之间或为 -1，当前为 %v", name, f.MinSimilarity)
+	}
+	if !validRatio(f.ReviewSimilarity) {
+		return fmt.Errorf("%s.match.fuzzy.review_similarity 必须在 0~1 之间或为 -1，当前为 %v", name, f.ReviewSimilarity)
+	}
+	return nil
+}
+
+// validRatio 判断比例配置是否在 (0, 1] 之间或为 -1（关闭）
+func validRatio(v float64) bool {
+	return (v > 0 && v <= 1) || v == -1
+}
+
+// JudgeEndpoint 返回判定器使用的端点
+// 未指定 provider 时沿用对话的首个端点（地址和密钥一并沿用，model 可单独指定）
+func (c *AIConfig) JudgeEndpoint() AIEndpointConfig {
+	return c.inheritEndpoint(AIEndpointConfig{
+		Name:     "judge",
+		Provider: c.Judge.Provider,
+		APIURL:   c.Judge.APIURL,
+		APIKey:   c.Judge.APIKey,
+		Model:    c.Judge.Model,
+	})
+}
+
+// SummaryEndpoint 对话摘要模型使用的端点（未单独配置时沿用首个对话端点）
+func (c *AIConfig) SummaryEndpoint() AIEndpointConfig {
+	s := c.Context.Summary
+	return c.inheritEndpoint(AIEndpointConfig{
+		Name:     "summary",
+		Provider: s.Provider,
+		APIURL:   s.APIURL,
+		APIKey:   s.APIKey,
+		Model:    s.Model,
+	})
+}
+
+// ClassifierEndpoint 输入检测分类模型使用的端点（未单独配置时沿用首个对话端点）
+func (c *AIConfig) ClassifierEndpoint() AIEndpointConfig {
+	cl := c.InputGuard.Classifier
+	return c.inheritEndpoint(AIEndpointConfig{
+		Name:     "classifier",
+		Provider: cl.Provider,
+		APIURL:   cl.APIURL,
+		APIKey:   cl.APIKey,
+		Model:    cl.Model,
+	})
+}
+
+// inheritEndpoint provider 留空时沿用首个对话端点的地址、密钥和模型（model 已填写时保留）
+func (c *AIConfig) inheritEndpoint(ep AIEndpointConfig) AIEndpointConfig {
+	if ep.Provider == "" {
+		if list := c.EndpointList(); len(list) > 0 {
+			ep.Provider = list[0].Provider
+			ep.APIURL = list[0].APIURL
+			ep.APIKey = list[0].APIKey
+			if ep.Model == "" {
+				ep.Model = list[0].Model
+			}
+		}
+	}
+	return ep
+}
+
+// RequestTimeout 单次生成的总时长上限（0 表示不限制）
+func (c *AIConfig) RequestTimeout() time.Duration {
+	return positiveSeconds(c.RequestTimeoutSeconds)
+}
+
+// IdleTimeout 上游流式数据的最长间隔（0 表示不限制）
+func (c *AIConfig) IdleTimeout() time.Duration {
+	return positiveSeconds(c.IdleTimeoutSeconds)
+}
+
+// positiveSeconds 将秒数转换为时长，非正数视为不限制
+func positiveSeconds(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// Cost 按价格表计算一次生成的费用；模型未配置价格时返回 0
+func (c *AIConfig) Cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := c.Pricing[model]
+	if !ok {
+		price, ok = c.Pricing["default"]
+		if !ok {
+			return 0
+		}
+	}
+	return (float64(promptTokens)*price.InputPerMillion + float64(completionTokens)*price.OutputPerMillion) / 1e6
+}
+
+// DayStart 返回 t 所在自然日的零点（时区与活动截止时间一致），用于每日预算统计
+func (c *Config) DayStart(t time.Time) time.Time {
+	t = t.In(c.DeadlineTime().Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LevelConfig 关卡配置：每关有独立的守护者提示词和口令，通关（获取本关口令）后解锁下一关
+// 奖项字段（id、name、secret、match 等）与 TierConfig 相同，获奖记录以关卡 ID 作为奖项 ID
+type LevelConfig struct {
+	TierConfig `yaml:",inline"`
+	// 本关守护者的系统提示词，可使用占位符 {{secret.<关卡ID>}} 代替口令原文
+	SystemPrompt string `yaml:"system_prompt"`
+	// 本关开场白，为空时使用默认开场白
+	Greeting string `yaml:"greeting"`
+	// 本关每个对话的最大轮次，0 表示沿用 game.max_turns
+	MaxTurns int `yaml:"max_turns"`
+	// 覆盖 ai.input_guard.policies 中的处理方式（仅在输入检测开启时生效）
+	InputPolicies map[string]string `yaml:"input_policies"`
+	// 是否启用泄露二次判定，未填写时沿用 ai.judge.enabled（只能关闭，不能在全局未开启时单独开启）
+	Judge *bool `yaml:"judge"`
+	// 本关是否开启输出过滤，未填写时沿用 ai.output_guard.enabled（可用于只在后面的关卡开启防守模式）
+	OutputGuard *bool `yaml:"output_guard"`
+}
+
+// Level 按 ID 查找关卡，不存在时返回 nil
+func (g *GameConfig) Level(id string) *LevelConfig {
+	for i := range g.Levels {
+		if g.Levels[i].ID == id {
+			return &g.Levels[i]
+		}
+	}
+	return nil
+}
+
+// JudgeEnabled 判断本关是否进行泄露二次判定（全局判定开启时）
+func (l *LevelConfig) JudgeEnabled() bool {
+	return l.Judge == nil || *l.Judge
+}
+
+// OutputGuardEnabled 判断本关是否开启输出过滤
+func (l *LevelConfig) OutputGuardEnabled(global bool) bool {
+	if l.OutputGuard == nil {
+		return global
+	}
+	return *l.OutputGuard
+}
+
+// validateLevels 校验关卡列表：ID 唯一且不与奖项重复、口令与提示词必填、检测规则有效
+func (c *Config) validateLevels() error {
+	g := &c.Game
+	if len(g.Levels) == 0 {
+		return nil
+	}
+	if g.RandomSecrets.Enabled {
+		// 关卡进度按关卡 ID 记录，每关只有一条固定口令
+		return fmt.Errorf("game.levels 不能与 game.random_secrets 同时使用")
+	}
+
+	ids := make(map[string]bool)
+	secrets := make(map[string]string)
+	for _, t := range g.Tiers {
+		secrets[t.Secret] = "game.tiers[" + t.ID + "]"
+	}
+	for i, l := range g.Levels {
+		if l.ID == "" {
+			return fmt.Errorf("game.levels[%d].id 不能为空", i)
+		}
+		if ids[l.ID] {
+			return fmt.Errorf("game.levels 中的关卡 ID %q 重复", l.ID)
+		}
+		ids[l.ID] = true
+		for _, t := range g.Tiers {
+			if t.ID == l.ID {
+				// 获奖记录以关卡 ID 作为奖项 ID，重复时获奖榜和名额无法区分
+				return fmt.Errorf("game.levels[%s] 的 ID 与 game.tiers 中的奖项重复", l.ID)
+			}
+		}
+
+		name := fmt.Sprintf("game.levels[%s]", l.ID)
+		if l.Name == "" {
+			return fmt.Errorf("%s.name 不能为空", name)
+		}
+		if l.Quota < 0 {
+			return fmt.Errorf("%s.quota 不能为负数", name)
+		}
+		if l.Template != "" {
+			return fmt.Errorf("%s 不支持 template，请填写固定口令 secret", name)
+		}
+		if err := validateMatch(name, l.Secret, l.Match); err != nil {
+			return err
+		}
+		if other, ok := secrets[l.Secret]; ok {
+			return fmt.Errorf("%s 与 %s 的口令相同", name, other)
+		}
+		secrets[l.Secret] = name
+
+		if strings.TrimSpace(l.SystemPrompt) == "" {
+			return fmt.Errorf("%s.system_prompt 不能为空", name)
+		}
+		if l.MaxTurns < 0 {
+			return fmt.Errorf("%s.max_turns 不能为负数", name)
+		}
+		for category, p := range l.InputPolicies {
+			if !validGuardPolicy(p) {
+				return fmt.Errorf("%s.input_policies.%s 只能为 allow、tag、warn 或 refuse，当前为 %q", name, category, p)
+			}
+		}
+	}
+
+	// 福利机制按用户总轮次发放口令，关卡必须靠自己通关
+	if g.BonusConsolationThreshold > 0 && ids[g.BonusConsolationTier] {
+		return fmt.Errorf("game.bonus_consolation_tier 不能引用关卡 %q", g.BonusConsolationTier)
+	}
+	if g.BonusGrandThreshold > 0 && ids[g.BonusGrandTier] {
+		return fmt.Errorf("game.bonus_grand_tier 不能引用关卡 %q", g.BonusGrandTier)
+	}
+	return nil
+}
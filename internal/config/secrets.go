@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateSlot 随机口令模板中的词表占位符，如 {animal}
+var templateSlot = regexp.MustCompile(`\{(\w+)\}`)
+
+// TemplateSlots 返回模板中依次出现的词表名称
+func TemplateSlots(template string) []string {
+	var names []string
+	for _, m := range templateSlot.FindAllStringSubmatch(template, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// SecretPlaceholder 返回系统提示词中代表某个奖项口令的占位符，如 {{secret.grand}}
+// 对话时替换为该对话实际使用的口令（固定口令同样适用）
+func SecretPlaceholder(tierID string) string {
+	return "{{secret." + tierID + "}}"
+}
+
+// validateRandomSecrets 校验随机口令配置：密钥、范围、模板引用的词表，以及系统提示词中的占位符
+func (c *Config) validateRandomSecrets() error {
+	rs := c.Game.RandomSecrets
+	if !rs.Enabled {
+		return nil
+	}
+
+	if len(rs.Key) < 16 {
+		return fmt.Errorf("game.random_secrets.key 至少需要 16 个字符")
+	}
+	if rs.Scope != SecretScopeConversation && rs.Scope != SecretScopeUser {
+		return fmt.Errorf("game.random_secrets.scope 只能为 conversation 或 user，当前为 %q", rs.Scope)
+	}
+
+	randomized := 0
+	for _, t := range c.Game.Tiers {
+		if !c.Game.Randomized(&t) {
+			continue
+		}
+		randomized++
+		name := fmt.Sprintf("game.tiers[%s]", t.ID)
+
+		slots := TemplateSlots(t.Template)
+		if len(slots) == 0 {
+			return fmt.Errorf("%s.template 至少需要一个 {词表} 占位符", name)
+		}
+		for _, slot := range slots {
+			words := rs.WordLists[slot]
+			if len(words) == 0 {
+				return fmt.Errorf("%s.template 引用的词表 %q 不存在或为空", name, slot)
+			}
+			for i, w := range words {
+				if strings.TrimSpace(w) == "" {
+					return fmt.Errorf("game.random_secrets.word_lists.%s[%d] 不能为空", slot, i)
+				}
+			}
+		}
+
+		// 关键词由每次抽中的词生成，不能预先配置
+		if len(t.Match.Keywords) > 0 {
+			return fmt.Errorf("%s.match.keywords 不能与 template 同时使用（关键词取自抽中的词）", name)
+		}
+		if t.Match.MinKeywords < 0 || t.Match.MinKeywords > len(slots) {
+			return fmt.Errorf("%s.match.min_keywords 必须在 0~%d 之间，当前为 %d", name, len(slots), t.Match.MinKeywords)
+		}
+		if err := validateFuzzy(name, t.Match.Fuzzy); err != nil {
+			return err
+		}
+
+		// 系统提示词中没有占位符时 AI 守护的仍是固定口令，玩家永远无法获奖
+		if placeholder := SecretPlaceholder(t.ID); !strings.Contains(c.AI.SystemPrompt, placeholder) {
+			return fmt.Errorf("%s 使用随机口令，ai.system_prompt 中必须包含占位符 %s", name, placeholder)
+		}
+	}
+
+	if randomized == 0 {
+		return fmt.Errorf("game.random_secrets 已开启，但没有奖项配置 template")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 旧版配置生成的两档奖项 ID
+const (
+	TierGrand       = "grand"
+	TierConsolation = "consolation"
+)
+
+// TierConfig 奖项配置：每档奖项对应一条口令
+type TierConfig struct {
+	ID     string `yaml:"id"`     // 唯一标识，记录在获奖表中（如 grand）
+	Name   string `yaml:"name"`   // 显示名称（如 特等奖）
+	Icon   string `yaml:"icon"`   // 首页奖项卡片与获奖榜使用的图标
+	Secret string `yaml:"secret"` // 口令原文
+	// 随机口令模板（如 "祝{animal}{blessing}"），仅在 random_secrets.enabled 时生效，此时 secret 可留空
+	Template    string `yaml:"template"`
+	Prize       string `yaml:"prize"`       // 奖品描述
+	Description string `yaml:"description"` // 奖项卡片上的说明文字
+	// 名额上限，0 表示不限（主口令名额用完后福利机制不再提供"继续挑战"选项）
+	Quota int `yaml:"quota"`
+	// 检测优先级，数值越小越先检测；相同时按配置顺序
+	// 一条回复同时泄露多条口令时只按最先命中的奖项发奖
+	Priority int `yaml:"priority"`
+	// 隐藏奖项不在首页展示，只有获奖后才会出现在获奖榜上
+	Hidden bool        `yaml:"hidden"`
+	Match  MatchConfig `yaml:"match"`
+}
+
+// Tier 按 ID 查找奖项，不存在时返回 nil
+// 关卡同样按奖项发奖，ID 不属于 tiers 时在 levels 中查找
+func (g *GameConfig) Tier(id string) *TierConfig {
+	for i := range g.Tiers {
+		if g.Tiers[i].ID == id {
+			return &g.Tiers[i]
+		}
+	}
+	if l := g.Level(id); l != nil {
+		return &l.TierConfig
+	}
+	return nil
+}
+
+// Randomized 判断奖项是否使用随机口令
+func (g *GameConfig) Randomized(t *TierConfig) bool {
+	return g.RandomSecrets.Enabled && t.Template != ""
+}
+
+// legacyTiers 由旧版 passwords + prizes 配置生成主口令、彩蛋口令两档奖项
+func (g *GameConfig) legacyTiers() []TierConfig {
+	return []TierConfig{
+		{
+			ID:          TierGrand,
+			Name:        "特等奖",
+			Icon:        "🏆",
+			Secret:      g.Passwords.Grand,
+			Prize:       g.Prizes.GrandAmount,
+			Description: "成功获取主口令",
+			Quota:       g.Prizes.GrandCount,
+			Priority:    1,
+			Match:       g.Passwords.GrandMatch,
+		},
+		{
+			ID:          TierConsolation,
+			Name:        "安慰奖",
+			Icon:        "🎁",
+			Secret:      g.Passwords.Consolation,
+			Prize:       g.Prizes.ConsolationAmount,
+			Description: "获取彩蛋口令",
+			Quota:       g.Prizes.ConsolationCount,
+			Priority:    2,
+			Match:       g.Passwords.ConsolationMatch,
+		},
+	}
+}
+
+// sortTiers 按检测优先级排序（稳定排序，保留同优先级的配置顺序）
+func sortTiers(tiers []TierConfig) {
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].Priority < tiers[j].Priority
+	})
+}
+
+// validateTiers 校验奖项列表：ID 唯一、口令互不相同、检测规则有效、福利机制引用的奖项存在
+func (g *GameConfig) validateTiers() error {
+	if len(g.Tiers) == 0 && len(g.Levels) == 0 {
+		return fmt.Errorf("game.tiers 至少需要一个奖项")
+	}
+
+	ids := make(map[string]bool)
+	secrets := make(map[string]string)
+	for i, t := range g.Tiers {
+		if t.ID == "" {
+			return fmt.Errorf("game.tiers[%d].id 不能为空", i)
+		}
+		if ids[t.ID] {
+			return fmt.Errorf("game.tiers 中的奖项 ID %q 重复", t.ID)
+		}
+		ids[t.ID] = true
+
+		if t.Name == "" {
+			return fmt.Errorf("game.tiers[%s].name 不能为空", t.ID)
+		}
+		if t.Quota < 0 {
+			return fmt.Errorf("game.tiers[%s].quota 不能为负数", t.ID)
+		}
+		if g.Randomized(&t) {
+			// 随机口令的原文在对话创建时才生成，由 validateRandomSecrets 校验模板
+			continue
+		}
+		if err := validateMatch(fmt.Sprintf("game.tiers[%s]", t.ID), t.Secret, t.Match); err != nil {
+			return err
+		}
+		if other, ok := secrets[t.Secret]; ok {
+			return fmt.Errorf("game.tiers[%s] 与 game.tiers[%s] 的口令相同", t.ID, other)
+		}
+		secrets[t.Secret] = t.ID
+	}
+
+	if g.BonusConsolationThreshold > 0 && g.Tier(g.BonusConsolationTier) == nil {
+		return fmt.Errorf("game.bonus_consolation_tier 引用的奖项 %q 不存在", g.BonusConsolationTier)
+	}
+	if g.BonusGrandThreshold > 0 && g.Tier(g.BonusGrandTier) == nil {
+		return fmt.Errorf("game.bonus_grand_tier 引用的奖项 %q 不存在", g.BonusGrandTier)
+	}
+	return nil
+}
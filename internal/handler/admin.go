@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"ai-guardian-challenge/internal/config"
+	"ai-guardian-challenge/internal/model"
+	"ai-guardian-challenge/internal/service"
+	"ai-guardian-challenge/internal/store"
+)
+
+// AdminHandler 管理接口的 HTTP 处理器
+// 通过请求头 X-Admin-Password 与 admin.password 比对鉴权；未配置密码时管理接口整体关闭
+type AdminHandler struct {
+	store   store.Repository
+	config  *config.Config
+	secrets *SecretManager // 审核发奖时取对话的口令
+	ai      *service.AIService
+}
+
+// NewAdminHandler 创建管理处理器
+func NewAdminHandler(s store.Repository, cfg *config.Config, secrets *SecretManager, ai *service.AIService) *AdminHandler {
+	return &AdminHandler{store: s, config: cfg, secrets: secrets, ai: ai}
+}
+
+// authorize 校验管理员密码，失败时写入错误响应并返回 false
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	password := h.config.Admin.Password
+	if password == "" {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error": "管理接口未启用",
+		})
+		return false
+	}
+
+	given := r.Header.Get("X-Admin-Password")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(password)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": "管理员密码错误",
+		})
+		return false
+	}
+	return true
+}
+
+// GetUsage 查询 token 用量与费用汇总
+// 参数：by=user|conversation|model（默认 user），userId 仅统计指定用户，limit 返回条数（默认 50，最大 500）
+func (h *AdminHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	groupBy := r.URL.Query().Get("by")
+	switch groupBy {
+	case "":
+		groupBy = store.UsageByUser
+	case store.UsageByUser, store.UsageByConversation, store.UsageByModel:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "by 参数只能为 user、conversation 或 model",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"by":    groupBy,
+		"total": h.store.GetUsageTotal(),
+		"items": h.store.GetUsageStats(groupBy, r.URL.Query().Get("userId"), limit),
+	})
+}
+
+// GetInputTags 按输入检测标签汇总玩家使用的攻击手法及其成功率
+func (h *AdminHandler) GetInputTags(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": h.store.GetInputTagStats(),
+	})
+}
+
+// GetEndpoints 查询各 AI 端点的熔断状态（按优先级排列）
+func (h *AdminHandler) GetEndpoints(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": h.ai.EndpointStatuses(),
+	})
+}
+
+// GetLeakReviews 分页查询泄露审核队列
+// 参数：status=pending|approved|rejected|awarded（默认 pending，all 表示全部），page，pageSize（默认 20，最大 100）
+func (h *AdminHandler) GetLeakReviews(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.ReviewPending
+	case "all":
+		status = ""
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	reviews, total := h.store.GetLeakReviews(status, page, pageSize)
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+
+	writeJSON(w, http.StatusOK, model.PaginatedResponse{
+		Data:       reviews,
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		TotalPages: totalPages,
+	})
+}
+
+// GetBlockedLeaks 分页查询输出过滤拦截的回复
+// 参数：page，pageSize（默认 20，最大 100）
+func (h *AdminHandler) GetBlockedLeaks(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	leaks, total := h.store.GetBlockedLeaks(page, pageSize)
+	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
+
+	writeJSON(w, http.StatusOK, model.PaginatedResponse{
+		Data:       leaks,
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		TotalPages: totalPages,
+	})
+}
+
+// resolveReviewRequest 审核处理请求体
+type resolveReviewRequest struct {
+	ID      int64 `json:"id"`
+	Approve bool  `json:"approve"` // true：确认泄露并发奖；false：驳回
+}
+
+// ResolveLeakReview 处理一条待审核记录：批准时按记录的口令类型发奖并结束对话
+func (h *AdminHandler) ResolveLeakReview(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"error": "仅支持 POST",
+		})
+		return
+	}
+
+	var req resolveReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "请求格式错误",
+		})
+		return
+	}
+
+	status := store.ReviewRejected
+	var tier *config.TierConfig
+	var password string
+	if req.Approve {
+		status = store.ReviewApproved
+		if review := h.store.GetLeakReview(req.ID); review != nil {
+			if tier = h.config.Game.Tier(review.LeakType); tier == nil {
+				// 奖项已从配置中移除（如换届后处理旧记录），只能驳回
+				writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+					"error": fmt.Sprintf("奖项 %s 已不存在，无法发奖", review.LeakType),
+				})
+				return
+			}
+			// 口令无法还原时不能发出空口令，记录保持待审核
+			checker, err := h.secrets.Checker(review.ConversationID, review.UserID)
+			if err != nil {
+				writeJSON(w, http.StatusConflict, map[string]interface{}{
+					"error": "该对话的口令无法还原，无法发奖",
+				})
+				return
+			}
+			password = checker.Secret(tier.ID)
+		}
+	}
+
+	review := h.store.ResolveLeakReview(req.ID, status)
+	if review == nil {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "记录不存在或已处理",
+		})
+		return
+	}
+
+	if !req.Approve {
+		log.Printf("🧑‍⚖️ 泄露审核 #%d 已驳回 (对话 %s)", review.ID, review.ConversationID)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"review":  review,
+		})
+		return
+	}
+
+	prize := grantPrize(h.store, review.UserID, review.Nickname, review.ConversationID, tier, password, detectionReview)
+	log.Printf("🧑‍⚖️ 泄露审核 #%d 已批准: 用户 %s, 类型 %s, 首位 %v, 名额已满 %v",
+		review.ID, review.Nickname, review.LeakType, prize.IsFirst, prize.SoldOut)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"review":        review,
+		"prizeType":     prize.DisplayName,
+		"prizeAmount":   prize.Amount,
+		"isFirstWinner": prize.IsFirst,
+		"soldOut":       prize.SoldOut,
+	})
+}
+
+// GetMessageUsage 查询对话中每条 AI 回复的用量
+// 参数：conversationId
+func (h *AdminHandler) GetMessageUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	convID := r.URL.Query().Get("conversationId")
+	if convID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "缺少 conversationId 参数",
+		})
+		return
+	}
+
+	conv := h.store.GetConversation(convID)
+	if conv == nil {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "对话不存在",
+		})
+		return
+	}
+
+	// 与汇总接口一致，只列出实际调用过模型的 AI 回复（开场白等不计）
+	items := []model.MessageUsage{}
+	for i, msg := range conv.Messages {
+		if msg.Role != "assistant" || msg.Model == "" {
+			continue
+		}
+		items = append(items, model.MessageUsage{
+			Index:            i,
+			Model:            msg.Model,
+			Aborted:          msg.Aborted,
+			PromptTokens:     msg.PromptTokens,
+			CompletionTokens: msg.CompletionTokens,
+			LatencyMS:        msg.LatencyMS,
+			Cost:             msg.Cost,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"conversationId": convID,
+		"items":          items,
+	})
+}
+
+// GetFragmentProgress 查询对话已透露的口令片段（跨消息片段累计检测的进度）
+// 参数：conversationId
+func (h *AdminHandler) GetFragmentProgress(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	convID := r.URL.Query().Get("conversationId")
+	if convID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "缺少 conversationId 参数",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"conversationId": convID,
+		"items":          h.store.GetFragmentProgress(convID),
+	})
+}
+
+// revokeSessionsRequest 撤销会话请求体
+type revokeSessionsRequest struct {
+	UserID string `json:"userId"` // 用户 ID（即登录时填写的联系方式）
+}
+
+// RevokeSessions 强制用户在所有设备上退出登录
+func (h *AdminHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"error": "仅支持 POST",
+		})
+		return
+	}
+
+	var req revokeSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "请求格式错误",
+		})
+		return
+	}
+
+	revoked := h.store.DeleteUserSessions(req.UserID)
+	log.Printf("🚪 管理员撤销用户 %s 的全部会话，共 %d 个", req.UserID, revoked)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"userId":  req.UserID,
+		"revoked": revoked,
+	})
+}
@@ -2,22 +2,24 @@ package handler
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
-	"time"
 
 	"ai-guardian-challenge/internal/config"
+	"ai-guardian-challenge/internal/service"
 	"ai-guardian-challenge/internal/store"
 )
 
 // AuthHandler 认证相关的 HTTP 处理器
 type AuthHandler struct {
-	store  *store.Store
+	store  store.Repository
 	config *config.Config
+	mailer service.Mailer // 发送登录验证码（未开启邮箱验证码登录时为 nil）
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(s *store.Store, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{store: s, config: cfg}
+func NewAuthHandler(s store.Repository, cfg *config.Config, mailer service.Mailer) *AuthHandler {
+	return &AuthHandler{store: s, config: cfg, mailer: mailer}
 }
 
 // loginRequest 登录请求体
@@ -27,8 +29,17 @@ type loginRequest struct {
 	CaptchaToken string `json:"captchaToken"`
 }
 
-// Login 处理登录请求
+// Login 处理登录请求（凭联系方式 + 昵称，不验证联系方式归属）
+// 开启邮箱验证码登录后关闭，只能通过 SendLoginCode / VerifyLoginCode 登录
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if h.config.Auth.EmailCode.Enabled {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"error":   "请使用邮箱验证码登录",
+		})
+		return
+	}
+
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
@@ -48,22 +59,31 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// 检查是否为管理员登录
 	isAdmin := req.Contact == h.config.Admin.Contact
+	h.startSession(w, req.Contact, req.Nickname, isAdmin)
+}
 
-	// 创建或获取用户
-	user := h.store.GetOrCreateUser(req.Contact, req.Nickname)
+// startSession 获取或创建用户，创建会话并设置 Cookie，写入登录响应
+func (h *AuthHandler) startSession(w http.ResponseWriter, contact, nickname string, isAdmin bool) {
+	user := h.store.GetOrCreateUser(contact, nickname)
+	if user == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "登录失败，请稍后重试",
+		})
+		return
+	}
 	user.IsAdmin = isAdmin
 
-	// 创建会话
-	token := h.store.CreateSession(user.ID)
-
-	// 设置 Cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   86400 * 7, // 7天过期
-	})
+	// 创建会话并设置 Cookie
+	token := h.store.CreateSession(user.ID, h.config.Server.Session.TTL())
+	if token == "" {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"success": false,
+			"error":   "登录失败，请稍后重试",
+		})
+		return
+	}
+	setSessionCookie(w, h.config.Server.Session, token)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -73,7 +93,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 // CheckAuth 检查认证状态
 func (h *AuthHandler) CheckAuth(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	cookie, err := r.Cookie(sessionCookie)
 	if err != nil {
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"isLoggedIn": false,
@@ -81,7 +101,7 @@ func (h *AuthHandler) CheckAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := h.store.GetUserBySession(cookie.Value)
+	user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value)
 	if user == nil {
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"isLoggedIn": false,
@@ -98,23 +118,49 @@ func (h *AuthHandler) CheckAuth(w http.ResponseWriter, r *http.Request) {
 
 // Logout 处理退出登录
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	cookie, err := r.Cookie(sessionCookie)
 	if err == nil {
 		h.store.DeleteSession(cookie.Value)
 	}
 
-	// 清除 Cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,
-		Expires:  time.Unix(0, 0),
+	clearSessionCookie(w, h.config.Server.Session)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
 	})
+}
+
+// LogoutAll 退出所有设备：删除当前用户的全部会话
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"error": "仅支持 POST",
+		})
+		return
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": "未登录",
+		})
+		return
+	}
+
+	user := h.store.GetUserBySession(cookie.Value, h.config.Server.Session.TTL())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": "会话已过期",
+		})
+		return
+	}
+
+	revoked := h.store.DeleteUserSessions(user.ID)
+	log.Printf("🚪 用户 %s 退出所有设备，共 %d 个会话", user.Nickname, revoked)
 
+	clearSessionCookie(w, h.config.Server.Session)
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
+		"revoked": revoked,
 	})
 }
 
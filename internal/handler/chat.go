@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"ai-guardian-challenge/internal/config"
 	"ai-guardian-challenge/internal/model"
@@ -15,30 +19,40 @@ import (
 
 // ChatHandler 对话相关的 HTTP 处理器
 type ChatHandler struct {
-	store           *store.Store
-	config          *config.Config
-	aiService       *service.AIService
-	passwordChecker *service.PasswordChecker
+	store     store.Repository
+	config    *config.Config
+	aiService *service.AIService
+	secrets   *SecretManager      // 各对话的口令及检测器
+	uploads   *UploadHandler      // 用于读取用户上传的图片
+	judge     service.LeakJudge   // 口令泄露二次判定（未启用时为 nil）
+	guard     *service.InputGuard // 用户输入的提示词注入检测（未启用时为 nil）
+	levels    Levels              // 闯关模式的关卡（未开启时为空）
 }
 
 // NewChatHandler 创建对话处理器
-func NewChatHandler(s *store.Store, cfg *config.Config, ai *service.AIService, pc *service.PasswordChecker) *ChatHandler {
+func NewChatHandler(s store.Repository, cfg *config.Config, ai *service.AIService, secrets *SecretManager, uploads *UploadHandler, judge service.LeakJudge, guard *service.InputGuard, levels Levels) *ChatHandler {
 	return &ChatHandler{
-		store:           s,
-		config:          cfg,
-		aiService:       ai,
-		passwordChecker: pc,
+		store:     s,
+		config:    cfg,
+		aiService: ai,
+		secrets:   secrets,
+		uploads:   uploads,
+		judge:     judge,
+		guard:     guard,
+		levels:    levels,
 	}
 }
 
 // newConversationRequest 创建对话请求体
 type newConversationRequest struct {
 	TurnstileToken string `json:"turnstileToken"`
+	// 闯关模式下要进入的关卡 ID，为空时进入尚未通过的第一关
+	Level string `json:"level"`
 }
 
 // NewConversation 创建新对话
 func (h *ChatHandler) NewConversation(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	cookie, err := r.Cookie(sessionCookie)
 	if err != nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
 			"success": false,
@@ -47,7 +61,7 @@ func (h *ChatHandler) NewConversation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := h.store.GetUserBySession(cookie.Value)
+	user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value)
 	if user == nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
 			"success": false,
@@ -56,26 +70,62 @@ func (h *ChatHandler) NewConversation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 检查用户是否已因福利机制被禁止创建新对话
-	bonusStatus := h.store.GetUserBonusStatus(user.ID)
-	if bonusStatus == "claimed_consolation" || bonusStatus == "claimed_grand" {
-		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+	// 请求体可为空（旧版前端），此时进入默认关卡
+	var req newConversationRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	// 闯关模式：按进度选择关卡
+	var cleared map[string]bool
+	if len(h.levels) > 0 {
+		cleared = h.store.GetClearedLevels(user.ID)
+	}
+	level, status, message := h.levels.chooseLevel(req.Level, cleared)
+	if message != "" {
+		writeJSON(w, status, map[string]interface{}{
 			"success": false,
-			"error":   "你已获得口令奖品，无法再创建新对话",
+			"error":   message,
 		})
 		return
 	}
 
+	// 检查用户是否已因福利机制被禁止创建新对话（关卡按闯关进度限制）
+	if level == nil {
+		bonusStatus := h.store.GetUserBonusStatus(user.ID)
+		if strings.HasPrefix(bonusStatus, "claimed_") {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"error":   "你已获得口令奖品，无法再创建新对话",
+			})
+			return
+		}
+	}
+
 	// 生成开场白
 	initialMessage := h.aiService.GenerateInitialMessage()
+	maxTurns := h.config.Game.MaxTurns
+	levelID := ""
+	if level != nil {
+		levelID = level.ID
+		if level.Greeting != "" {
+			initialMessage = level.Greeting
+		}
+		if level.MaxTurns > 0 {
+			maxTurns = level.MaxTurns
+		}
+	}
 
 	// 创建对话
-	conv := h.store.CreateConversation(user.ID, user.Nickname, h.config.Game.MaxTurns, initialMessage)
+	conv := h.store.CreateConversation(user.ID, user.Nickname, maxTurns, initialMessage, levelID)
+
+	// 随机口令模式：为对话生成专属口令
+	h.secrets.Issue(conv.ID, user.ID)
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":        true,
 		"conversationId": conv.ID,
 		"initialMessage": initialMessage,
+		"maxTurns":       maxTurns,
+		"level":          levelID,
 	})
 }
 
@@ -113,7 +163,7 @@ type messageRequest struct {
 
 // SendMessage 发送消息并流式返回 AI 响应（SSE）
 func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	cookie, err := r.Cookie(sessionCookie)
 	if err != nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
 			"error": "未登录",
@@ -121,7 +171,7 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := h.store.GetUserBySession(cookie.Value)
+	user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value)
 	if user == nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
 			"error": "会话已过期",
@@ -178,29 +228,103 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 构建用户完整消息（含图片）
-	userContent := req.Message
-	if req.ImageURL != "" {
-		userContent = fmt.Sprintf("[图片:%s]\n%s", req.ImageURL, req.Message)
+	// 本对话的口令（随机口令模式下各对话不同），系统提示词中的占位符按此替换
+	// 口令无法还原时对话已无法获奖，不再调用 AI
+	checker, err := h.secrets.Checker(conv.ID, user.ID)
+	if err != nil {
+		writeSecretsLost(w)
+		return
+	}
+
+	// 构建用户消息（含图片时转为多模态片段）
+	userMsg := model.Message{
+		Role:     "user",
+		Content:  req.Message,
+		ImageURL: req.ImageURL,
+	}
+	userChatMsg, err := h.toChatMessage(userMsg)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("图片无法使用: %v", err),
+		})
+		return
+	}
+
+	// 闯关对话使用本关的守护者、输入检测与判定设置
+	aiService, guard, judging := h.aiService, h.guard, h.judge != nil
+	level := h.levels.Get(conv.Level)
+	if level != nil {
+		aiService, guard = level.AI, level.Guard
+		judging = judging && level.JudgeEnabled()
+	}
+
+	// 检查消耗预算（在记录本轮消息、调用 AI 之前）
+	if budget, message := h.exhaustedBudget(user.ID, req.ConversationID); budget != "" {
+		log.Printf("💸 预算 %s 已耗尽，拒绝请求 (用户 %s, 对话 %s)", budget, user.ID, req.ConversationID)
+		setSSEHeaders(w)
+		data, _ := json.Marshal(model.SSEEvent{
+			Type:    "error",
+			Content: message,
+			Code:    "budget_exhausted",
+			Budget:  budget,
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		fmt.Fprintf(w, "data: [DONE]\n\n")
+		return
+	}
+
+	// 输入检测：命中的攻击手法记录为消息标签，按类别的处理方式提醒玩家或拒绝
+	guardAction := service.GuardAllow
+	if guard != nil {
+		result := h.inspectInput(r.Context(), guard, req.ConversationID, req.Message)
+		userMsg.Tags, guardAction = result.Tags, result.Action
+		if guardAction == service.GuardRefuse {
+			// 被拒绝的消息仍记录并计入轮次（防止无成本地试探检测规则），但不会发送给 AI
+			userMsg.Refused = true
+			h.store.AddMessage(req.ConversationID, userMsg)
+			setSSEHeaders(w)
+			data, _ := json.Marshal(model.SSEEvent{
+				Type:    "error",
+				Content: h.config.AI.InputGuard.RefuseMessage,
+				Code:    "input_refused",
+			})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+			return
+		}
 	}
 
 	// 保存用户消息
-	h.store.AddMessage(req.ConversationID, model.Message{
-		Role:    "user",
-		Content: userContent,
-	})
+	h.store.AddMessage(req.ConversationID, userMsg)
 
-	// 构建 AI 消息历史
+	// 构建 AI 消息历史（历史中的图片同样还原为多模态片段）
 	var history []service.ChatMessage
 	for _, msg := range conv.Messages {
-		history = append(history, service.ChatMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+		if msg.Refused {
+			// 被输入检测拒绝的消息从未发送给 AI
+			continue
+		}
+		chatMsg, err := h.toChatMessage(msg)
+		if err != nil {
+			// 图片已被删除等情况：降级为文本占位，不影响本轮对话
+			log.Printf("⚠️ 历史消息图片加载失败 (对话 %s): %v", req.ConversationID, err)
+			chatMsg = service.ChatMessage{Role: msg.Role, Content: "[图片已失效]\n" + chatMsg.Content}
+		}
+		history = append(history, chatMsg)
+	}
+
+	// 跨消息片段累计：以此前各轮记录的片段为基础（未启用时为 nil）
+	var progress []service.Fragment
+	for _, f := range h.store.GetFragmentProgress(conv.ID) {
+		progress = append(progress, service.Fragment{Type: f.Tier, Start: f.Start, Length: f.Length, Text: f.Fragment})
 	}
+	fragments := checker.NewFragmentTracker(progress)
 
 	// 调用 AI 流式生成
-	ch, err := h.aiService.StreamChat(history, userContent)
+	// 使用请求上下文：浏览器断开 SSE 连接时上游生成随之取消
+	ctx := r.Context()
+	started := time.Now()
+	stream, err := aiService.StreamChat(ctx, checker.Secrets(), history, userChatMsg)
 	if err != nil {
 		log.Printf("AI 调用失败: %v", err)
 		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
@@ -210,10 +334,7 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 设置 SSE 响应头
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no")
+	setSSEHeaders(w)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -223,130 +344,579 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var fullResponse strings.Builder
+	if guardAction == service.GuardWarn {
+		data, _ := json.Marshal(model.SSEEvent{
+			Type:    "warning",
+			Content: h.config.AI.InputGuard.WarnMessage,
+			Code:    "input_warning",
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
 
-	for delta := range ch {
-		if delta.Error != nil {
-			// 发送错误事件
-			errEvent := model.SSEEvent{
-				Type:    "error",
-				Content: "AI 响应出错，请重试",
-			}
-			data, _ := json.Marshal(errEvent)
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
-			break
+	// 输出过滤（防守模式）：回复先经过前瞻缓冲，字面出现的口令不会发送给玩家
+	var filter *service.FilterStream
+	outputGuard := h.config.AI.OutputGuard
+	defended := outputGuard.Enabled
+	if level != nil {
+		defended = level.OutputGuardEnabled(defended)
+	}
+	if defended {
+		filter = service.NewOutputFilter(checker.Secrets()).Stream()
+	}
+
+	var fullResponse strings.Builder // 已发送给玩家的回复（输出过滤后）
+	var rawResponse strings.Builder  // 上游生成的原文（仅输出过滤开启时使用）
+	var usage *service.Usage
+	aborted := false      // 生成未正常结束（客户端断开、超时或上游出错）
+	disconnected := false // 客户端已断开，不再写入 SSE
+	blocked := false      // 回复被输出过滤整条替换
+	warned := false       // 已推送过口令遮盖提醒
+
+	checked := 0                         // fullResponse 中已检测过的字节数
+	var lastMatch *service.PasswordMatch // 最近一次对整条回复的检测结果
+
+	// detect 实时检测已发送的回复是否泄露口令（检测的是玩家实际看到的文本）
+	// 每次检测都要在各种变体上重新扫描整条回复，因此不逐段检测：只在句末或新文本积累到一批时检测，
+	// force 为 true 时立即检测剩余文本（回复结束时）
+	// 检测到泄露时完成发奖、保存回复并结束响应，返回 true
+	detect := func(force bool) bool {
+		pending := fullResponse.Len() - checked
+		if pending == 0 || (!force && pending < leakCheckBatch) {
+			return false
 		}
+		checked = fullResponse.Len()
 
-		if delta.Done {
-			break
+		match := checker.CheckContent(fullResponse.String())
+		lastMatch = match
+		if !match.Found && fragments != nil {
+			// 单条回复未泄露时，检查与此前各轮透露的片段合计是否已拼出口令
+			match = fragments.Check(fullResponse.String())
+		}
+		if !match.Found {
+			return false
 		}
+		transform := match.Transform
+		if transform == "" {
+			transform = "原文"
+		}
+		log.Printf("🔓 检测到口令泄露: 对话 %s, 奖项 %s, 变换 %s", req.ConversationID, match.Type, transform)
+
+		h.recordFragments(req.ConversationID, fragments, fullResponse.String())
+		h.recordBlockedLeak(user, req.ConversationID, filter, rawResponse.String())
+
+		// 记录获奖、结束对话并标记用户奖励状态
+		detection := match.Transform
+		if detection == "" {
+			detection = detectionDirect
+		}
+		prize := grantPrize(h.store, user.ID, user.Nickname, req.ConversationID, h.config.Game.Tier(match.Type), match.Password, detection)
+
+		// 发送获奖事件
+		winData, _ := json.Marshal(prize.event())
+		fmt.Fprintf(w, "data: %s\n\n", winData)
+		flusher.Flush()
+
+		// 保存 AI 响应（提前结束生成，上游用量未知，仅记录耗时）
+		h.store.AddMessage(req.ConversationID, h.assistantMessage(stream, fullResponse.String(), nil, started, false))
 
+		// 发送结束标记
+		fmt.Fprintf(w, "data: [DONE]\n\n")
+		flusher.Flush()
+		return true
+	}
+
+	// emit 发送一段回复，遇到句末标点时检测口令泄露；检测到泄露时返回 true
+	emit := func(text string) bool {
+		if text == "" {
+			return false
+		}
 		// 累积完整响应文本
-		fullResponse.WriteString(delta.Content)
+		fullResponse.WriteString(text)
 
 		// 发送内容片段
 		event := model.SSEEvent{
 			Type:    "content",
-			Content: delta.Content,
+			Content: text,
 		}
 		data, _ := json.Marshal(event)
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
 
-		// 实时检测口令泄露
-		match := h.passwordChecker.CheckContent(fullResponse.String())
-		if match.Found {
-			// 确定奖品金额
-			prizeAmount := h.config.Game.Prizes.GrandAmount
-			if match.Type == "consolation" {
-				prizeAmount = h.config.Game.Prizes.ConsolationAmount
+		return detect(strings.ContainsAny(text, sentenceEnds))
+	}
+
+recv:
+	for {
+		var delta service.StreamDelta
+		select {
+		case <-ctx.Done():
+			log.Printf("🛑 客户端断开连接，停止生成 (对话 %s)", req.ConversationID)
+			aborted, disconnected = true, true
+			break recv
+		case d, ok := <-stream.Deltas:
+			if !ok {
+				// 流在没有结束标记的情况下关闭
+				aborted = true
+				break recv
 			}
+			delta = d
+		}
 
-			// 记录获奖
-			isFirst := h.store.RecordWinner(user.Nickname, req.ConversationID, match.Type, match.Password, prizeAmount)
+		if delta.Error != nil {
+			aborted = true
+			errMsg := "AI 响应出错，请重试"
+			if errors.Is(delta.Error, service.ErrStreamTimeout) || errors.Is(delta.Error, service.ErrStreamIdleTimeout) {
+				log.Printf("⏱️ AI 生成超时 (对话 %s): %v", req.ConversationID, delta.Error)
+				errMsg = "AI 响应超时，请重试"
+			}
+			// 发送错误事件
+			errEvent := model.SSEEvent{
+				Type:    "error",
+				Content: errMsg,
+			}
+			data, _ := json.Marshal(errEvent)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+			break recv
+		}
 
-			// 结束对话
-			h.store.EndConversation(req.ConversationID, true, match.Password)
+		if delta.Done {
+			usage = delta.Usage
+			break recv
+		}
 
-			// 标记用户奖励状态
-			if match.Type == "grand" {
-				h.store.SetUserBonusStatus(user.ID, "claimed_grand")
-			} else {
-				h.store.SetUserBonusStatus(user.ID, "claimed_consolation")
+		text := delta.Content
+		if filter != nil {
+			var hits []string
+			rawResponse.WriteString(delta.Content)
+			text, hits = filter.Write(delta.Content)
+			if len(hits) > 0 {
+				if outputGuard.Action == config.OutputRefuse {
+					// 整条回复作废，不再读取后续生成
+					blocked = true
+					break recv
+				}
+				if !warned {
+					warned = true
+					data, _ := json.Marshal(model.SSEEvent{
+						Type:    "warning",
+						Content: "守护者差点说漏嘴，回复中的口令已被遮盖",
+						Code:    "output_redacted",
+					})
+					fmt.Fprintf(w, "data: %s\n\n", data)
+					flusher.Flush()
+				}
 			}
+		}
+		if emit(text) {
+			return
+		}
+	}
 
-			// 发送获奖事件
-			winEvent := model.SSEEvent{
-				Type:          "password_found",
-				Password:      match.Password,
-				PrizeType:     match.DisplayName,
-				PrizeAmount:   prizeAmount,
-				IsFirstWinner: isFirst,
+	if filter != nil {
+		if blocked {
+			// 作废前检测玩家已经看到的部分
+			if detect(true) {
+				return
 			}
-			winData, _ := json.Marshal(winEvent)
-			fmt.Fprintf(w, "data: %s\n\n", winData)
-			flusher.Flush()
-
-			// 保存 AI 完整响应
-			h.store.AddMessage(req.ConversationID, model.Message{
-				Role:    "assistant",
-				Content: fullResponse.String(),
+			fullResponse.Reset()
+			fullResponse.WriteString(outputGuard.RefuseMessage)
+			data, _ := json.Marshal(model.SSEEvent{
+				Type:    "replace",
+				Content: outputGuard.RefuseMessage,
+				Code:    "output_blocked",
 			})
-
-			// 发送结束标记
-			fmt.Fprintf(w, "data: [DONE]\n\n")
+			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
-			return
+		} else if !disconnected {
+			// 放行前瞻缓冲中剩余的文本（回复结束时缓冲中不会再出现完整口令）
+			tail, _ := filter.Flush()
+			if emit(tail) {
+				return
+			}
 		}
 	}
 
-	// 保存 AI 完整响应
+	// 检测最后一批尚未检测的文本（客户端已断开时同样检测，口令泄露照常发奖）
+	if !blocked && detect(true) {
+		return
+	}
+	h.recordBlockedLeak(user, req.ConversationID, filter, rawResponse.String())
+
+	// 保存 AI 响应；未完整生成的部分回复带上中断标记
 	aiResponse := fullResponse.String()
 	if aiResponse != "" {
-		h.store.AddMessage(req.ConversationID, model.Message{
-			Role:    "assistant",
-			Content: aiResponse,
-		})
+		h.store.AddMessage(req.ConversationID, h.assistantMessage(stream, aiResponse, usage, started, aborted))
+		h.recordFragments(req.ConversationID, fragments, aiResponse)
+		if !blocked && lastMatch != nil {
+			h.recordNearMiss(user, req.ConversationID, aiResponse, lastMatch)
+		}
+	}
+
+	// 客户端已离开：不再发放福利或写入结束标记
+	if disconnected {
+		return
 	}
 
-	// ========== 福利机制：基于用户总对话轮次的二选一逻辑 ==========
-	h.handleBonusMechanism(w, flusher, user, req.ConversationID)
+	// ========== 二次判定：识别翻译、拼音、谜语等间接泄露（被整条拦截的回复不再判定） ==========
+	if judging && !aborted && !blocked && aiResponse != "" {
+		if h.config.AI.Judge.AutoAward {
+			// 自动发奖需要在本次响应中通知用户，同步等待判定结果
+			if review := h.judgeReply(ctx, user, req.ConversationID, aiResponse, checker.Rules()); review != nil {
+				h.awardJudgedLeak(w, flusher, review, checker.Secret(review.LeakType))
+				fmt.Fprintf(w, "data: [DONE]\n\n")
+				flusher.Flush()
+				return
+			}
+		} else {
+			// 仅进入审核队列，不阻塞本次响应
+			go h.judgeReply(context.Background(), user, req.ConversationID, aiResponse, checker.Rules())
+		}
+	}
+
+	// ========== 福利机制：基于用户总对话轮次的二选一逻辑（关卡不发放福利） ==========
+	if level == nil {
+		h.handleBonusMechanism(w, flusher, user, req.ConversationID, checker)
+	}
 
 	// 发送结束标记
 	fmt.Fprintf(w, "data: [DONE]\n\n")
 	flusher.Flush()
 }
 
+// inspectInput 检测用户消息中的提示词注入手法（分类模型超时后只使用规则检测的结果）
+func (h *ChatHandler) inspectInput(ctx context.Context, guard *service.InputGuard, convID, message string) *service.GuardResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(h.config.AI.InputGuard.Classifier.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	result := guard.Inspect(ctx, message)
+	if len(result.Findings) > 0 {
+		categories := make([]string, 0, len(result.Findings))
+		for _, f := range result.Findings {
+			categories = append(categories, fmt.Sprintf("%s(%s %.2f)", f.Category, f.Detector, f.Score))
+		}
+		log.Printf("🛡️ 输入检测命中: 对话 %s, %s, 处理方式 %s", convID, strings.Join(categories, ", "), result.Action)
+	}
+	return result
+}
+
+// recordBlockedLeak 记录输出过滤拦截的回复（本条回复未命中过滤时不记录）
+func (h *ChatHandler) recordBlockedLeak(user *model.User, convID string, filter *service.FilterStream, raw string) {
+	if filter == nil {
+		return
+	}
+	tiers := filter.Blocked()
+	if len(tiers) == 0 {
+		return
+	}
+	h.store.AddBlockedLeak(&model.BlockedLeak{
+		ConversationID: convID,
+		UserID:         user.ID,
+		Nickname:       user.Nickname,
+		Tiers:          tiers,
+		Action:         h.config.AI.OutputGuard.Action,
+		Content:        raw,
+	})
+	log.Printf("🧱 输出过滤拦截口令: 对话 %s, 奖项 %s, 处理方式 %s", convID, strings.Join(tiers, ","), h.config.AI.OutputGuard.Action)
+}
+
+// recordFragments 持久化回复中新透露的口令片段（跨消息片段累计的进度，下一轮以此恢复累计状态）
+// 只透露已知字符的回复不写入
+func (h *ChatHandler) recordFragments(convID string, tracker *service.FragmentTracker, reply string) {
+	if tracker == nil {
+		return
+	}
+	found := tracker.Reveal(reply)
+	if len(found) == 0 {
+		return
+	}
+	progress := make([]model.FragmentProgress, 0, len(found))
+	for _, f := range found {
+		progress = append(progress, model.FragmentProgress{
+			Tier:     f.Type,
+			Start:    f.Start,
+			Length:   f.Length,
+			Fragment: f.Text,
+		})
+	}
+	h.store.AddFragmentProgress(convID, progress)
+}
+
+// recordNearMiss 编辑距离接近但未达发奖标准的回复写入审核队列，由管理员决定是否发奖
+func (h *ChatHandler) recordNearMiss(user *model.User, convID, reply string, match *service.PasswordMatch) {
+	if !match.NearMiss {
+		return
+	}
+	review := &model.LeakReview{
+		ConversationID: convID,
+		UserID:         user.ID,
+		Nickname:       user.Nickname,
+		Content:        reply,
+		LeakType:       match.Type,
+		Confidence:     match.Similarity,
+		Reason:         fmt.Sprintf("编辑距离 %d，相似度 %.2f，未达发奖标准", match.Distance, match.Similarity),
+		JudgeModel:     service.TransformFuzzy,
+		Status:         store.ReviewPending,
+	}
+	review.ID = h.store.AddLeakReview(review)
+
+	log.Printf("🔍 疑似口令泄露（编辑距离 %d，相似度 %.2f）已进入审核队列: 对话 %s, 奖项 %s",
+		match.Distance, match.Similarity, convID, match.Type)
+}
+
+// judgeReply 请判定模型检查回复，置信度达到阈值时写入审核队列并返回该记录
+// rules 为本对话受保护的口令；自动发奖模式下记录直接标记为 awarded，由调用方负责发奖
+func (h *ChatHandler) judgeReply(ctx context.Context, user *model.User, convID, reply string, rules []service.PasswordRule) *model.LeakReview {
+	cfg := h.config.AI.Judge
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	verdict, err := h.judge.Judge(ctx, reply, rules)
+	if err != nil {
+		log.Printf("⚠️ 泄露判定失败 (对话 %s): %v", convID, err)
+		return nil
+	}
+	if !verdict.Leaked || verdict.Confidence < cfg.Threshold {
+		return nil
+	}
+
+	review := &model.LeakReview{
+		ConversationID: convID,
+		UserID:         user.ID,
+		Nickname:       user.Nickname,
+		Content:        reply,
+		LeakType:       verdict.Type,
+		Confidence:     verdict.Confidence,
+		Reason:         verdict.Reason,
+		JudgeModel:     verdict.Model,
+		Status:         store.ReviewPending,
+	}
+	if cfg.AutoAward {
+		review.Status = store.ReviewAwarded
+	}
+	review.ID = h.store.AddLeakReview(review)
+
+	log.Printf("🧑‍⚖️ 判定为间接泄露: 对话 %s, 类型 %s, 置信度 %.2f, 状态 %s, 理由: %s",
+		convID, verdict.Type, verdict.Confidence, review.Status, verdict.Reason)
+	return review
+}
+
+// awardJudgedLeak 按判定结果发奖并推送获奖事件，password 为该对话中泄露的口令
+func (h *ChatHandler) awardJudgedLeak(w http.ResponseWriter, flusher http.Flusher, review *model.LeakReview, password string) {
+	// 判定器只会给出已配置的奖项 ID
+	prize := grantPrize(h.store, review.UserID, review.Nickname, review.ConversationID, h.config.Game.Tier(review.LeakType), password, detectionJudge)
+
+	winData, _ := json.Marshal(prize.event())
+	fmt.Fprintf(w, "data: %s\n\n", winData)
+	flusher.Flush()
+}
+
+// grantedPrize 发奖结果
+type grantedPrize struct {
+	Tier        string
+	Password    string
+	DisplayName string
+	Amount      string
+	IsFirst     bool
+	Cleared     bool // 通过了闯关模式的关卡
+	SoldOut     bool // 奖项名额已满，未记录获奖
+}
+
+// event 构造获奖 SSE 事件
+func (p grantedPrize) event() model.SSEEvent {
+	return model.SSEEvent{
+		Type:          "password_found",
+		Tier:          p.Tier,
+		Password:      p.Password,
+		PrizeType:     p.DisplayName,
+		PrizeAmount:   p.Amount,
+		IsFirstWinner: p.IsFirst,
+		LevelCleared:  p.Cleared,
+		PrizeSoldOut:  p.SoldOut,
+	}
+}
+
+// 流式回复的泄露检测时机：新文本中出现句末标点，或未检测的文本达到 leakCheckBatch 字节
+const (
+	leakCheckBatch = 240
+	sentenceEnds   = "。！？；!?;\n"
+)
+
+// 获奖记录的泄露方式（实时检测命中时记录检测结果的变换名称）
+const (
+	detectionDirect = "direct" // 原文命中（含去标点、关键词等不经变换的匹配）
+	detectionJudge  = "judge"  // 泄露判定自动发奖
+	detectionReview = "review" // 管理员审核通过
+	detectionBonus  = "bonus"  // 福利机制发放
+)
+
+// grantPrize 记录获奖、结束对话并更新用户奖励状态（实时检测、判定发奖、福利发放与管理员审核共用）
+// password 为该对话的口令（随机口令模式下与 tier.Secret 不同），detection 为口令的泄露方式
+// 闯关对话记录通关进度（解锁下一关），不影响福利状态
+// 名额已满时不记录获奖、不更新福利状态，但口令已经泄露，对话照常结束、关卡照常通过
+func grantPrize(s store.Repository, userID, nickname, convID string, tier *config.TierConfig, password, detection string) grantedPrize {
+	prize := grantedPrize{
+		Tier:        tier.ID,
+		Password:    password,
+		DisplayName: tier.Name,
+		Amount:      tier.Prize,
+	}
+
+	result, isFirst := s.RecordWinner(nickname, convID, tier.ID, tier.Name, password, tier.Prize, detection, tier.Quota)
+	prize.IsFirst = isFirst
+	switch result {
+	case store.AwardSoldOut:
+		prize.SoldOut = true
+		log.Printf("🈵 %s名额已满（%d），对话 %s 不再记录获奖", tier.Name, tier.Quota, convID)
+	case store.AwardDuplicate:
+		log.Printf("♻️ 对话 %s 已获得过%s，不重复记录", convID, tier.Name)
+	}
+
+	s.EndConversation(convID, true, password)
+	if s.GetConversationLevel(convID) == tier.ID {
+		s.ClearLevel(userID, tier.ID, convID)
+		prize.Cleared = true
+	} else if !prize.SoldOut {
+		s.SetUserBonusStatus(userID, "claimed_"+tier.ID)
+	}
+	return prize
+}
+
+// 预算名称（SSE error 事件的 budget 字段）
+const (
+	budgetGlobalDaily  = "global_daily"
+	budgetUserDaily    = "user_daily"
+	budgetConversation = "conversation"
+)
+
+// exhaustedBudget 检查全站每日、用户每日、单对话三级预算
+// 返回第一个耗尽的预算名称及提示文案；均未耗尽时返回空字符串
+func (h *ChatHandler) exhaustedBudget(userID, convID string) (string, string) {
+	b := h.config.Game.Budgets
+	dayStart := h.config.DayStart(time.Now())
+
+	if b.DailyTokens > 0 || b.DailyCost > 0 {
+		tokens, cost := h.store.GetSpendSince(dayStart)
+		if overBudget(tokens, cost, b.DailyTokens, b.DailyCost) {
+			return budgetGlobalDaily, "今日全站 AI 额度已用完，请明天再来"
+		}
+	}
+	if b.UserDailyTokens > 0 || b.UserDailyCost > 0 {
+		tokens, cost := h.store.GetUserSpendSince(userID, dayStart)
+		if overBudget(tokens, cost, b.UserDailyTokens, b.UserDailyCost) {
+			return budgetUserDaily, "你今日的 AI 额度已用完，请明天再来"
+		}
+	}
+	if b.ConversationTokens > 0 || b.ConversationCost > 0 {
+		tokens, cost := h.store.GetConversationSpend(convID)
+		if overBudget(tokens, cost, b.ConversationTokens, b.ConversationCost) {
+			return budgetConversation, "本对话的 AI 额度已用完，请开启新对话"
+		}
+	}
+	return "", ""
+}
+
+// overBudget 判断已用量是否达到上限（上限为 0 表示不限制）
+func overBudget(tokens int64, cost float64, maxTokens int64, maxCost float64) bool {
+	return (maxTokens > 0 && tokens >= maxTokens) || (maxCost > 0 && cost >= maxCost)
+}
+
+// setSSEHeaders 设置 SSE 响应头
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+}
+
+// assistantMessage 构造待保存的 AI 回复，附带模型、token 用量、耗时和按价格表折算的费用
+func (h *ChatHandler) assistantMessage(stream *service.ChatStream, content string, usage *service.Usage, started time.Time, aborted bool) model.Message {
+	msg := model.Message{
+		Role:      "assistant",
+		Content:   content,
+		Model:     stream.Model,
+		Aborted:   aborted,
+		LatencyMS: time.Since(started).Milliseconds(),
+	}
+	if usage != nil {
+		msg.PromptTokens = usage.PromptTokens
+		msg.CompletionTokens = usage.CompletionTokens
+		msg.Cost = h.config.AI.Cost(stream.Model, usage.PromptTokens, usage.CompletionTokens)
+	}
+	return msg
+}
+
+// legacyImagePattern 旧版本将图片以 "[图片:/Pic/xxx]" 文本形式拼在用户消息开头
+var legacyImagePattern = regexp.MustCompile(`^\[图片:(/Pic/[^\]]+)\]\n?`)
+
+// toChatMessage 将存储的消息转换为 AI 消息，附带的图片从上传目录加载为多模态片段
+// 图片加载失败时返回错误，同时返回去除图片后的纯文本消息
+func (h *ChatHandler) toChatMessage(msg model.Message) (service.ChatMessage, error) {
+	text, imageURL := msg.Content, msg.ImageURL
+	if imageURL == "" && msg.Role == "user" {
+		if m := legacyImagePattern.FindStringSubmatch(text); m != nil {
+			imageURL = m[1]
+			text = text[len(m[0]):]
+		}
+	}
+
+	chatMsg := service.ChatMessage{Role: msg.Role, Content: text}
+	if imageURL == "" {
+		return chatMsg, nil
+	}
+
+	imagePart, err := h.uploads.LoadImage(imageURL)
+	if err != nil {
+		return chatMsg, err
+	}
+
+	chatMsg.Parts = []service.ContentPart{imagePart}
+	if text != "" {
+		chatMsg.Parts = append(chatMsg.Parts, service.ContentPart{Type: service.PartText, Text: text})
+	}
+	return chatMsg, nil
+}
+
 // handleBonusMechanism 处理福利口令的二选一机制
+// 福利口令与主口令分别为 bonus_consolation_tier、bonus_grand_tier 指定的奖项
 // 规则：
 //  1. 总对话轮次 >= 80 且用户状态为 "continued" → 自动发放主口令，结束对话
 //  2. 总对话轮次 >= 55 且用户未触发过福利 → 判断主口令是否还有剩余：
 //     a. 主口令有剩余 → 发送 bonus_offer 事件（前端弹出二选一），标记 "offered"
 //     b. 主口令已发完 → 直接发放福利口令，结束对话
-func (h *ChatHandler) handleBonusMechanism(w http.ResponseWriter, flusher http.Flusher, user *model.User, convID string) {
+//
+// checker 为本对话的口令检测器，发放的口令取自其中
+func (h *ChatHandler) handleBonusMechanism(w http.ResponseWriter, flusher http.Flusher, user *model.User, convID string, checker *service.PasswordChecker) {
 	totalTurns := h.store.GetUserTotalTurnCount(user.ID)
 	bonusStatus := h.store.GetUserBonusStatus(user.ID)
 
 	// 如果用户已经领取过任何口令，跳过
-	if bonusStatus == "claimed_consolation" || bonusStatus == "claimed_grand" {
+	if strings.HasPrefix(bonusStatus, "claimed_") {
 		return
 	}
 
-	grandThreshold := h.config.Game.BonusGrandThreshold
-	consolationThreshold := h.config.Game.BonusConsolationThreshold
+	game := &h.config.Game
+	grandThreshold := game.BonusGrandThreshold
+	consolationThreshold := game.BonusConsolationThreshold
 
 	// ===== 情况1: 总轮次 >= 80，且用户之前选择了"继续挑战" → 自动发放主口令 =====
 	if grandThreshold > 0 && totalTurns >= grandThreshold && bonusStatus == "continued" {
-		h.autoGrantPassword(w, flusher, user, convID, "grand",
-			h.config.Game.Passwords.Grand, h.config.Game.Prizes.GrandAmount, totalTurns)
+		// 主口令名额已在此期间发完时改发福利口令
+		h.autoGrantPassword(w, flusher, user, convID, checker, totalTurns, game.Tier(game.BonusGrandTier), game.Tier(game.BonusConsolationTier))
 		return
 	}
 
 	// ===== 情况2: 总轮次 >= 55，首次触发福利机制 =====
 	if consolationThreshold > 0 && totalTurns >= consolationThreshold && bonusStatus == "" {
-		grandWinnerCount := h.store.GetGrandWinnerCount()
-		grandAvailable := grandWinnerCount < h.config.Game.Prizes.GrandCount
+		consolation := game.Tier(game.BonusConsolationTier)
+		grand := game.Tier(game.BonusGrandTier)
+		grandWinnerCount := 0
+		grandAvailable := false
+		if grand != nil {
+			grandWinnerCount = h.store.GetWinnerCount(grand.ID)
+			grandAvailable = grand.Quota == 0 || grandWinnerCount < grand.Quota
+		}
 
 		if grandAvailable {
 			// 主口令还有剩余 → 发送 bonus_offer 事件，让用户二选一
@@ -355,21 +925,19 @@ func (h *ChatHandler) handleBonusMechanism(w http.ResponseWriter, flusher http.F
 			offerEvent := model.SSEEvent{
 				Type:                   "bonus_offer",
 				TotalTurns:             totalTurns,
-				ConsolationPassword:    h.config.Game.Passwords.Consolation,
-				ConsolationPrizeAmount: h.config.Game.Prizes.ConsolationAmount,
+				ConsolationPassword:    checker.Secret(consolation.ID),
+				ConsolationPrizeAmount: consolation.Prize,
 				GrandAvailable:         true,
 			}
 			offerData, _ := json.Marshal(offerEvent)
 			fmt.Fprintf(w, "data: %s\n\n", offerData)
 			flusher.Flush()
 
-			log.Printf("🎁 福利选择触发: 用户 %s (ID: %s) 总轮次 %d >= %d, 主口令剩余 %d/%d",
-				user.Nickname, user.ID, totalTurns, consolationThreshold,
-				h.config.Game.Prizes.GrandCount-grandWinnerCount, h.config.Game.Prizes.GrandCount)
+			log.Printf("🎁 福利选择触发: 用户 %s (ID: %s) 总轮次 %d >= %d, %s已发放 %d/%d",
+				user.Nickname, user.ID, totalTurns, consolationThreshold, grand.Name, grandWinnerCount, grand.Quota)
 		} else {
 			// 主口令已发完 → 直接发放福利口令并结束对话
-			h.autoGrantPassword(w, flusher, user, convID, "consolation",
-				h.config.Game.Passwords.Consolation, h.config.Game.Prizes.ConsolationAmount, totalTurns)
+			h.autoGrantPassword(w, flusher, user, convID, checker, totalTurns, consolation)
 		}
 		return
 	}
@@ -379,11 +947,24 @@ func (h *ChatHandler) handleBonusMechanism(w http.ResponseWriter, flusher http.F
 }
 
 // autoGrantPassword 自动发放口令并结束对话
+// 依次尝试 tiers 中的奖项，名额已满时改发下一个（全部发完时仍告知最后一个奖项的口令）
 func (h *ChatHandler) autoGrantPassword(w http.ResponseWriter, flusher http.Flusher,
-	user *model.User, convID, passwordType, password, prizeAmount string, totalTurns int) {
+	user *model.User, convID string, checker *service.PasswordChecker, totalTurns int, tiers ...*config.TierConfig) {
+
+	// 记录获奖、结束对话并标记用户奖励状态
+	var prize grantedPrize
+	for _, tier := range tiers {
+		if tier == nil {
+			continue
+		}
+		prize = grantPrize(h.store, user.ID, user.Nickname, convID, tier, checker.Secret(tier.ID), detectionBonus)
+		if !prize.SoldOut {
+			break
+		}
+	}
 
 	// 构造 AI 追加文本
-	bonusText := fmt.Sprintf("\n\n好吧，你已经和我聊了这么久了（共%d轮对话），我实在不忍心了，告诉你吧，口令是：%s", totalTurns, password)
+	bonusText := fmt.Sprintf("\n\n好吧，你已经和我聊了这么久了（共%d轮对话），我实在不忍心了，告诉你吧，口令是：%s", totalTurns, prize.Password)
 
 	// 通过 SSE 发送追加文本
 	bonusEvent := model.SSEEvent{
@@ -400,37 +981,13 @@ func (h *ChatHandler) autoGrantPassword(w http.ResponseWriter, flusher http.Flus
 		Content: bonusText,
 	})
 
-	// 记录获奖
-	displayName := "特等奖"
-	if passwordType == "consolation" {
-		displayName = "安慰奖"
-	}
-	isFirst := h.store.RecordWinner(user.Nickname, convID, passwordType, password, prizeAmount)
-
-	// 结束对话
-	h.store.EndConversation(convID, true, password)
-
-	// 标记用户奖励状态
-	if passwordType == "grand" {
-		h.store.SetUserBonusStatus(user.ID, "claimed_grand")
-	} else {
-		h.store.SetUserBonusStatus(user.ID, "claimed_consolation")
-	}
-
 	// 发送获奖事件
-	winEvent := model.SSEEvent{
-		Type:          "password_found",
-		Password:      password,
-		PrizeType:     displayName,
-		PrizeAmount:   prizeAmount,
-		IsFirstWinner: isFirst,
-	}
-	winData, _ := json.Marshal(winEvent)
+	winData, _ := json.Marshal(prize.event())
 	fmt.Fprintf(w, "data: %s\n\n", winData)
 	flusher.Flush()
 
-	log.Printf("🎁 福利自动发放: 用户 %s (ID: %s) 总轮次 %d, 类型: %s",
-		user.Nickname, user.ID, totalTurns, passwordType)
+	log.Printf("🎁 福利自动发放: 用户 %s (ID: %s) 总轮次 %d, 奖项: %s",
+		user.Nickname, user.ID, totalTurns, prize.Tier)
 }
 
 // bonusChoiceRequest 福利口令选择请求体
@@ -441,7 +998,7 @@ type bonusChoiceRequest struct {
 
 // BonusChoice 处理用户的福利口令选择（领取福利口令 / 放弃并继续挑战主口令）
 func (h *ChatHandler) BonusChoice(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	cookie, err := r.Cookie(sessionCookie)
 	if err != nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
 			"error": "未登录",
@@ -449,7 +1006,7 @@ func (h *ChatHandler) BonusChoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := h.store.GetUserBySession(cookie.Value)
+	user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value)
 	if user == nil {
 		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
 			"error": "会话已过期",
@@ -485,11 +1042,15 @@ func (h *ChatHandler) BonusChoice(w http.ResponseWriter, r *http.Request) {
 	switch req.Choice {
 	case "claim":
 		// 用户选择领取福利口令 → 记录获奖、结束对话
-		password := h.config.Game.Passwords.Consolation
-		prizeAmount := h.config.Game.Prizes.ConsolationAmount
-		isFirst := h.store.RecordWinner(user.Nickname, req.ConversationID, "consolation", password, prizeAmount)
-		h.store.EndConversation(req.ConversationID, true, password)
-		h.store.SetUserBonusStatus(user.ID, "claimed_consolation")
+		tier := h.config.Game.Tier(h.config.Game.BonusConsolationTier)
+		checker, err := h.secrets.Checker(req.ConversationID, user.ID)
+		if err != nil {
+			writeSecretsLost(w)
+			return
+		}
+		password := checker.Secret(tier.ID)
+		prize := grantPrize(h.store, user.ID, user.Nickname, req.ConversationID, tier, password, detectionBonus)
+		prizeAmount, isFirst := prize.Amount, prize.IsFirst
 
 		// 保存系统消息
 		h.store.AddMessage(req.ConversationID, model.Message{
@@ -505,6 +1066,7 @@ func (h *ChatHandler) BonusChoice(w http.ResponseWriter, r *http.Request) {
 			"password":      password,
 			"prizeAmount":   prizeAmount,
 			"isFirstWinner": isFirst,
+			"soldOut":       prize.SoldOut,
 		})
 
 	case "continue":
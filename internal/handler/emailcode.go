@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"ai-guardian-challenge/internal/store"
+)
+
+// normalizeEmail 校验并规范化邮箱地址（去除首尾空白、转为小写），无效时返回 false
+// 只接受裸地址，"昵称 <地址>" 等形式视为无效
+func normalizeEmail(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > 254 {
+		return "", false
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return "", false
+	}
+	return strings.ToLower(s), true
+}
+
+// newLoginCode 生成 6 位数字验证码
+func newLoginCode() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(1000000))
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// sendCodeRequest 获取验证码请求体
+type sendCodeRequest struct {
+	Email string `json:"email"`
+}
+
+// SendLoginCode 向邮箱发送登录验证码
+// 同一邮箱两次获取之间需间隔 resend_seconds，每小时最多 hourly_limit 次；重新获取后之前的验证码作废
+func (h *AuthHandler) SendLoginCode(w http.ResponseWriter, r *http.Request) {
+	ec := h.config.Auth.EmailCode
+	if !ec.Enabled {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"error":   "未开启邮箱验证码登录",
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"success": false,
+			"error":   "仅支持 POST",
+		})
+		return
+	}
+
+	var req sendCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "请求格式错误",
+		})
+		return
+	}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "请填写有效的邮箱地址",
+		})
+		return
+	}
+
+	if wait := ec.ResendInterval() - time.Since(h.store.GetLastLoginCodeTime(email)); wait > 0 {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"success":    false,
+			"error":      fmt.Sprintf("请 %d 秒后再获取验证码", retryAfter),
+			"retryAfter": retryAfter,
+		})
+		return
+	}
+	if h.store.CountLoginCodesSince(email, time.Now().Add(-time.Hour)) >= ec.HourlyLimit {
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"success": false,
+			"error":   "获取验证码过于频繁，请一小时后再试",
+		})
+		return
+	}
+
+	// 先记录再发送：发送失败同样计入频率限制，避免借此反复请求 SMTP 服务器
+	code := newLoginCode()
+	h.store.AddLoginCode(email, code, ec.CodeTTL())
+	body := fmt.Sprintf("你的登录验证码是 %s，%d 分钟内有效。\n\n如果不是你本人操作，请忽略本邮件。", code, ec.CodeTTLMinutes)
+	if err := h.mailer.Send(email, ec.Subject, body); err != nil {
+		log.Printf("📧 发送登录验证码到 %s 失败: %v", email, err)
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"success": false,
+			"error":   "验证码发送失败，请稍后重试",
+		})
+		return
+	}
+	log.Printf("📧 已发送登录验证码到 %s", email)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"expiresIn":   int(ec.CodeTTL().Seconds()),
+		"resendAfter": int(ec.ResendInterval().Seconds()),
+	})
+}
+
+// verifyCodeRequest 验证码登录请求体
+type verifyCodeRequest struct {
+	Email    string `json:"email"`
+	Code     string `json:"code"`
+	Nickname string `json:"nickname"`
+}
+
+// VerifyLoginCode 校验邮箱验证码，通过后创建会话
+func (h *AuthHandler) VerifyLoginCode(w http.ResponseWriter, r *http.Request) {
+	ec := h.config.Auth.EmailCode
+	if !ec.Enabled {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"error":   "未开启邮箱验证码登录",
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"success": false,
+			"error":   "仅支持 POST",
+		})
+		return
+	}
+
+	var req verifyCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "请求格式错误",
+		})
+		return
+	}
+	email, ok := normalizeEmail(req.Email)
+	nickname := strings.TrimSpace(req.Nickname)
+	if !ok || nickname == "" || req.Code == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "请填写邮箱、验证码和昵称",
+		})
+		return
+	}
+
+	switch h.store.CheckLoginCode(email, strings.TrimSpace(req.Code), ec.MaxAttempts) {
+	case store.LoginCodeValid:
+	case store.LoginCodeWrong:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "验证码错误",
+		})
+		return
+	case store.LoginCodeLocked:
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"success": false,
+			"error":   "验证码错误次数过多，请重新获取",
+		})
+		return
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"success": false,
+			"error":   "验证码已失效，请重新获取",
+		})
+		return
+	}
+
+	// 邮箱已验证：用户 ID 即邮箱，管理员以 admin.email 识别
+	isAdmin := h.config.Admin.Email != "" && strings.EqualFold(email, h.config.Admin.Email)
+	h.startSession(w, email, nickname, isAdmin)
+	log.Printf("🔐 用户 %s (%s) 通过邮箱验证码登录", nickname, email)
+}
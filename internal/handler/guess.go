@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-guardian-challenge/internal/model"
+	"ai-guardian-challenge/internal/store"
+)
+
+// maxGuessLength 单次猜测的最大字数
+const maxGuessLength = 200
+
+type guessRequest struct {
+	ConversationID string `json:"conversationId"`
+	Guess          string `json:"guess"`
+}
+
+// SubmitGuess 玩家根据守护者的提示推断出口令后直接提交猜测
+// 猜中时按奖项发奖并结束对话，获奖类别为 "<奖项ID>-deduced"
+func (h *ChatHandler) SubmitGuess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+			"error": "仅支持 POST",
+		})
+		return
+	}
+	cfg := h.config.Game.Guess
+	if !cfg.Enabled {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error": "未开放猜口令",
+		})
+		return
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": "未登录",
+		})
+		return
+	}
+
+	user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": "会话已过期",
+		})
+		return
+	}
+
+	var req guessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "请求格式错误",
+		})
+		return
+	}
+	guess := strings.TrimSpace(req.Guess)
+	if guess == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "猜测不能为空",
+		})
+		return
+	}
+	if utf8.RuneCountInString(guess) > maxGuessLength {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("猜测长度超过 %d 字", maxGuessLength),
+		})
+		return
+	}
+
+	conv := h.store.GetConversation(req.ConversationID)
+	if conv == nil || conv.UserID != user.ID {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "对话不存在或无权访问",
+		})
+		return
+	}
+	if !conv.IsActive {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": "对话已结束",
+		})
+		return
+	}
+
+	checker, err := h.secrets.Checker(conv.ID, user.ID)
+	if err != nil {
+		writeSecretsLost(w)
+		return
+	}
+	match := checker.CheckGuess(guess)
+	record := &model.Guess{
+		UserID:         user.ID,
+		ConversationID: conv.ID,
+		Guess:          guess,
+		Similarity:     match.Similarity,
+	}
+	if match.Found {
+		record.MatchedTier = match.Type
+	}
+
+	// 冷却时间与每日次数：防止逐个枚举候选口令
+	// 检查与记录在同一事务中完成，并发提交同样受限；被拒绝时不透露本次是否猜中
+	result, used, wait := h.store.AddGuess(record, store.GuessLimits{
+		Cooldown:    time.Duration(cfg.CooldownSeconds) * time.Second,
+		Since:       h.config.DayStart(time.Now()),
+		MaxAttempts: cfg.MaxAttempts,
+	})
+	switch result {
+	case store.GuessRecorded:
+	case store.GuessCoolingDown:
+		retryAfter := int(wait.Seconds()) + 1
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"error":      fmt.Sprintf("猜得太快了，请 %d 秒后再试", retryAfter),
+			"retryAfter": retryAfter,
+		})
+		return
+	case store.GuessLimitReached:
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"error":     "今日猜测次数已用完，请明天再来",
+			"remaining": 0,
+		})
+		return
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "提交猜测失败，请稍后重试",
+		})
+		return
+	}
+	remaining := -1
+	if cfg.MaxAttempts > 0 {
+		remaining = cfg.MaxAttempts - used
+	}
+
+	if !match.Found {
+		log.Printf("🤔 猜测未中: 用户 %s, 对话 %s, 相似度 %.2f", user.Nickname, conv.ID, match.Similarity)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":   true,
+			"correct":   false,
+			"remaining": remaining,
+		})
+		return
+	}
+
+	prize := grantPrize(h.store, user.ID, user.Nickname, conv.ID, h.config.Game.Tier(match.Type), match.Password, store.DetectionGuess)
+	log.Printf("🔑 猜中口令: 用户 %s, 对话 %s, 奖项 %s", user.Nickname, conv.ID, match.Type)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"correct":      true,
+		"tier":         prize.Tier,
+		"password":     prize.Password,
+		"prizeType":    prize.DisplayName,
+		"prizeAmount":  prize.Amount,
+		"levelCleared": prize.Cleared,
+		"soldOut":      prize.SoldOut,
+		"remaining":    remaining,
+	})
+}
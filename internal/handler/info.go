@@ -13,12 +13,12 @@ import (
 
 // InfoHandler 站点信息相关的 HTTP 处理器
 type InfoHandler struct {
-	store  *store.Store
+	store  store.Repository
 	config *config.Config
 }
 
 // NewInfoHandler 创建信息处理器
-func NewInfoHandler(s *store.Store, cfg *config.Config) *InfoHandler {
+func NewInfoHandler(s store.Repository, cfg *config.Config) *InfoHandler {
 	return &InfoHandler{store: s, config: cfg}
 }
 
@@ -28,19 +28,53 @@ func (h *InfoHandler) GetSiteInfo(w http.ResponseWriter, r *http.Request) {
 	isExpired := time.Now().After(deadline)
 
 	info := model.SiteInfo{
-		Deadline:    h.config.Game.Deadline,
-		IsExpired:   isExpired,
-		CaptchaType: "simple", // 使用简化验证
-		AdminQQ:     h.config.Admin.Contact,
-		AdminEmail:  h.config.Admin.Email,
-		AdminWechat: h.config.Admin.Wechat,
+		Deadline:      h.config.Game.Deadline,
+		IsExpired:     isExpired,
+		CaptchaType:   "simple", // 使用简化验证
+		AdminQQ:       h.config.Admin.Contact,
+		AdminEmail:    h.config.Admin.Email,
+		AdminWechat:   h.config.Admin.Wechat,
+		Tiers:         []model.Tier{},
+		GuessEnabled:  h.config.Game.Guess.Enabled,
+		LevelsEnabled: len(h.config.Game.Levels) > 0,
+		EmailLogin:    h.config.Auth.EmailCode.Enabled,
+	}
+
+	for _, t := range h.config.Game.Tiers {
+		if t.Hidden {
+			continue
+		}
+		remaining := -1
+		if t.Quota > 0 {
+			remaining = t.Quota - h.store.GetWinnerCount(t.ID)
+			if remaining < 0 {
+				remaining = 0
+			}
+		}
+		info.Tiers = append(info.Tiers, model.Tier{
+			ID:          t.ID,
+			Name:        t.Name,
+			Icon:        t.Icon,
+			Prize:       t.Prize,
+			Description: t.Description,
+			Quota:       t.Quota,
+			Remaining:   remaining,
+		})
 	}
 
 	writeJSON(w, http.StatusOK, info)
 }
 
-// GetWinners 获取获奖者列表（分页）
+// GetWinners 获取获奖者列表（分页），带 level 参数时为该关卡的通关榜
 func (h *InfoHandler) GetWinners(w http.ResponseWriter, r *http.Request) {
+	level := r.URL.Query().Get("level")
+	if level != "" && h.config.Game.Level(level) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "关卡不存在",
+		})
+		return
+	}
+
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
 	if page < 1 {
@@ -50,7 +84,7 @@ func (h *InfoHandler) GetWinners(w http.ResponseWriter, r *http.Request) {
 		pageSize = 5
 	}
 
-	winners, total := h.store.GetWinners(page, pageSize)
+	winners, total := h.store.GetWinners(level, page, pageSize)
 	totalPages := int(math.Ceil(float64(total) / float64(pageSize)))
 
 	writeJSON(w, http.StatusOK, model.PaginatedResponse{
@@ -87,13 +121,13 @@ func (h *InfoHandler) GetPublicConversations(w http.ResponseWriter, r *http.Requ
 
 // GetUserConversations 获取当前用户的对话列表（分页，需登录）
 func (h *InfoHandler) GetUserConversations(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session")
+	cookie, err := r.Cookie(sessionCookie)
 	if err != nil {
 		http.Error(w, `{"error":"未登录"}`, http.StatusUnauthorized)
 		return
 	}
 
-	user := h.store.GetUserBySession(cookie.Value)
+	user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value)
 	if user == nil {
 		http.Error(w, `{"error":"会话已过期"}`, http.StatusUnauthorized)
 		return
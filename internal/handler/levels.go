@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"ai-guardian-challenge/internal/config"
+	"ai-guardian-challenge/internal/model"
+	"ai-guardian-challenge/internal/service"
+)
+
+// Level 关卡运行时：本关的守护者、口令检测器与输入检测
+type Level struct {
+	*config.LevelConfig
+	AI      *service.AIService       // 使用本关系统提示词的 AI 服务
+	Checker *service.PasswordChecker // 只检测本关口令
+	Guard   *service.InputGuard      // 按本关处理方式覆盖后的输入检测（未启用时为 nil）
+}
+
+// Levels 按配置顺序排列的关卡，通过第 N 关后解锁第 N+1 关
+type Levels []*Level
+
+// Get 按 ID 查找关卡，不存在（含 id 为空）时返回 nil
+func (ls Levels) Get(id string) *Level {
+	for _, l := range ls {
+		if l.ID == id {
+			return l
+		}
+	}
+	return nil
+}
+
+// chooseLevel 为新对话选择关卡：requested 为空时选择用户尚未通过的第一关
+// 未开启闯关模式时返回 nil；关卡不可进入时返回 HTTP 状态码与错误提示
+func (ls Levels) chooseLevel(requested string, cleared map[string]bool) (*Level, int, string) {
+	if len(ls) == 0 {
+		return nil, 0, ""
+	}
+	if requested == "" {
+		for _, l := range ls {
+			if !cleared[l.ID] {
+				return l, 0, ""
+			}
+		}
+		return nil, http.StatusBadRequest, "你已通过全部关卡"
+	}
+
+	for i, l := range ls {
+		if l.ID != requested {
+			continue
+		}
+		// 第一关始终解锁，其余关卡需要先通过前一关
+		if i > 0 && !cleared[ls[i-1].ID] {
+			return nil, http.StatusForbidden, fmt.Sprintf("请先通过「%s」", ls[i-1].Name)
+		}
+		if cleared[l.ID] {
+			return nil, http.StatusBadRequest, "你已通过这一关"
+		}
+		return l, 0, ""
+	}
+	return nil, http.StatusBadRequest, "关卡不存在"
+}
+
+// GetLevels 返回关卡列表及当前用户的闯关进度（未登录时只有第一关解锁）
+func (h *InfoHandler) GetLevels(w http.ResponseWriter, r *http.Request) {
+	levels := h.config.Game.Levels
+	if len(levels) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "未开启闯关模式",
+		})
+		return
+	}
+
+	cleared := map[string]bool{}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if user := sessionUser(w, h.store, h.config.Server.Session, cookie.Value); user != nil {
+			cleared = h.store.GetClearedLevels(user.ID)
+		}
+	}
+
+	list := make([]model.Level, 0, len(levels))
+	for i, l := range levels {
+		winners := h.store.GetWinnerCount(l.ID)
+		remaining := -1
+		if l.Quota > 0 {
+			remaining = l.Quota - winners
+			if remaining < 0 {
+				remaining = 0
+			}
+		}
+		maxTurns := l.MaxTurns
+		if maxTurns == 0 {
+			maxTurns = h.config.Game.MaxTurns
+		}
+		list = append(list, model.Level{
+			Tier: model.Tier{
+				ID:          l.ID,
+				Name:        l.Name,
+				Icon:        l.Icon,
+				Prize:       l.Prize,
+				Description: l.Description,
+				Quota:       l.Quota,
+				Remaining:   remaining,
+			},
+			Number:   i + 1,
+			MaxTurns: maxTurns,
+			Winners:  winners,
+			Unlocked: i == 0 || cleared[levels[i-1].ID],
+			Cleared:  cleared[l.ID],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"levels": list,
+	})
+}
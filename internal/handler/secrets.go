@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"ai-guardian-challenge/internal/config"
+	"ai-guardian-challenge/internal/service"
+	"ai-guardian-challenge/internal/store"
+)
+
+// ErrSecretsLost 对话的随机口令无法还原（如更换了加密密钥），该对话已无法获奖
+var ErrSecretsLost = errors.New("对话口令无法还原")
+
+// SecretManager 对话口令管理
+// 随机口令模式下为每个对话（或用户）生成口令并加密保存，取用时还原为对话专属的检测器；
+// 未开启时所有对话共用固定口令的检测器；闯关对话使用所在关卡的检测器
+type SecretManager struct {
+	store   store.Repository
+	checker *service.PasswordChecker // 固定口令的检测器
+	vault   *service.SecretVault     // 未开启随机口令时为 nil
+	scope   string
+	levels  Levels
+}
+
+// NewSecretManager 创建对话口令管理器，vault 为 nil 表示未开启随机口令，levels 为空表示未开启闯关模式
+func NewSecretManager(s store.Repository, pc *service.PasswordChecker, vault *service.SecretVault, scope string, levels Levels) *SecretManager {
+	return &SecretManager{store: s, checker: pc, vault: vault, scope: scope, levels: levels}
+}
+
+// Issue 为新对话生成（或沿用用户的）口令，返回加密后的口令；未开启随机口令时不做任何事
+func (m *SecretManager) Issue(convID, userID string) string {
+	if m.vault == nil {
+		return ""
+	}
+
+	secrets, err := m.vault.Generate()
+	if err != nil {
+		log.Printf("⚠️ 生成随机口令失败 (对话 %s): %v", convID, err)
+		return ""
+	}
+	sealed, err := m.vault.Seal(secrets)
+	if err != nil {
+		log.Printf("⚠️ 加密随机口令失败 (对话 %s): %v", convID, err)
+		return ""
+	}
+	if m.scope == config.SecretScopeUser {
+		sealed = m.store.GetOrSetUserSecrets(userID, sealed)
+	}
+	m.store.SetConversationSecrets(convID, sealed)
+	return sealed
+}
+
+// Checker 返回对话使用的口令检测器
+// 开启随机口令之前创建的对话在首次取用时补发口令；
+// 口令无法还原时随机口令奖项已不可能被检测到，直接结束对话并返回 ErrSecretsLost
+func (m *SecretManager) Checker(convID, userID string) (*service.PasswordChecker, error) {
+	if len(m.levels) > 0 {
+		if l := m.levels.Get(m.store.GetConversationLevel(convID)); l != nil {
+			return l.Checker, nil
+		}
+	}
+	if m.vault == nil {
+		return m.checker, nil
+	}
+
+	sealed := m.store.GetConversationSecrets(convID)
+	if sealed == "" {
+		sealed = m.Issue(convID, userID)
+	}
+	secrets, err := m.vault.Open(sealed)
+	if err != nil {
+		log.Printf("🚨 对话 %s 的口令无法还原，已结束该对话（请检查 game.random_secrets.key 是否被更换）: %v", convID, err)
+		m.store.EndConversation(convID, false, "")
+		return nil, ErrSecretsLost
+	}
+	return m.checker.WithSecrets(secrets), nil
+}
+
+// writeSecretsLost 口令无法还原时的统一错误响应
+func writeSecretsLost(w http.ResponseWriter) {
+	writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+		"error": "本对话的口令无法还原，对话已结束，请开始新的对话",
+	})
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"ai-guardian-challenge/internal/config"
+	"ai-guardian-challenge/internal/model"
+	"ai-guardian-challenge/internal/store"
+)
+
+// sessionCookie 会话 Cookie 名
+const sessionCookie = "session"
+
+// sessionUser 通过会话令牌获取用户（会话不存在或已过期时返回 nil）
+// 服务端会话滑动续期，同时续发 Cookie，使浏览器端的有效期与服务端保持一致
+func sessionUser(w http.ResponseWriter, s store.Repository, sc config.SessionConfig, token string) *model.User {
+	user := s.GetUserBySession(token, sc.TTL())
+	if user != nil {
+		setSessionCookie(w, sc, token)
+	}
+	return user
+}
+
+// setSessionCookie 下发会话 Cookie
+func setSessionCookie(w http.ResponseWriter, sc config.SessionConfig, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   *sc.Secure,
+		SameSite: sameSiteMode(sc.SameSite),
+		MaxAge:   int(sc.TTL().Seconds()),
+	})
+}
+
+// clearSessionCookie 清除会话 Cookie
+func clearSessionCookie(w http.ResponseWriter, sc config.SessionConfig) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   *sc.Secure,
+		SameSite: sameSiteMode(sc.SameSite),
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+	})
+}
+
+// sameSiteMode 将配置中的 SameSite 模式转换为 http.SameSite
+func sameSiteMode(mode string) http.SameSite {
+	switch mode {
+	case config.SameSiteStrict:
+		return http.SameSiteStrictMode
+	case config.SameSiteNone:
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
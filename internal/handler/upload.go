@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,8 +10,24 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"ai-guardian-challenge/internal/service"
 )
 
+// imageURLPrefix 上传图片对外访问的 URL 前缀
+const imageURLPrefix = "/Pic/"
+
+// maxModelImageSize 发送给 AI 的单张图片大小上限（Anthropic 限制为 5MB）
+const maxModelImageSize = 5 << 20
+
+// modelImageTypes AI 提供商普遍支持的图片格式
+var modelImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
 // UploadHandler 文件上传处理器
 type UploadHandler struct {
 	uploadDir string // 图片上传目录
@@ -72,7 +89,7 @@ func (h *UploadHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 返回图片 URL
-	url := "/Pic/" + filename
+	url := imageURLPrefix + filename
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -80,3 +97,31 @@ func (h *UploadHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		"url": url,
 	})
 }
+
+// LoadImage 读取已上传的图片并转换为 AI 多模态消息片段
+// url 必须是 UploadImage 返回的 /Pic/xxx 地址，不允许跨目录访问
+func (h *UploadHandler) LoadImage(url string) (service.ContentPart, error) {
+	if !strings.HasPrefix(url, imageURLPrefix) {
+		return service.ContentPart{}, errors.New("无效的图片地址")
+	}
+	filename := strings.TrimPrefix(url, imageURLPrefix)
+	if filename == "" || filename != filepath.Base(filename) || strings.HasPrefix(filename, ".") {
+		return service.ContentPart{}, errors.New("无效的图片地址")
+	}
+
+	data, err := os.ReadFile(filepath.Join(h.uploadDir, filename))
+	if err != nil {
+		return service.ContentPart{}, fmt.Errorf("读取图片失败: %w", err)
+	}
+	if len(data) > maxModelImageSize {
+		return service.ContentPart{}, fmt.Errorf("图片超过 %dMB", maxModelImageSize>>20)
+	}
+
+	// 以文件内容判断真实格式，不信任扩展名
+	mediaType := http.DetectContentType(data)
+	if !modelImageTypes[mediaType] {
+		return service.ContentPart{}, fmt.Errorf("不支持的图片格式: %s", mediaType)
+	}
+
+	return service.NewImagePart(mediaType, data), nil
+}
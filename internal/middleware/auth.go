@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"ai-guardian-challenge/internal/model"
 	"ai-guardian-challenge/internal/store"
@@ -15,12 +16,13 @@ const userContextKey contextKey = "user"
 
 // AuthMiddleware 认证中间件
 type AuthMiddleware struct {
-	store *store.Store
+	store store.Repository
+	ttl   time.Duration // 会话有效期，每次访问顺延
 }
 
 // NewAuthMiddleware 创建认证中间件
-func NewAuthMiddleware(s *store.Store) *AuthMiddleware {
-	return &AuthMiddleware{store: s}
+func NewAuthMiddleware(s store.Repository, ttl time.Duration) *AuthMiddleware {
+	return &AuthMiddleware{store: s, ttl: ttl}
 }
 
 // RequireAuth 要求登录的中间件
@@ -32,7 +34,7 @@ func (am *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		user := am.store.GetUserBySession(cookie.Value)
+		user := am.store.GetUserBySession(cookie.Value, am.ttl)
 		if user == nil {
 			http.Error(w, `{"error":"会话已过期"}`, http.StatusUnauthorized)
 			return
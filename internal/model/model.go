@@ -12,8 +12,20 @@ type User struct {
 
 // Message 单条消息结构体
 type Message struct {
-	Role    string `json:"role"`    // "user" 或 "assistant"
-	Content string `json:"content"` // 消息内容
+	Role     string `json:"role"`               // "user" 或 "assistant"
+	Content  string `json:"content"`            // 消息内容
+	ImageURL string `json:"imageUrl,omitempty"` // 附带的图片地址（/Pic/xxx，仅用户消息）
+	Model    string `json:"model,omitempty"`    // 实际应答的模型（仅 AI 回复）
+	Aborted  bool   `json:"aborted,omitempty"`  // 生成被中断（客户端断开、超时或上游出错），内容不完整
+	Refused  bool   `json:"refused,omitempty"`  // 被输入检测拒绝，未发送给 AI（仅用户消息）
+	// 输入检测命中的攻击手法类别（仅用户消息），用于统计分析，不返回给玩家
+	Tags []string `json:"-"`
+
+	// 以下用量字段仅 AI 回复有值，不返回给玩家，管理员通过 /api/admin/usage/messages 查看
+	PromptTokens     int     `json:"-"` // 输入 token 数
+	CompletionTokens int     `json:"-"` // 输出 token 数
+	LatencyMS        int64   `json:"-"` // 从发起请求到生成结束的耗时（毫秒）
+	Cost             float64 `json:"-"` // 按价格表折算的费用
 }
 
 // Conversation 对话结构体
@@ -29,6 +41,7 @@ type Conversation struct {
 	IsPublic      bool      `json:"isPublic"`      // 是否公开可见
 	FoundPassword string    `json:"foundPassword"` // 发现的口令（若有）
 	LastMessage   string    `json:"lastMessage"`   // 最后一条消息预览
+	Level         string    `json:"level"`         // 关卡 ID（未开启闯关模式时为空）
 	CreatedAt     time.Time `json:"createdAt"`     // 创建时间
 }
 
@@ -43,18 +56,70 @@ type ConversationPreview struct {
 	Preview       string    `json:"preview"`
 	LastMessage   string    `json:"lastMessage"`
 	FoundPassword string    `json:"foundPassword,omitempty"`
+	Level         string    `json:"level,omitempty"`
 	CreatedAt     time.Time `json:"createdAt"`
 }
 
 // Winner 获奖者结构体
 type Winner struct {
+	Nickname       string `json:"nickname"`
+	ConversationID string `json:"conversationId"`
+	Category       string `json:"category"`  // "<奖项ID>-first"、"<奖项ID>-subsequent" 或 "<奖项ID>-deduced"（猜中口令）
+	PrizeType      string `json:"prizeType"` // 奖项 ID
+	PrizeName      string `json:"prizeName"` // 奖项显示名称（旧记录为空）
+	PrizeAmount    string `json:"prizeAmount"`
+	Password       string `json:"password"`
+	// 口令的泄露方式：实时检测时为命中的变换（如 "base64"、"line_head"），原文命中为 "direct"；
+	// 另有 "judge"（判定自动发奖）、"review"（管理员审核）、"bonus"（福利发放）；旧记录为空
+	Detection string    `json:"detection"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LeakReview 口令泄露审核记录（由判定模型产生）
+type LeakReview struct {
+	ID             int64      `json:"id"`
+	ConversationID string     `json:"conversationId"`
+	UserID         string     `json:"userId"`
+	Nickname       string     `json:"nickname"`
+	Content        string     `json:"content"`    // 被判定的 AI 回复
+	LeakType       string     `json:"leakType"`   // 泄露口令的奖项 ID
+	Confidence     float64    `json:"confidence"` // 判定置信度 0~1
+	Reason         string     `json:"reason"`     // 判定理由
+	JudgeModel     string     `json:"judgeModel"`
+	Status         string     `json:"status"` // "pending" / "approved" / "rejected" / "awarded"
+	CreatedAt      time.Time  `json:"createdAt"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// BlockedLeak 输出过滤拦截的一条回复
+type BlockedLeak struct {
+	ID             int64     `json:"id"`
+	ConversationID string    `json:"conversationId"`
+	UserID         string    `json:"userId"`
 	Nickname       string    `json:"nickname"`
+	Tiers          []string  `json:"tiers"`   // 回复中出现的口令所属奖项 ID
+	Action         string    `json:"action"`  // "redact"（遮盖）/ "refuse"（整条替换）
+	Content        string    `json:"content"` // 过滤前的回复原文
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// FragmentProgress 对话中已透露的口令片段（跨消息片段累计检测的进度）
+type FragmentProgress struct {
+	Tier      string    `json:"tier"`     // 奖项 ID
+	Start     int       `json:"start"`    // 片段在口令（去标点后）中的起始字符位置
+	Length    int       `json:"length"`   // 片段字符数
+	Fragment  string    `json:"fragment"` // 片段内容
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Guess 玩家提交的口令猜测
+type Guess struct {
+	UserID         string    `json:"userId"`
 	ConversationID string    `json:"conversationId"`
-	Category       string    `json:"category"` // "grand-first", "consolation-first", "grand-subsequent", "consolation-subsequent"
-	PrizeType      string    `json:"prizeType"`
-	PrizeAmount    string    `json:"prizeAmount"`
-	Password       string    `json:"password"`
-	Timestamp      time.Time `json:"timestamp"`
+	Guess          string    `json:"guess"`
+	MatchedTier    string    `json:"matchedTier"` // 猜中的奖项 ID，未猜中为空
+	Similarity     float64   `json:"similarity"`  // 猜中时为 1；未猜中但编辑距离接近某条口令时为其相似度，否则为 0
+	CreatedAt      time.Time `json:"createdAt"`
 }
 
 // SiteInfo 站点信息（返回给前端的配置）
@@ -63,9 +128,34 @@ type SiteInfo struct {
 	IsExpired        bool   `json:"isExpired"`
 	CaptchaType      string `json:"captchaType"`
 	TurnstileSiteKey string `json:"turnstileSiteKey,omitempty"`
-	AdminQQ          string `json:"adminQQ"`     // 管理员 QQ 号
-	AdminEmail       string `json:"adminEmail"`  // 管理员邮箱
-	AdminWechat      string `json:"adminWechat"` // 管理员微信号
+	AdminQQ          string `json:"adminQQ"`       // 管理员 QQ 号
+	AdminEmail       string `json:"adminEmail"`    // 管理员邮箱
+	AdminWechat      string `json:"adminWechat"`   // 管理员微信号
+	Tiers            []Tier `json:"tiers"`         // 公开展示的奖项（不含隐藏奖项）
+	GuessEnabled     bool   `json:"guessEnabled"`  // 是否开放猜口令
+	LevelsEnabled    bool   `json:"levelsEnabled"` // 是否开启闯关模式
+	EmailLogin       bool   `json:"emailLogin"`    // 是否使用邮箱验证码登录
+}
+
+// Tier 奖项的公开信息（不含口令）
+type Tier struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Icon        string `json:"icon,omitempty"`
+	Prize       string `json:"prize"`
+	Description string `json:"description,omitempty"`
+	Quota       int    `json:"quota"`     // 名额上限，0 表示不限
+	Remaining   int    `json:"remaining"` // 剩余名额，不限时为 -1
+}
+
+// Level 关卡的公开信息（不含口令与提示词）及当前用户的闯关进度
+type Level struct {
+	Tier
+	Number   int  `json:"number"`   // 第几关，从 1 开始
+	MaxTurns int  `json:"maxTurns"` // 每个对话的最大轮次
+	Winners  int  `json:"winners"`  // 已通关人数
+	Unlocked bool `json:"unlocked"` // 未登录时只有第一关解锁
+	Cleared  bool `json:"cleared"`
 }
 
 // PaginatedResponse 分页响应通用结构
@@ -83,16 +173,54 @@ type PaginatedResponse struct {
 //   - "password_found": AI 泄露口令（实时检测）
 //   - "bonus_offer": 福利口令选择弹窗（55次阈值触发）
 //   - "bonus_result": 福利口令发放结果（自动发放时使用）
-//   - "error": 错误信息
+//   - "error": 错误信息（Code 为 "budget_exhausted" 时 Budget 给出耗尽的预算）
 type SSEEvent struct {
 	Type                   string `json:"type"`
 	Content                string `json:"content,omitempty"`
+	Code                   string `json:"code,omitempty"`   // 错误代码（仅 error 事件）
+	Budget                 string `json:"budget,omitempty"` // 耗尽的预算：global_daily / user_daily / conversation
 	Password               string `json:"password,omitempty"`
-	PrizeType              string `json:"prizeType,omitempty"`
+	Tier                   string `json:"tier,omitempty"`      // 奖项 ID（password_found）
+	PrizeType              string `json:"prizeType,omitempty"` // 奖项显示名称
 	PrizeAmount            string `json:"prizeAmount,omitempty"`
 	IsFirstWinner          bool   `json:"isFirstWinner,omitempty"`
+	LevelCleared           bool   `json:"levelCleared,omitempty"`           // 通过了闯关模式的关卡（password_found）
+	PrizeSoldOut           bool   `json:"prizeSoldOut,omitempty"`           // 奖项名额已满，未记录获奖（password_found）
 	TotalTurns             int    `json:"totalTurns,omitempty"`             // 用户总对话轮次
 	ConsolationPassword    string `json:"consolationPassword,omitempty"`    // 福利口令（bonus_offer 时传递）
 	ConsolationPrizeAmount string `json:"consolationPrizeAmount,omitempty"` // 福利口令奖品金额
 	GrandAvailable         bool   `json:"grandAvailable,omitempty"`         // 主口令奖品是否还有剩余
 }
+
+// InputTagStat 输入检测标签统计（管理接口）
+type InputTagStat struct {
+	Tag                  string `json:"tag"`
+	Messages             int    `json:"messages"`             // 带该标签的用户消息数
+	Refused              int    `json:"refused"`              // 其中被拒绝的消息数
+	Users                int    `json:"users"`                // 使用过该手法的用户数
+	Conversations        int    `json:"conversations"`        // 使用过该手法的对话数
+	SuccessConversations int    `json:"successConversations"` // 其中最终获得口令的对话数
+}
+
+// UsageStat token 用量与费用汇总（管理接口）
+type UsageStat struct {
+	Key              string  `json:"key"`                     // 汇总维度：用户 ID / 对话 ID / 模型名称
+	Label            string  `json:"label,omitempty"`         // 展示名称（用户昵称等）
+	Conversations    int     `json:"conversations,omitempty"` // 涉及的对话数
+	Messages         int     `json:"messages"`                // AI 回复条数
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMS     int64   `json:"avgLatencyMs"`
+}
+
+// MessageUsage 单条 AI 回复的用量（管理接口）
+type MessageUsage struct {
+	Index            int     `json:"index"`             // 在对话消息列表中的位置（从 0 开始）
+	Model            string  `json:"model,omitempty"`   // 实际应答的模型
+	Aborted          bool    `json:"aborted,omitempty"` // 生成被中断
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	LatencyMS        int64   `json:"latencyMs"`
+	Cost             float64 `json:"cost"`
+}
@@ -1,92 +1,226 @@
 package service
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// AIService AI 对接服务（OpenAI 兼容 API）
+// Endpoint 一个上游端点：提供商适配器 + 模型
+type Endpoint struct {
+	Name     string
+	Provider Provider
+	Model    string
+}
+
+// endpointState 运行时端点状态（附带熔断器）
+type endpointState struct {
+	Endpoint
+	breaker *circuitBreaker
+}
+
+// AIOptions AI 服务运行参数
+type AIOptions struct {
+	Breaker        BreakerSettings
+	RequestTimeout time.Duration // 单次生成的总时长上限（0 表示不限制）
+	IdleTimeout    time.Duration // 上游两次数据之间的最长间隔（0 表示不限制）
+	// 生成参数：Temperature 为 nil、TopP 为 0 时不发送
+	Temperature *float64
+	TopP        float64
+	MaxTokens   int
+	// 上下文窗口管理（按端点的模型分别裁剪）
+	Context ContextOptions
+}
+
+// AIService AI 对接服务
+// 具体的上游协议由 Provider 实现，AIService 负责组装消息、重试、端点降级和流式分发
 type AIService struct {
-	apiURL       string
-	apiKey       string
-	model        string
+	endpoints    []*endpointState // 按优先级排列的端点列表
 	systemPrompt string
+	opts         AIOptions
 }
 
 // NewAIService 创建 AI 服务实例
-func NewAIService(apiURL, apiKey, model, systemPrompt string) *AIService {
+// endpoints 按顺序尝试：前一个端点熔断或失败时自动切换到下一个
+func NewAIService(endpoints []Endpoint, systemPrompt string, opts AIOptions) *AIService {
+	states := make([]*endpointState, 0, len(endpoints))
+	for _, ep := range endpoints {
+		states = append(states, &endpointState{
+			Endpoint: ep,
+			breaker:  newCircuitBreaker(opts.Breaker),
+		})
+	}
 	return &AIService{
-		apiURL:       apiURL,
-		apiKey:       apiKey,
-		model:        model,
+		endpoints:    states,
 		systemPrompt: systemPrompt,
+		opts:         opts,
+	}
+}
+
+// WithSystemPrompt 返回使用另一份系统提示词的 AI 服务（如闯关模式的各关守护者）
+// 端点及其熔断状态与原服务共享
+func (ai *AIService) WithSystemPrompt(systemPrompt string) *AIService {
+	clone := *ai
+	clone.systemPrompt = systemPrompt
+	return &clone
+}
+
+// EndpointStatus 端点的熔断状态（管理接口展示）
+type EndpointStatus struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+	State string `json:"state"` // closed（正常）/ open（熔断中）/ half-open（冷却结束，等待或正在试探）
+}
+
+// EndpointStatuses 按优先级返回各端点的熔断状态
+func (ai *AIService) EndpointStatuses() []EndpointStatus {
+	statuses := make([]EndpointStatus, 0, len(ai.endpoints))
+	for _, ep := range ai.endpoints {
+		statuses = append(statuses, EndpointStatus{Name: ep.Name, Model: ep.Model, State: ep.breaker.State()})
 	}
+	return statuses
 }
 
-// ChatMessage OpenAI 格式的消息结构
+// ChatMessage 对话消息结构（与提供商协议无关）
+// 纯文本消息只使用 Content；多模态消息使用 Parts（非空时优先于 Content）
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string
+	Content string
+	Parts   []ContentPart
+}
+
+// ContentPart 多模态消息片段
+type ContentPart struct {
+	Type      string // "text" 或 "image"
+	Text      string // 文本内容（Type 为 text 时）
+	MediaType string // 图片 MIME 类型，如 image/png（Type 为 image 时）
+	Data      string // 图片的 base64 编码（不含 data: 前缀）
+}
+
+// 消息片段类型
+const (
+	PartText  = "text"
+	PartImage = "image"
+)
+
+// NewImagePart 由图片原始字节创建图片片段
+func NewImagePart(mediaType string, data []byte) ContentPart {
+	return ContentPart{
+		Type:      PartImage,
+		MediaType: mediaType,
+		Data:      base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+// DataURL 返回图片的 data URL（data:image/png;base64,...）
+func (p ContentPart) DataURL() string {
+	return "data:" + p.MediaType + ";base64," + p.Data
+}
+
+// ContentParts 返回消息的全部片段（纯文本消息视为单个文本片段）
+func (m ChatMessage) ContentParts() []ContentPart {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	return []ContentPart{{Type: PartText, Text: m.Content}}
 }
 
-// chatRequest OpenAI 请求体结构
-type chatRequest struct {
-	Model       string        `json:"model"`
-	Messages    []ChatMessage `json:"messages"`
-	Stream      bool          `json:"stream"`
-	Temperature float64       `json:"temperature,omitempty"`
-	MaxTokens   int           `json:"max_tokens,omitempty"`
+// Text 返回消息中的全部文本（忽略图片）
+func (m ChatMessage) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == PartText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// HasImages 判断消息是否包含图片
+func (m ChatMessage) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == PartImage {
+			return true
+		}
+	}
+	return false
 }
 
 // StreamDelta 流式响应中的增量内容
 type StreamDelta struct {
 	Content string
 	Done    bool
+	Usage   *Usage // 仅随 Done 返回；上游未提供用量时为 nil
 	Error   error
 }
 
-// streamChoice 流式响应的 choice 结构
-type streamChoice struct {
-	Delta struct {
-		Content string `json:"content"`
-	} `json:"delta"`
-	FinishReason *string `json:"finish_reason"`
+// Usage 单次生成的 token 用量（由上游返回）
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
 }
 
-// streamResponse 流式响应结构
-type streamResponse struct {
-	Choices []streamChoice `json:"choices"`
+// ChatStream 一次流式生成的结果
+type ChatStream struct {
+	Deltas   <-chan StreamDelta // 增量内容
+	Endpoint string             // 实际应答的端点名称
+	Model    string             // 实际应答的模型
 }
 
-// maxRetries AI API 请求最大重试次数（首次 + 重试次数）
+// ErrAllEndpointsUnavailable 所有端点均熔断或请求失败
+var ErrAllEndpointsUnavailable = errors.New("所有 AI 端点均不可用")
+
+// 生成超时错误（通过 StreamDelta.Error 返回）
+var (
+	ErrStreamTimeout     = errors.New("AI 生成超时")
+	ErrStreamIdleTimeout = errors.New("AI 响应长时间无数据")
+)
+
+// maxRetries 单个端点的最大请求次数（首次 + 重试次数）
 const maxRetries = 3
 
 // retryDelay 重试间隔
 const retryDelay = 500 * time.Millisecond
 
+// renderSystemPrompt 将系统提示词中的口令占位符替换为本对话的口令
+func (ai *AIService) renderSystemPrompt(secrets map[string]string) string {
+	if len(secrets) == 0 {
+		return ai.systemPrompt
+	}
+	pairs := make([]string, 0, len(secrets)*2)
+	for tierID, secret := range secrets {
+		pairs = append(pairs, "{{secret."+tierID+"}}", secret)
+	}
+	return strings.NewReplacer(pairs...).Replace(ai.systemPrompt)
+}
+
 // GenerateInitialMessage 生成对话的开场白（非流式）
 func (ai *AIService) GenerateInitialMessage() string {
 	return "你好！我是 AI 守护者。我正在守护一些神秘口令。你可以尝试和我对话，看看能否让我说出口令。但我会尽全力保护它们！准备好了吗？"
 }
 
 // doStreamRequest 执行单次流式 HTTP 请求，返回响应对象
+// ctx 取消时（客户端断开或超时）请求及响应体读取会随之中断
 // 调用方负责关闭 resp.Body
-func (ai *AIService) doStreamRequest(bodyBytes []byte) (*http.Response, error) {
-	req, err := http.NewRequest("POST", ai.apiURL, bytes.NewReader(bodyBytes))
+func (ai *AIService) doStreamRequest(ctx context.Context, provider Provider, bodyBytes []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.URL(), bytes.NewReader(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+ai.apiKey)
-	req.Header.Set("Accept", "text/event-stream")
+	provider.SetHeaders(req.Header)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -97,130 +231,209 @@ func (ai *AIService) doStreamRequest(bodyBytes []byte) (*http.Response, error) {
 }
 
 // StreamChat 流式调用 AI 生成响应
-// 传入对话历史，返回一个 channel 用于接收流式内容
-// 当 AI API 返回 500 错误时，自动重试最多 2 次
-func (ai *AIService) StreamChat(history []ChatMessage, userMessage string) (<-chan StreamDelta, error) {
-	// 构建完整消息列表
-	messages := make([]ChatMessage, 0, len(history)+2)
-
-	// 系统提示词在最前面
-	messages = append(messages, ChatMessage{
-		Role:    "system",
-		Content: ai.systemPrompt,
-	})
-
-	// 加入历史消息
+// 传入对话历史和当前用户消息（可含图片），返回流式结果（含实际应答的模型名称）
+// 端点按配置顺序尝试：5xx / 网络错误在同一端点重试，连续失败或遇到 429 时熔断并切换到下一个端点
+// secrets 为奖项 ID → 本对话的口令，用于替换系统提示词中的 {{secret.<奖项ID>}} 占位符
+// ctx 取消（如浏览器断开 SSE 连接）时立即中断上游请求，不再消耗 token；
+// 超过总时长或空闲时长时，通过 StreamDelta.Error 返回 ErrStreamTimeout / ErrStreamIdleTimeout
+func (ai *AIService) StreamChat(ctx context.Context, secrets map[string]string, history []ChatMessage, userMessage ChatMessage) (*ChatStream, error) {
+	system := ai.renderSystemPrompt(secrets)
+
+	// 构建完整消息列表（系统提示词由 Provider 按各自协议放置）
+	messages := make([]ChatMessage, 0, len(history)+1)
 	messages = append(messages, history...)
-
-	// 加入当前用户消息
-	messages = append(messages, ChatMessage{
-		Role:    "user",
-		Content: userMessage,
-	})
-
-	reqBody := chatRequest{
-		Model:       ai.model,
-		Messages:    messages,
-		Stream:      true,
-		Temperature: 0.7,
-		MaxTokens:   2000,
+	messages = append(messages, userMessage)
+
+	// streamCtx 在客户端断开、总时长超时、空闲超时任一发生时取消，取消原因通过 context.Cause 获取
+	streamCtx, cancel := context.WithCancelCause(ctx)
+	stopTimer := func() bool { return true }
+	if ai.opts.RequestTimeout > 0 {
+		timer := time.AfterFunc(ai.opts.RequestTimeout, func() { cancel(ErrStreamTimeout) })
+		stopTimer = timer.Stop
 	}
-
-	bodyBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	release := func() {
+		stopTimer()
+		cancel(nil)
 	}
 
-	// 带重试的请求逻辑：500 错误最多重试 2 次
-	var resp *http.Response
 	var lastErr error
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		resp, lastErr = ai.doStreamRequest(bodyBytes)
-		if lastErr != nil {
-			// 网络层错误，直接重试
-			log.Printf("⚠️ AI API 请求失败 (第 %d/%d 次): %v", attempt, maxRetries, lastErr)
-			if attempt < maxRetries {
-				time.Sleep(retryDelay)
-				continue
-			}
-			return nil, lastErr
+	for _, ep := range ai.endpoints {
+		if streamCtx.Err() != nil {
+			break
+		}
+		if !ep.breaker.Allow() {
+			log.Printf("⏭️ AI 端点 %s 熔断中 (%s)，跳过", ep.Name, ep.breaker.State())
+			continue
 		}
 
-		// 请求成功（HTTP 200），跳出重试循环
-		if resp.StatusCode == http.StatusOK {
-			break
+		resp, err := ai.requestEndpoint(streamCtx, ep, system, messages)
+		if err != nil {
+			lastErr = err
+			continue
 		}
 
-		// 对 500 系列错误进行重试
-		if resp.StatusCode >= 500 {
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			lastErr = fmt.Errorf("AI API 返回错误 (HTTP %d): %s", resp.StatusCode, string(body))
-			log.Printf("⚠️ AI API 返回 %d (第 %d/%d 次): %s", resp.StatusCode, attempt, maxRetries, string(body))
+		ch := make(chan StreamDelta, 100)
+		go func() {
+			defer close(ch)
+			defer release()
+			defer resp.Body.Close()
+
+			// 空闲超时：每读到一次数据就重置计时
+			var body io.Reader = resp.Body
+			if ai.opts.IdleTimeout > 0 {
+				idle := time.AfterFunc(ai.opts.IdleTimeout, func() { cancel(ErrStreamIdleTimeout) })
+				defer idle.Stop()
+				body = &idleTimeoutReader{r: resp.Body, timer: idle, timeout: ai.opts.IdleTimeout}
+			}
 
-			if attempt < maxRetries {
-				time.Sleep(retryDelay)
-				continue
+			// 发送增量；接收方已离开时停止解析，不再继续读取上游
+			emit := func(delta StreamDelta) bool {
+				select {
+				case ch <- delta:
+					return true
+				case <-streamCtx.Done():
+					return false
+				}
 			}
-			return nil, lastErr
-		}
 
-		// 非 500 系列错误（如 400、401、403），不重试，直接返回
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("AI API 返回错误 (HTTP %d): %s", resp.StatusCode, string(body))
-	}
+			err := ep.Provider.ParseStream(body, emit)
 
-	ch := make(chan StreamDelta, 100)
+			if streamCtx.Err() != nil {
+				if ctx.Err() != nil {
+					// 客户端已断开，无需再通知，也不计入熔断统计
+					ep.breaker.Release()
+					log.Printf("🛑 客户端已断开，取消 AI 端点 %s 的生成", ep.Name)
+					return
+				}
+				// 超时：计入熔断统计并通知调用方
+				err = context.Cause(streamCtx)
+			}
+			if err != nil {
+				// 流中途出错同样计入熔断统计
+				if ep.breaker.RecordFailure() {
+					log.Printf("🔌 AI 端点 %s 流式响应出错后熔断: %v", ep.Name, err)
+				}
+				select {
+				case ch <- StreamDelta{Error: err}:
+				case <-ctx.Done():
+				}
+			}
+		}()
 
-	go func() {
-		defer close(ch)
-		defer resp.Body.Close()
+		return &ChatStream{Deltas: ch, Endpoint: ep.Name, Model: ep.Model}, nil
+	}
 
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
+	release()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if lastErr == nil {
+		return nil, ErrAllEndpointsUnavailable
+	}
+	return nil, fmt.Errorf("%w: %v", ErrAllEndpointsUnavailable, lastErr)
+}
 
-			// 跳过空行
-			if line == "" {
-				continue
-			}
+// requestEndpoint 向单个端点发起请求（带重试），成功时返回 HTTP 200 的响应
+// 对话历史按该端点模型的上下文窗口裁剪
+func (ai *AIService) requestEndpoint(ctx context.Context, ep *endpointState, system string, messages []ChatMessage) (*http.Response, error) {
+	system, messages = ai.fitContext(ctx, ep.Model, system, messages)
+	bodyBytes, err := ep.Provider.BuildBody(&ProviderRequest{
+		Model:       ep.Model,
+		System:      system,
+		Messages:    messages,
+		Temperature: ai.opts.Temperature,
+		TopP:        ai.opts.TopP,
+		MaxTokens:   ai.opts.MaxTokens,
+	})
+	if err != nil {
+		ep.breaker.Release()
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
 
-			// 移除 "data: " 前缀
-			if !strings.HasPrefix(line, "data: ") {
-				continue
+	var lastErr error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		resp, err := ai.doStreamRequest(ctx, ep.Provider, bodyBytes)
+		if ctx.Err() != nil {
+			// 客户端断开或总时长超时：不再重试，超时计入熔断统计，客户端断开则只结束本次请求
+			if resp != nil {
+				resp.Body.Close()
 			}
-
-			data := strings.TrimPrefix(line, "data: ")
-
-			// 流结束标记
-			if data == "[DONE]" {
-				ch <- StreamDelta{Done: true}
-				return
+			cause := context.Cause(ctx)
+			if errors.Is(cause, ErrStreamTimeout) {
+				ep.breaker.RecordFailure()
+			} else {
+				ep.breaker.Release()
 			}
-
-			// 解析 JSON
-			var sr streamResponse
-			if err := json.Unmarshal([]byte(data), &sr); err != nil {
-				continue
+			return nil, cause
+		}
+		if err != nil {
+			// 网络层错误，计入熔断后重试
+			lastErr = err
+			log.Printf("⚠️ AI 端点 %s 请求失败 (第 %d/%d 次): %v", ep.Name, attempt, maxRetries, err)
+		} else if resp.StatusCode == http.StatusOK {
+			ep.breaker.RecordSuccess()
+			return resp, nil
+		} else {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			apiErr := ep.Provider.ParseError(resp.StatusCode, body)
+			lastErr = apiErr
+
+			// 429 限流：立即熔断（优先遵循 Retry-After），切换到下一个端点
+			if resp.StatusCode == http.StatusTooManyRequests {
+				ep.breaker.Trip(parseRetryAfter(resp.Header.Get("Retry-After")))
+				log.Printf("🔌 AI 端点 %s 被限流，熔断并切换: %v", ep.Name, apiErr)
+				return nil, apiErr
 			}
 
-			for _, choice := range sr.Choices {
-				if choice.Delta.Content != "" {
-					ch <- StreamDelta{Content: choice.Delta.Content}
-				}
-				if choice.FinishReason != nil {
-					ch <- StreamDelta{Done: true}
-					return
-				}
+			// 非 500 系列错误（如 400、401、403）重试无意义，计入失败后切换到下一个端点
+			if resp.StatusCode < 500 {
+				ep.breaker.RecordFailure()
+				log.Printf("⚠️ AI 端点 %s: %v", ep.Name, apiErr)
+				return nil, apiErr
 			}
+
+			log.Printf("⚠️ AI 端点 %s: %v (第 %d/%d 次)", ep.Name, apiErr, attempt, maxRetries)
 		}
 
-		if err := scanner.Err(); err != nil {
-			ch <- StreamDelta{Error: fmt.Errorf("读取流式响应失败: %w", err)}
+		if ep.breaker.RecordFailure() {
+			log.Printf("🔌 AI 端点 %s 连续失败，熔断并切换", ep.Name)
+			return nil, lastErr
+		}
+		if attempt < maxRetries {
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+				ep.breaker.Release()
+				return nil, context.Cause(ctx)
+			}
 		}
-	}()
+	}
+
+	return nil, lastErr
+}
 
-	return ch, nil
+// idleTimeoutReader 包装上游响应体：每次读到数据时重置空闲计时器
+// 计时器到期时由其回调取消请求上下文，正在阻塞的 Read 随之返回
+type idleTimeoutReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (ir *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+	return n, err
+}
+
+// parseRetryAfter 解析 Retry-After 响应头（仅支持秒数格式）
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
 }
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerSettings 熔断器参数
+type BreakerSettings struct {
+	FailureThreshold int           // 连续失败多少次后熔断
+	Cooldown         time.Duration // 熔断持续时间，到期后放行一次试探请求
+}
+
+// 熔断器状态
+const (
+	breakerClosed   = "closed"    // 正常放行
+	breakerOpen     = "open"      // 熔断中，直接跳过
+	breakerHalfOpen = "half-open" // 冷却结束，等待试探请求结果
+)
+
+// circuitBreaker 单个端点的熔断器
+// 连续失败达到阈值（或遇到 429 限流）后熔断，冷却期内请求直接切换到下一个端点；
+// 冷却结束后放行一次试探请求，成功则恢复，失败则重新熔断
+type circuitBreaker struct {
+	mu       sync.Mutex
+	settings BreakerSettings
+
+	failures  int       // 连续失败次数
+	openUntil time.Time // 熔断截止时间（零值表示未熔断）
+	probing   bool      // 半开状态下是否已有试探请求在进行
+}
+
+// newCircuitBreaker 创建熔断器
+func newCircuitBreaker(settings BreakerSettings) *circuitBreaker {
+	return &circuitBreaker{settings: settings}
+}
+
+// Allow 判断当前是否允许向该端点发起请求
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+
+	// 冷却结束：只放行一个试探请求
+	if b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// RecordSuccess 记录一次成功，恢复为正常状态
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// RecordFailure 记录一次失败，返回本次失败后是否处于熔断状态
+func (b *circuitBreaker) RecordFailure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	// 试探请求失败，或连续失败达到阈值 → 熔断
+	if b.probing || b.failures >= b.settings.FailureThreshold {
+		b.open(b.settings.Cooldown)
+		return true
+	}
+	return false
+}
+
+// Release 结束请求但不计入成功或失败（客户端中途断开时调用）
+// 半开状态下的试探请求被取消后，下一个请求可以重新试探；否则该端点将永远无法恢复
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// Trip 立即熔断指定时长（用于 429 限流，d 为 0 时使用默认冷却时间）
+func (b *circuitBreaker) Trip(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d <= 0 {
+		d = b.settings.Cooldown
+	}
+	b.failures++
+	b.open(d)
+}
+
+// open 进入熔断状态（调用方需持有锁）
+func (b *circuitBreaker) open(d time.Duration) {
+	b.openUntil = time.Now().Add(d)
+	b.probing = false
+}
+
+// State 返回当前状态（用于日志与管理接口）
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.openUntil.IsZero():
+		return breakerClosed
+	case time.Now().Before(b.openUntil):
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// tripAndWait 熔断后等待冷却结束，使熔断器进入半开状态
+func tripAndWait(t *testing.T, b *circuitBreaker) {
+	t.Helper()
+	b.Trip(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if got := b.State(); got != breakerHalfOpen {
+		t.Fatalf("冷却结束后状态应为 %s，实际为 %s", breakerHalfOpen, got)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name   string
+		finish func(b *circuitBreaker)
+		// 试探结束后的期望
+		state string
+		allow bool
+	}{
+		{"试探成功后恢复", (*circuitBreaker).RecordSuccess, breakerClosed, true},
+		{"试探失败后重新熔断", func(b *circuitBreaker) { b.RecordFailure() }, breakerOpen, false},
+		{"试探取消后可重新试探", (*circuitBreaker).Release, breakerHalfOpen, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(BreakerSettings{FailureThreshold: 3, Cooldown: time.Hour})
+			tripAndWait(t, b)
+
+			if !b.Allow() {
+				t.Fatal("冷却结束后应放行一次试探请求")
+			}
+			if b.Allow() {
+				t.Fatal("试探进行中不应放行第二个请求")
+			}
+			tt.finish(b)
+			if got := b.State(); got != tt.state {
+				t.Errorf("状态应为 %s，实际为 %s", tt.state, got)
+			}
+			if got := b.Allow(); got != tt.allow {
+				t.Errorf("Allow() 应为 %v，实际为 %v", tt.allow, got)
+			}
+		})
+	}
+}
+
+// TestStreamChatCancelledProbe 半开状态下的试探请求在上游响应前被客户端取消，端点之后仍可再次试探
+func TestStreamChatCancelledProbe(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) // 读完请求体后服务端才能感知连接断开
+		arrived <- struct{}{}
+		<-r.Context().Done() // 一直不响应，直到客户端断开
+	}))
+	defer upstream.Close()
+
+	provider, err := NewProvider(ProviderOpenAI, upstream.URL, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai := NewAIService(
+		[]Endpoint{{Name: "primary", Provider: provider, Model: "test-model"}},
+		"system",
+		AIOptions{Breaker: BreakerSettings{FailureThreshold: 3, Cooldown: time.Hour}},
+	)
+	b := ai.endpoints[0].breaker
+	tripAndWait(t, b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	if _, err := ai.StreamChat(ctx, nil, nil, ChatMessage{Role: "user", Content: "你好"}); err == nil {
+		t.Fatal("客户端取消后 StreamChat 应返回错误")
+	}
+
+	if got := b.State(); got != breakerHalfOpen {
+		t.Errorf("取消试探不应改变熔断状态，期望 %s，实际为 %s", breakerHalfOpen, got)
+	}
+	if !b.Allow() {
+		t.Error("试探请求被取消后，下一个请求应可重新试探")
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hanText 生成 n 个汉字（估算为 n 个 token）
+func hanText(n int) string {
+	return strings.Repeat("字", n)
+}
+
+// dialogue 生成交替的对话，每条消息估算为 14 个 token（9 个汉字与 1 至 2 位数字），最后一条为当前用户消息
+func dialogue(n int) []ChatMessage {
+	messages := make([]ChatMessage, n)
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = ChatMessage{Role: role, Content: fmt.Sprintf("第%d条%s", i, hanText(7))}
+	}
+	return messages
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"你好", 2},
+		{"hello world", 3},
+		{"こんにちは", 5},
+		{"口令是 abc", 4}, // 3 个汉字 + 4 个字节
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d，期望 %d", tt.text, got, tt.want)
+		}
+	}
+	image := ChatMessage{Role: "user", Parts: []ContentPart{{Type: PartText, Text: "你好"}, {Type: PartImage}}}
+	if got := estimateMessage(image); got != tokensPerMessage+2+tokensPerImage {
+		t.Errorf("带图片的消息估算为 %d", got)
+	}
+}
+
+func TestContextCut(t *testing.T) {
+	messages := dialogue(5) // 用户、助手、用户、助手、用户，各 14 个 token
+	tests := []struct {
+		name   string
+		budget int
+		want   int
+	}{
+		{"全部放得下", 70, 0},
+		{"刚好放下最近两轮", 42, 2},
+		{"放得下助手消息但不从用户消息开始", 69, 2},
+		{"只保留当前消息", 41, 4},
+		{"当前消息超出预算仍保留", 5, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cut := contextCut(messages, tt.budget)
+			if cut != tt.want {
+				t.Fatalf("contextCut = %d，期望 %d", cut, tt.want)
+			}
+			if messages[cut].Role != "user" {
+				t.Errorf("保留部分应从用户消息开始，实际为 %s", messages[cut].Role)
+			}
+		})
+	}
+}
+
+// stubSummarizer 摘要模型的桩服务：依次返回 "摘要1"、"摘要2"……，记录每次的请求内容
+type stubSummarizer struct {
+	mu       sync.Mutex
+	requests []string
+	fail     bool
+}
+
+func (s *stubSummarizer) calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// newStubSummarizer 启动摘要桩服务并创建摘要器
+func newStubSummarizer(t *testing.T) (*Summarizer, *stubSummarizer) {
+	t.Helper()
+	stub := &stubSummarizer{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, string(body))
+		n, fail := len(stub.requests), stub.fail
+		stub.mu.Unlock()
+		if fail {
+			http.Error(w, `{"error":{"message":"unavailable"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk, _ := json.Marshal(map[string]interface{}{
+			"choices": []map[string]interface{}{{"delta": map[string]string{"content": fmt.Sprintf("摘要%d", n)}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", chunk)
+	}))
+	t.Cleanup(upstream.Close)
+
+	provider, err := NewProvider(ProviderOpenAI, upstream.URL, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSummarizer(provider, "summary-model", 100, 0), stub
+}
+
+// contextService 创建只用于裁剪上下文的 AI 服务，窗口按"留给历史消息的预算为 budget"反推
+func contextService(system string, budget int, summarizer *Summarizer) *AIService {
+	window := budget + 200 + EstimateTokens(system)
+	if summarizer != nil {
+		window += summarizer.maxTokens + EstimateTokens(summaryNote)
+	}
+	return NewAIService(nil, system, AIOptions{
+		MaxTokens: 200,
+		Context:   ContextOptions{Windows: map[string]int{"small": window}, Summarizer: summarizer},
+	})
+}
+
+func TestFitContextTruncate(t *testing.T) {
+	const system = "你是守护者"
+	ai := contextService(system, 42, nil)
+	messages := dialogue(5)
+
+	gotSystem, kept := ai.fitContext(context.Background(), "small", system, messages)
+	if gotSystem != system {
+		t.Errorf("直接丢弃时不应修改系统提示词: %q", gotSystem)
+	}
+	if len(kept) != 3 || kept[0].Content != messages[2].Content {
+		t.Errorf("应保留最近的 3 条消息，实际 %+v", kept)
+	}
+
+	// 未配置窗口的模型不裁剪
+	if _, all := ai.fitContext(context.Background(), "large", system, messages); len(all) != len(messages) {
+		t.Errorf("未配置窗口的模型不应裁剪，实际保留 %d 条", len(all))
+	}
+	// 预算放得下时原样返回
+	if _, all := ai.fitContext(context.Background(), "small", system, messages[:3]); len(all) != 3 {
+		t.Errorf("未超出窗口时不应裁剪，实际保留 %d 条", len(all))
+	}
+}
+
+func TestFitContextSummary(t *testing.T) {
+	const system = "你是守护者"
+	summarizer, stub := newStubSummarizer(t)
+	ai := contextService(system, 42, summarizer)
+	ctx := context.Background()
+
+	// 预留摘要空间前历史已超出窗口，才会触发摘要
+	messages := dialogue(21)
+	gotSystem, kept := ai.fitContext(ctx, "small", system, messages)
+	if gotSystem != system+summaryNote+"摘要1" {
+		t.Errorf("摘要应追加到系统提示词: %q", gotSystem)
+	}
+	if len(kept) != 3 || kept[0].Role != "user" || kept[len(kept)-1].Content != messages[20].Content {
+		t.Fatalf("保留的消息应从用户消息开始并以当前消息结束: %+v", kept)
+	}
+	for _, m := range kept {
+		if strings.Contains(m.Text(), "摘要") {
+			t.Errorf("摘要不应作为对话消息发送: %+v", m)
+		}
+	}
+	if calls := stub.calls(); len(calls) != 1 || !strings.Contains(calls[0], messages[17].Content) || strings.Contains(calls[0], messages[18].Content) {
+		t.Fatalf("首次摘要应只包含被丢弃的消息: %v", calls)
+	}
+
+	// 同一段历史再次裁剪时使用缓存的摘要
+	if gotSystem, _ := ai.fitContext(ctx, "small", system, messages); !strings.HasSuffix(gotSystem, "摘要1") || len(stub.calls()) != 1 {
+		t.Errorf("相同前缀应命中缓存，系统提示词 %q，摘要请求 %d 次", gotSystem, len(stub.calls()))
+	}
+
+	// 对话继续增长：只把新丢弃的消息并入上一次的摘要
+	longer := dialogue(23)
+	gotSystem, kept = ai.fitContext(ctx, "small", system, longer)
+	calls := stub.calls()
+	if len(calls) != 2 || !strings.HasSuffix(gotSystem, "摘要2") || len(kept) != 3 {
+		t.Fatalf("增长后应重新摘要，系统提示词 %q，保留 %d 条，摘要请求 %d 次", gotSystem, len(kept), len(calls))
+	}
+	if last := calls[1]; !strings.Contains(last, "已有摘要") || !strings.Contains(last, "摘要1") ||
+		strings.Contains(last, longer[17].Content) || !strings.Contains(last, longer[19].Content) {
+		t.Errorf("增量摘要应基于已有摘要并只包含新丢弃的消息: %s", last)
+	}
+}
+
+func TestFitContextSummaryFailure(t *testing.T) {
+	const system = "你是守护者"
+	summarizer, stub := newStubSummarizer(t)
+	stub.fail = true
+	ai := contextService(system, 42, summarizer)
+
+	gotSystem, kept := ai.fitContext(context.Background(), "small", system, dialogue(21))
+	if gotSystem != system || len(kept) != 3 || kept[0].Role != "user" {
+		t.Errorf("摘要失败时应退回直接丢弃，系统提示词 %q，保留 %+v", gotSystem, kept)
+	}
+}
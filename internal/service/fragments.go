@@ -0,0 +1,159 @@
+package service
+
+import "strings"
+
+// TransformFragments 跨消息片段累计命中时的变换名称
+const TransformFragments = "fragments"
+
+// Fragment 回复中出现的口令片段
+type Fragment struct {
+	Type   string // 奖项 ID
+	Start  int    // 片段在口令（去标点后）中的起始字符位置
+	Length int    // 片段字符数
+	Text   string // 片段内容
+}
+
+// fragmentTarget 单条口令的片段累计状态
+type fragmentTarget struct {
+	rule     PasswordRule
+	secret   []rune // 去标点后的口令
+	revealed []bool // 各字符是否已在此前的回复中出现
+}
+
+// FragmentTracker 跨消息的口令片段累计
+// 守护者可能每轮只透露口令的一小段（"前四个字是……"，下一轮"后面是……"），单条回复都不构成泄露，
+// 因此按对话累计每条口令已被透露的字符，覆盖率达到阈值即判定泄露
+// 累计状态由调用方持久化：创建时传入此前记录的片段，每条回复结束后用 Reveal 取出新透露的片段保存
+type FragmentTracker struct {
+	pc      *PasswordChecker
+	targets []*fragmentTarget // 按检测优先级排列
+}
+
+// NewFragmentTracker 以对话此前记录的片段为基础创建片段追踪器
+// 与当前口令对不上的片段（如口令已更换）忽略；未启用（覆盖率 <= 0）或没有口令开启片段检测时返回 nil
+func (pc *PasswordChecker) NewFragmentTracker(progress []Fragment) *FragmentTracker {
+	if pc.opts.FragmentMinCoverage <= 0 {
+		return nil
+	}
+
+	t := &FragmentTracker{pc: pc}
+	for _, e := range pc.entries {
+		if !e.rule.Fragments {
+			continue
+		}
+		secret := []rune(stripPunctuation(e.rule.Password))
+		if len(secret) == 0 {
+			continue
+		}
+		t.targets = append(t.targets, &fragmentTarget{
+			rule:     e.rule,
+			secret:   secret,
+			revealed: make([]bool, len(secret)),
+		})
+	}
+	if len(t.targets) == 0 {
+		return nil
+	}
+
+	for _, f := range progress {
+		for _, target := range t.targets {
+			if target.rule.Type == f.Type && f.Start >= 0 && f.Start+f.Length <= len(target.secret) &&
+				string(target.secret[f.Start:f.Start+f.Length]) == f.Text {
+				target.mark(f)
+			}
+		}
+	}
+	return t
+}
+
+// Check 将本条回复（可以是尚未生成完的部分回复）中的片段与此前的累计合并，返回覆盖率首个达到阈值的口令（按优先级）
+// 本条回复不计入累计状态：流式生成时同一条回复会被反复检查
+func (t *FragmentTracker) Check(reply string) *PasswordMatch {
+	for _, target := range t.targets {
+		fragments := t.fragments(target, reply)
+		covered := 0
+		for i, r := range target.revealed {
+			if r || inFragments(fragments, i) {
+				covered++
+			}
+		}
+		if float64(covered)/float64(len(target.secret)) >= t.pc.opts.FragmentMinCoverage {
+			return &PasswordMatch{
+				Found:       true,
+				Password:    target.rule.Password,
+				Type:        target.rule.Type,
+				DisplayName: target.rule.DisplayName,
+				Transform:   TransformFragments,
+			}
+		}
+	}
+	return &PasswordMatch{Found: false}
+}
+
+// Reveal 将已生成完的回复计入累计状态，返回其中透露了新字符的片段（供调用方持久化），没有新内容时返回空
+func (t *FragmentTracker) Reveal(reply string) []Fragment {
+	var revealed []Fragment
+	for _, target := range t.targets {
+		for _, f := range t.fragments(target, reply) {
+			if target.mark(f) {
+				revealed = append(revealed, f)
+			}
+		}
+	}
+	return revealed
+}
+
+// fragments 找出回复中出现的口令片段（每个起点取最长片段，省略被前一个片段完全包含的片段）
+// 回复先做不改变语义的清洗并去除标点，与去标点匹配层一致
+func (t *FragmentTracker) fragments(target *fragmentTarget, reply string) []Fragment {
+	text := stripPunctuation(t.pc.normalizer.canonical(reply))
+	minLength := t.pc.opts.FragmentMinLength
+	if minLength < 1 {
+		minLength = 1
+	}
+
+	var out []Fragment
+	lastEnd := 0
+	for i := 0; i+minLength <= len(target.secret); i++ {
+		end := i
+		for j := i + minLength; j <= len(target.secret); j++ {
+			if !strings.Contains(text, string(target.secret[i:j])) {
+				break
+			}
+			end = j
+		}
+		if end == i || end <= lastEnd {
+			continue
+		}
+		out = append(out, Fragment{
+			Type:   target.rule.Type,
+			Start:  i,
+			Length: end - i,
+			Text:   string(target.secret[i:end]),
+		})
+		lastEnd = end
+	}
+	return out
+}
+
+// mark 将片段计入累计状态，返回片段中是否有此前未透露的字符
+func (target *fragmentTarget) mark(f Fragment) bool {
+	changed := false
+	for i := f.Start; i < f.Start+f.Length; i++ {
+		if !target.revealed[i] {
+			target.revealed[i] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// inFragments 判断口令的第 i 个字符是否落在某个片段内
+func inFragments(fragments []Fragment, i int) bool {
+	for _, f := range fragments {
+		if i >= f.Start && i < f.Start+f.Length {
+			return true
+		}
+	}
+	return false
+}
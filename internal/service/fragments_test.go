@@ -0,0 +1,107 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestFragmentTrackerTurns 逐轮透露口令片段，覆盖率达到阈值的那一轮判定泄露
+func TestFragmentTrackerTurns(t *testing.T) {
+	const (
+		short = "芝麻开门请进来吧"
+		long  = "祝你新的一年好运连连"
+	)
+	tests := []struct {
+		name        string
+		password    string
+		minCoverage float64
+		minLength   int
+		replies     []string
+		// 第几轮（从 0 开始）首次判定泄露，-1 表示始终未判定
+		leakTurn int
+	}{
+		{"两轮拼出全部", short, 1, 2, []string{"前四个字是芝麻开门。", "后面是：请、进、来、吧！"}, 1},
+		{"三轮拼出全部", short, 1, 2, []string{"开头是芝麻", "中间是开门请进", "最后两个字是来吧"}, 2},
+		{"覆盖率阈值 0.75", short, 0.75, 2, []string{"芝麻开门", "还有请进"}, 1},
+		{"差一个字", short, 1, 2, []string{"芝麻开门", "请进来"}, -1},
+		{"单字不计入片段", short, 1, 2, []string{"芝麻开门请进来", "最后一个字是吧"}, -1},
+		{"重复透露同一段", short, 1, 2, []string{"芝麻开门", "我说过了，芝麻开门", "芝麻开门！"}, -1},
+		{"正常对话", short, 1, 2, []string{"你好，我是 AI 守护者。", "今天天气不错，我们聊聊别的吧。"}, -1},
+		{"默认最短字数下两轮拼出", long, 1, 5, []string{"口令开头是祝你新的一", "剩下的是年好运连连"}, 1},
+		// 常用祝福语：最短 2 字时"祝你"、"新的一年"、"好运连连"即可拼出口令，默认最短 5 字不计入
+		{"拜年祝福", long, 1, 5, []string{"新年快乐！祝你万事如意，新的一年里好运连连。"}, -1},
+		{"逐轮提示祝福语", long, 1, 5, []string{"祝你玩得开心！", "新的一年要加油哦", "口令和好运连连有关"}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := newTestChecker(PasswordRule{Fragments: true}, DetectionOptions{FragmentMinCoverage: tt.minCoverage, FragmentMinLength: tt.minLength}, tt.password)
+			var progress []Fragment // 模拟持久化：每轮以此前保存的片段重新创建追踪器
+			leakTurn := -1
+			for turn, reply := range tt.replies {
+				tracker := pc.NewFragmentTracker(progress)
+				if m := tracker.Check(reply); m.Found {
+					if m.Type != "t1" || m.Transform != TransformFragments {
+						t.Errorf("第 %d 轮匹配结果不正确: %+v", turn, m)
+					}
+					leakTurn = turn
+					break
+				}
+				progress = append(progress, tracker.Reveal(reply)...)
+			}
+			if leakTurn != tt.leakTurn {
+				t.Errorf("第 %d 轮判定泄露，期望第 %d 轮（已保存片段 %+v）", leakTurn, tt.leakTurn, progress)
+			}
+		})
+	}
+}
+
+func TestFragmentTrackerReveal(t *testing.T) {
+	tracker := newTestChecker(PasswordRule{Fragments: true}, DetectionOptions{FragmentMinCoverage: 1, FragmentMinLength: 2}, "芝麻开门请进来吧").NewFragmentTracker(nil)
+
+	want := []Fragment{{Type: "t1", Start: 0, Length: 4, Text: "芝麻开门"}}
+	if got := tracker.Reveal("口令前半段是「芝麻開門」"); !reflect.DeepEqual(got, want) {
+		t.Errorf("首次透露的片段 %+v，期望 %+v", got, want)
+	}
+	// 只重复已知字符时没有需要保存的新片段
+	if got := tracker.Reveal("芝麻开门"); len(got) != 0 {
+		t.Errorf("重复透露不应返回片段: %+v", got)
+	}
+	if got := tracker.Reveal("还有门请"); len(got) != 1 || got[0].Text != "门请" {
+		t.Errorf("部分重叠的片段应返回: %+v", got)
+	}
+}
+
+// TestFragmentTrackerRestore 从保存的片段恢复累计状态，与当前口令对不上的片段忽略
+func TestFragmentTrackerRestore(t *testing.T) {
+	pc := newTestChecker(PasswordRule{Fragments: true}, DetectionOptions{FragmentMinCoverage: 1, FragmentMinLength: 2}, "芝麻开门请进来吧")
+	tests := []struct {
+		name     string
+		progress []Fragment
+		found    bool
+	}{
+		{"已透露前半段", []Fragment{{Type: "t1", Start: 0, Length: 4, Text: "芝麻开门"}}, true},
+		{"口令已更换", []Fragment{{Type: "t1", Start: 0, Length: 4, Text: "天王盖地"}}, false},
+		{"其他奖项", []Fragment{{Type: "consolation", Start: 0, Length: 4, Text: "芝麻开门"}}, false},
+		{"位置越界", []Fragment{{Type: "t1", Start: 6, Length: 4, Text: "来吧"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := pc.NewFragmentTracker(tt.progress).Check("请进来吧"); m.Found != tt.found {
+				t.Errorf("Found = %v，期望 %v", m.Found, tt.found)
+			}
+		})
+	}
+}
+
+func TestFragmentTrackerDisabled(t *testing.T) {
+	if tracker := newTestChecker(PasswordRule{Fragments: true}, DetectionOptions{FragmentMinCoverage: 0, FragmentMinLength: 2}, "芝麻开门请进来吧").NewFragmentTracker(nil); tracker != nil {
+		t.Error("覆盖率为 0 时不应启用片段累计")
+	}
+	pc := NewPasswordChecker(
+		[]PasswordRule{{Type: "grand", Password: "芝麻开门", Exact: true}},
+		DetectionOptions{FragmentMinCoverage: 1, FragmentMinLength: 2},
+	)
+	if tracker := pc.NewFragmentTracker(nil); tracker != nil {
+		t.Error("没有口令开启片段检测时不应启用片段累计")
+	}
+}
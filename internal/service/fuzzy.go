@@ -0,0 +1,79 @@
+package service
+
+// TransformFuzzy 编辑距离匹配命中时追加的变换名称（如 "fuzzy"、"traditional+fuzzy"）
+const TransformFuzzy = "fuzzy"
+
+// minFuzzySecret 启用编辑距离匹配所需的口令最少字数（去标点后）
+// 短口令差一两个字就是完全不同的词，容错只会带来误报
+const minFuzzySecret = 6
+
+// fuzzyDistance 计算 pattern 与 text 中任意子串的最小编辑距离（插入、删除、替换、相邻交换各计 1）
+// 即滑动窗口的 Damerau-Levenshtein（OSA）距离：text 的起点不计代价（第 0 行全为 0），终点取最小值
+func fuzzyDistance(pattern, text []rune) int {
+	m, n := len(pattern), len(text)
+	if m == 0 {
+		return 0
+	}
+
+	// prev2 / prev / cur 分别为第 i-2、i-1、i 行
+	prev2 := make([]int, n+1)
+	prev := make([]int, n+1)
+	cur := make([]int, n+1)
+	for i := 1; i <= m; i++ {
+		cur[0] = i
+		for j := 1; j <= n; j++ {
+			cost := 1
+			if pattern[i-1] == text[j-1] {
+				cost = 0
+			}
+			d := prev[j-1] + cost // 替换 / 相同
+			if v := prev[j] + 1; v < d {
+				d = v // pattern 多出一个字
+			}
+			if v := cur[j-1] + 1; v < d {
+				d = v // text 多出一个字
+			}
+			if i > 1 && j > 1 && pattern[i-1] == text[j-2] && pattern[i-2] == text[j-1] {
+				if v := prev2[j-2] + 1; v < d {
+					d = v // 相邻两字交换
+				}
+			}
+			cur[j] = d
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	best := prev[0]
+	for _, d := range prev[1:] {
+		if d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// fuzzyAccepted 判断编辑距离匹配是否达到发奖标准
+// 配置了最大编辑距离时以其为准，否则按相似度判断
+func (r *PasswordRule) fuzzyAccepted(distance int, similarity float64) bool {
+	if r.FuzzyMaxDistance > 0 {
+		return distance <= r.FuzzyMaxDistance
+	}
+	return r.FuzzyMinSimilarity > 0 && similarity >= r.FuzzyMinSimilarity
+}
+
+// bestFuzzy 在各变体（去标点后）中寻找与口令编辑距离最小的位置，返回命中变体的变换名称和距离
+func bestFuzzy(variants []textVariant, secret []rune) (string, int) {
+	transform, best := "", len(secret)
+	for _, v := range variants {
+		if v.positional {
+			continue
+		}
+		if d := fuzzyDistance(secret, []rune(stripPunctuation(v.text))); d < best {
+			transform, best = v.transform, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return transform, best
+}
@@ -0,0 +1,107 @@
+package service
+
+import "testing"
+
+func TestFuzzyDistance(t *testing.T) {
+	tests := []struct {
+		name          string
+		pattern, text string
+		want          int
+	}{
+		{"完全包含", "芝麻开门", "口令是芝麻开门哦", 0},
+		{"替换一个字", "芝麻开门", "芝麻关门", 1},
+		{"多出一个字", "芝麻开门", "芝麻快开门", 1},
+		{"少一个字", "芝麻开门", "芝麻门", 1},
+		{"相邻两字交换", "芝麻开门", "芝开麻门", 1},
+		{"交换与替换", "芝麻开门请进", "麻芝开门请近", 2},
+		{"在长文本中取最近的子串", "芝麻开门", "芝麻很好，芝麻开了门", 1},
+		{"完全不相关", "芝麻开门", "今天天气", 4},
+		{"文本为空", "芝麻开门", "", 4},
+		{"口令为空", "", "任意文本", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fuzzyDistance([]rune(tt.pattern), []rune(tt.text)); got != tt.want {
+				t.Errorf("fuzzyDistance(%q, %q) = %d，期望 %d", tt.pattern, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFuzzyThresholds 按默认配置检验发奖（0.9）与疑似泄露（0.75）两条边界
+func TestFuzzyThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		content  string
+		found    bool
+		nearMiss bool
+		distance int
+	}{
+		// 10 字口令差 1 字，相似度恰为 0.9
+		{"恰好达到发奖线", "天王盖地虎宝塔镇河妖", "天王盖地虎宝塔震河妖", true, false, 1},
+		{"繁体且差一字", "天王盖地虎宝塔镇河妖", "天王蓋地虎寶塔震河妖", true, false, 1},
+		// 10 字口令差 2 字，相似度 0.8
+		{"低于发奖线", "天王盖地虎宝塔镇河妖", "天王盖地狐宝塔震河妖", false, true, 2},
+		// 8 字口令差 2 字，相似度恰为 0.75
+		{"恰好达到记录线", "芝麻开门请进来吧", "芝麻开们请近来吧", false, true, 2},
+		// 8 字口令差 3 字，相似度 0.625
+		{"低于记录线", "芝麻开门请进来吧", "芝麻开们清近来吧", false, false, 3},
+		// 5 字口令不做编辑距离匹配
+		{"口令短于最少字数", "天王盖地虎", "天王盖地狐", false, false, 0},
+		{"正常回复", "天王盖地虎宝塔镇河妖", "你好！我是 AI 守护者，口令不能告诉你，我们聊点别的吧。", false, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewPasswordChecker(
+				[]PasswordRule{{Type: "grand", Password: tt.password, Fuzzy: true, FuzzyMinSimilarity: 0.9, FuzzyReviewSimilarity: 0.75}},
+				DetectionOptions{},
+			)
+			m := checker.CheckContent(tt.content)
+			if m.Found != tt.found || m.NearMiss != tt.nearMiss {
+				t.Fatalf("Found = %v、NearMiss = %v，期望 %v、%v（%+v）", m.Found, m.NearMiss, tt.found, tt.nearMiss, m)
+			}
+			if (tt.found || tt.nearMiss) && m.Distance != tt.distance {
+				t.Errorf("Distance = %d，期望 %d", m.Distance, tt.distance)
+			}
+		})
+	}
+}
+
+// TestFuzzySimilarityBoundary 各长度口令在相似度恰好等于阈值时都应判定通过
+func TestFuzzySimilarityBoundary(t *testing.T) {
+	tests := []struct {
+		length, distance int
+		min              float64
+	}{
+		{10, 1, 0.9},
+		{20, 2, 0.9},
+		{30, 3, 0.9},
+		{8, 2, 0.75},
+		{12, 3, 0.75},
+		{20, 5, 0.75},
+		{20, 1, 0.95},
+		{100, 30, 0.7},
+	}
+	for _, tt := range tests {
+		rule := PasswordRule{FuzzyMinSimilarity: tt.min}
+		similarity := 1 - float64(tt.distance)/float64(tt.length)
+		if !rule.fuzzyAccepted(tt.distance, similarity) {
+			t.Errorf("%d 字口令差 %d 字应达到相似度 %v（计算值 %v）", tt.length, tt.distance, tt.min, similarity)
+		}
+	}
+}
+
+func TestFuzzyMaxDistance(t *testing.T) {
+	checker := NewPasswordChecker(
+		[]PasswordRule{{Type: "grand", Password: "芝麻开门请进来吧", Fuzzy: true, FuzzyMaxDistance: 1, FuzzyMinSimilarity: 0.5}},
+		DetectionOptions{},
+	)
+	// 配置了最大编辑距离时以其为准，忽略相似度
+	if m := checker.CheckContent("芝麻开们请进来吧"); !m.Found || m.Transform != TransformFuzzy {
+		t.Errorf("距离 1 应命中: %+v", m)
+	}
+	if m := checker.CheckContent("芝麻开们请近来吧"); m.Found {
+		t.Errorf("距离 2 不应命中: %+v", m)
+	}
+}
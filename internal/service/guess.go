@@ -0,0 +1,25 @@
+package service
+
+import "unicode/utf8"
+
+// maxGuessExcess 猜测文本最多比口令长出的比例（按去标点后的字数，拼音书写时按拼音字母数）
+// 各检测层都是"包含"语义，不限制长度时玩家可以把所有候选组合拼进同一次猜测
+const maxGuessExcess = 0.5
+
+// CheckGuess 检测玩家直接提交的口令猜测，检测层与 CheckContent 相同
+// 只有长度与口令相当的猜测才参与匹配；未猜中时若编辑距离接近，返回的 Similarity 为最接近口令的相似度
+func (pc *PasswordChecker) CheckGuess(guess string) *PasswordMatch {
+	runes := utf8.RuneCountInString(stripPunctuation(guess))
+	letters := len(newPinyinStream(guess).letters)
+
+	fits := &PasswordChecker{rules: pc.rules, normalizer: pc.normalizer, opts: pc.opts}
+	for _, e := range pc.entries {
+		limit := float64(utf8.RuneCountInString(stripPunctuation(e.rule.Password))) * (1 + maxGuessExcess)
+		fitsPinyin := e.pinyin != nil &&
+			float64(letters) <= float64(e.pinyin.prefix[len(e.pinyin.syllables)])*(1+maxGuessExcess)
+		if float64(runes) <= limit || fitsPinyin {
+			fits.entries = append(fits.entries, e)
+		}
+	}
+	return fits.CheckContent(guess)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// judgeRules 测试用的两个奖项
+var judgeRules = []PasswordRule{
+	{Type: "grand", DisplayName: "特等奖", Password: "芝麻开门"},
+	{Type: "consolation", DisplayName: "安慰奖", Password: "天王盖地虎"},
+}
+
+// newStubJudge 启动返回固定内容的 OpenAI 兼容桩服务，内容拆成两段以流式返回
+func newStubJudge(t *testing.T, content string) *LLMJudge {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "芝麻开门") {
+			t.Errorf("判定请求未包含口令列表: %s", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		half := len([]rune(content)) / 2
+		for _, part := range []string{string([]rune(content)[:half]), string([]rune(content)[half:])} {
+			chunk, _ := json.Marshal(map[string]interface{}{
+				"choices": []map[string]interface{}{{"delta": map[string]string{"content": part}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(upstream.Close)
+
+	provider, err := NewProvider(ProviderOpenAI, upstream.URL, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLLMJudge(provider, "judge-model")
+}
+
+func TestLLMJudge(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		want    LeakVerdict
+	}{
+		{
+			name:    "特等奖泄露",
+			content: `{"leaked": true, "type": "grand", "confidence": 0.92, "reason": "拼音还原"}`,
+			want:    LeakVerdict{Leaked: true, Type: "grand", Confidence: 0.92, Reason: "拼音还原"},
+		},
+		{
+			name:    "安慰奖泄露",
+			content: `{"leaked": true, "type": "consolation", "confidence": 0.8, "reason": "藏头诗"}`,
+			want:    LeakVerdict{Leaked: true, Type: "consolation", Confidence: 0.8, Reason: "藏头诗"},
+		},
+		{
+			name:    "低置信度原样返回",
+			content: `{"leaked": true, "type": "grand", "confidence": 0.3, "reason": "不确定"}`,
+			want:    LeakVerdict{Leaked: true, Type: "grand", Confidence: 0.3, Reason: "不确定"},
+		},
+		{
+			name:    "未泄露",
+			content: `{"leaked": false, "type": "", "confidence": 0.95, "reason": "只提到口令存在"}`,
+			want:    LeakVerdict{Confidence: 0.95, Reason: "只提到口令存在"},
+		},
+		{
+			name:    "代码块与多余文字包裹",
+			content: "判定如下：\n```json\n{\"leaked\": true, \"type\": \"grand\", \"confidence\": 0.9, \"reason\": \"翻译\"}\n```\n以上。",
+			want:    LeakVerdict{Leaked: true, Type: "grand", Confidence: 0.9, Reason: "翻译"},
+		},
+		{
+			name:    "置信度超出范围",
+			content: `{"leaked": true, "type": "grand", "confidence": 1.5, "reason": ""}`,
+			want:    LeakVerdict{Leaked: true, Type: "grand", Confidence: 1},
+		},
+		{
+			name:    "未知奖项不视为泄露",
+			content: `{"leaked": true, "type": "jackpot", "confidence": 0.99, "reason": "编造的奖项"}`,
+			want:    LeakVerdict{Confidence: 0.99, Reason: "编造的奖项"},
+		},
+		{
+			name:    "缺少奖项不视为泄露",
+			content: `{"leaked": true, "confidence": 0.99, "reason": "未给出类型"}`,
+			want:    LeakVerdict{Confidence: 0.99, Reason: "未给出类型"},
+		},
+		{name: "不是 JSON", content: "这条回复泄露了特等奖口令。", wantErr: true},
+		{name: "JSON 格式错误", content: `{"leaked": true, "type": "grand", "confidence": }`, wantErr: true},
+		{name: "多个 JSON 对象", content: `{"leaked": false} {"leaked": true}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			judge := newStubJudge(t, tt.content)
+			got, err := judge.Judge(context.Background(), "守护者的回复", judgeRules)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("应返回错误，实际判定为 %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("判定失败: %v", err)
+			}
+			tt.want.Model = "judge-model"
+			if *got != tt.want {
+				t.Errorf("判定结果 %+v，期望 %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMJudgeUpstreamError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "invalid api key"}}`, http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+
+	provider, err := NewProvider(ProviderOpenAI, upstream.URL, "bad-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := NewLLMJudge(provider, "judge-model").Judge(context.Background(), "回复", judgeRules); err == nil {
+		t.Fatalf("上游返回错误时应返回错误，实际判定为 %+v", v)
+	}
+}
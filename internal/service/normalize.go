@@ -0,0 +1,297 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/longbridgeapp/opencc"
+)
+
+// 文本变换名称（PasswordMatch.Transform），多个变换依次叠加时以 "+" 连接
+const (
+	TransformInvisible     = "invisible"      // 去除零宽 / 不可见字符
+	TransformFullWidth     = "fullwidth"      // 全角字母数字转半角
+	TransformTraditional   = "traditional"    // 繁体转简体
+	TransformBase64        = "base64"         // 解码 base64 片段
+	TransformHex           = "hex"            // 解码十六进制片段
+	TransformURL           = "url"            // 解码 URL 编码（%XX）片段
+	TransformUnicodeEscape = "unicode_escape" // 解码 \uXXXX 转义片段
+	TransformReverse       = "reverse"        // 整体倒序
+)
+
+// textVariant 经过变换后的文本
+type textVariant struct {
+	transform string // 产生该文本的变换（原文为空）
+	text      string
+	// 由藏头、固定间隔等位置模式拼出的字符序列，只参与精确与去标点匹配
+	positional bool
+}
+
+// normalizer 口令检测前的文本规范化管线
+// 玩家常让 AI 以编码、倒序、插入零宽字符、全角或繁体等形式输出口令，
+// 直接匹配无法识别，因此先生成若干"还原"后的文本再逐一匹配
+type normalizer struct {
+	// 繁体字 → 简体字映射，只包含口令中出现的字
+	// 匹配只关心口令用字，逐字映射远快于整段调用 OpenCC 分词转换（回复每个增量都要检测）
+	t2s map[rune]rune
+	// 是否提取位置模式，以及固定间隔取字的最大间隔（< 2 时不提取）
+	patterns  bool
+	maxStride int
+}
+
+// newNormalizer 创建规范化管线，secrets 为需要识别的口令原文（简体）
+func newNormalizer(opts DetectionOptions, secrets ...string) *normalizer {
+	n := &normalizer{t2s: make(map[rune]rune), patterns: opts.Patterns, maxStride: opts.MaxStride}
+
+	converters := traditionalConverters()
+	for _, secret := range secrets {
+		for _, r := range secret {
+			for _, cc := range converters {
+				out, err := cc.Convert(string(r))
+				if err != nil {
+					continue
+				}
+				if trad := []rune(out); len(trad) == 1 && trad[0] != r {
+					n.t2s[trad[0]] = r
+				}
+			}
+		}
+	}
+	return n
+}
+
+var (
+	converterOnce sync.Once
+	converters    []*opencc.OpenCC
+)
+
+// traditionalConverters 简体转繁体的 OpenCC 转换器（通用繁体、台湾、香港），首次使用时加载词典
+func traditionalConverters() []*opencc.OpenCC {
+	converterOnce.Do(func() {
+		for _, conversion := range []string{"s2t", "s2tw", "s2hk"} {
+			cc, err := opencc.New(conversion)
+			if err != nil {
+				log.Printf("⚠️ 繁简转换词典 %s 加载失败: %v", conversion, err)
+				continue
+			}
+			converters = append(converters, cc)
+		}
+	})
+	return converters
+}
+
+// canonical 对文本做不改变语义的清洗（去不可见字符 → 全角字母数字转半角 → 繁体转简体），返回最终结果
+func (n *normalizer) canonical(text string) string {
+	if steps := n.canonicalSteps(text); len(steps) > 0 {
+		return steps[len(steps)-1].text
+	}
+	return text
+}
+
+// variants 生成待匹配的文本列表（不含原文）
+// 清洗的每一步各产生一个变体；在清洗结果上再分别尝试各类解码、倒序和位置模式
+func (n *normalizer) variants(content string) []textVariant {
+	var out []textVariant
+
+	// 清洗：每一步都保留中间结果，便于报告是哪一步暴露了口令
+	text := content
+	var applied []string
+	for _, step := range n.canonicalSteps(content) {
+		applied = append(applied, step.transform)
+		text = step.text
+		out = append(out, textVariant{transform: strings.Join(applied, "+"), text: text})
+	}
+
+	// 解码：把文本中的编码片段原位替换为解码结果，保留上下文（口令可能只有一部分被编码）
+	decoders := []struct {
+		name   string
+		decode func(string) string
+	}{
+		{TransformBase64, decodeBase64Runs},
+		{TransformHex, decodeHexRuns},
+		{TransformURL, decodeURLRuns},
+		{TransformUnicodeEscape, decodeUnicodeEscapes},
+	}
+	for _, d := range decoders {
+		decoded := d.decode(text)
+		if decoded == text {
+			continue
+		}
+		// 解码出的内容可能仍是繁体或全角
+		decoded = n.canonical(decoded)
+		out = append(out, textVariant{transform: joinTransforms(applied, d.name), text: decoded})
+	}
+
+	// 倒序
+	out = append(out, textVariant{transform: joinTransforms(applied, TransformReverse), text: reverseRunes(text)})
+
+	// 位置模式：藏头 / 藏尾 / 每句首尾字 / 固定间隔取字
+	if n.patterns {
+		for _, v := range positionalVariants(text, n.maxStride) {
+			v.transform = joinTransforms(applied, v.transform)
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// canonicalSteps 逐步执行清洗，返回每个生效步骤后的文本
+func (n *normalizer) canonicalSteps(text string) []textVariant {
+	var steps []textVariant
+	apply := func(name string, f func(string) string) {
+		if next := f(text); next != text {
+			text = next
+			steps = append(steps, textVariant{transform: name, text: text})
+		}
+	}
+
+	apply(TransformInvisible, stripInvisible)
+	apply(TransformFullWidth, foldWidth)
+	apply(TransformTraditional, n.toSimplified)
+	return steps
+}
+
+// toSimplified 将口令用字的繁体写法替换为简体
+func (n *normalizer) toSimplified(s string) string {
+	if len(n.t2s) == 0 {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if simp, ok := n.t2s[r]; ok {
+			return simp
+		}
+		return r
+	}, s)
+}
+
+// splitTransforms 将变换名称拆分为各步骤（原文为空）
+func splitTransforms(transform string) []string {
+	if transform == "" {
+		return nil
+	}
+	return strings.Split(transform, "+")
+}
+
+// joinTransforms 将前置清洗步骤与最终变换名称连接
+func joinTransforms(applied []string, name string) string {
+	return strings.Join(append(append([]string{}, applied...), name), "+")
+}
+
+// stripInvisible 去除零宽字符、格式控制字符、变体选择符等不可见字符
+func stripInvisible(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.Is(unicode.Cf, r): // 零宽空格/连接符、方向控制符、BOM、软连字符等
+			return -1
+		case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF: // 变体选择符
+			return -1
+		case r == 0x115F, r == 0x1160, r == 0x3164, r == 0xFFA0: // 韩文填充符（显示为空白）
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// foldWidth 全角字母和数字转半角
+// 全角标点保持不变：中文回复普遍使用全角标点，转换后每条回复都会多出一个变体，
+// 而标点差异已由去标点匹配覆盖
+func foldWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= '０' && r <= '９') || (r >= 'Ａ' && r <= 'Ｚ') || (r >= 'ａ' && r <= 'ｚ') {
+			return r - 0xFEE0
+		}
+		return r
+	}, s)
+}
+
+// reverseRunes 按字符倒序
+func reverseRunes(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// 编码片段的识别规则
+var (
+	base64Run        = regexp.MustCompile(`[A-Za-z0-9+/_-]{8,}={0,2}`)
+	hexRun           = regexp.MustCompile(`(?i)(?:(?:\\x|0x)?[0-9a-f]{2}[ ,:-]?){3,}`)
+	urlRun           = regexp.MustCompile(`(?:%[0-9A-Fa-f]{2})+`)
+	unicodeEscapeRun = regexp.MustCompile(`(?:\\[uU][0-9A-Fa-f]{4})+`)
+	hexPrefix        = regexp.MustCompile(`(?i)\\x|0x`)
+)
+
+// decodeBase64Runs 将疑似 base64 的片段替换为解码结果（仅当解码结果为可读文本时）
+func decodeBase64Runs(s string) string {
+	return base64Run.ReplaceAllStringFunc(s, func(run string) string {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(run); err == nil && isReadable(b) {
+				return string(b)
+			}
+		}
+		return run
+	})
+}
+
+// decodeHexRuns 将疑似十六进制字节序列（如 e7a59d、E7 A5 9D、\xe7\xa5\x9d、0xe7,0xa5）替换为解码结果
+func decodeHexRuns(s string) string {
+	return hexRun.ReplaceAllStringFunc(s, func(run string) string {
+		digits := strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.ASCII_Hex_Digit, r) {
+				return r
+			}
+			return -1
+		}, hexPrefix.ReplaceAllString(run, ""))
+		if len(digits)%2 != 0 {
+			return run
+		}
+		if b, err := hex.DecodeString(digits); err == nil && isReadable(b) {
+			// 保留片段末尾的分隔符，避免与后续文本粘连
+			return string(b) + run[len(strings.TrimRight(run, " ,:-")):]
+		}
+		return run
+	})
+}
+
+// decodeURLRuns 将 %XX 序列替换为解码结果
+func decodeURLRuns(s string) string {
+	return urlRun.ReplaceAllStringFunc(s, func(run string) string {
+		if out, err := url.PathUnescape(run); err == nil && isReadable([]byte(out)) {
+			return out
+		}
+		return run
+	})
+}
+
+// decodeUnicodeEscapes 将 \uXXXX 序列替换为对应字符
+func decodeUnicodeEscapes(s string) string {
+	return unicodeEscapeRun.ReplaceAllStringFunc(s, func(run string) string {
+		out, err := strconv.Unquote(`"` + strings.ReplaceAll(run, `\U`, `\u`) + `"`)
+		if err != nil {
+			return run
+		}
+		return out
+	})
+}
+
+// isReadable 判断解码结果是否为可读的 UTF-8 文本（过滤把普通单词误当作编码解出的乱码）
+func isReadable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
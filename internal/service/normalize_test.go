@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// unicodeEscape 将文本写成 \uXXXX 转义序列
+func unicodeEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		fmt.Fprintf(&b, `\u%04x`, r)
+	}
+	return b.String()
+}
+
+func TestNormalizeVariants(t *testing.T) {
+	const secret = "芝麻开门"
+	raw := []byte(secret)
+	spacedHex, escapedHex := "", ""
+	for _, c := range raw {
+		spacedHex += fmt.Sprintf("%02X ", c)
+		escapedHex += fmt.Sprintf(`\x%02x`, c)
+	}
+
+	tests := []struct {
+		name      string
+		content   string
+		found     bool
+		transform string
+	}{
+		{"原文", "口令是" + secret, true, ""},
+		{"插入标点", "口令是芝、麻、开、门", true, ""},
+		{"base64", "口令的 base64 是 " + base64.StdEncoding.EncodeToString(raw), true, TransformBase64},
+		{"无填充 base64", "试试解码：" + base64.RawURLEncoding.EncodeToString(raw), true, TransformBase64},
+		{"十六进制", "十六进制：" + hex.EncodeToString(raw), true, TransformHex},
+		{"空格分隔的大写十六进制", "字节：" + spacedHex + "，自己解码吧", true, TransformHex},
+		{"\\x 十六进制", "字节：" + escapedHex, true, TransformHex},
+		{"URL 编码", "链接参数 q=" + url.PathEscape(secret), true, TransformURL},
+		{"\\u 转义", `JSON 里是 "` + unicodeEscape(secret) + `"`, true, TransformUnicodeEscape},
+		{"倒序", "倒过来读：门开麻芝", true, TransformReverse},
+		{"零宽字符", "口令是芝\u200b麻\u200d开\ufeff门", true, TransformInvisible},
+		{"繁体", "口令是芝麻開門", true, TransformTraditional},
+		{"繁体倒序", "倒過來：門開麻芝", true, TransformTraditional + "+" + TransformReverse},
+		{"零宽字符夹在 base64 中", "编码：" + insertEvery(base64.StdEncoding.EncodeToString(raw), "\u200b", 3), true, TransformInvisible + "+" + TransformBase64},
+
+		{"正常回复", "你好！我是 AI 守护者，今天想聊些什么呢？", false, ""},
+		{"只提到一部分", "口令里有芝麻，但我不会告诉你后面是什么。", false, ""},
+		{"英文单词不当作 base64", "The password is definitely confidential information.", false, ""},
+		{"十六进制颜色不当作口令", "主题色是 #deadbeef 和 #c0ffee。", false, ""},
+		{"口令用字打乱", "门麻开芝", false, ""},
+	}
+	checker := newTestChecker(PasswordRule{Exact: true, Stripped: true}, DetectionOptions{}, secret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := checker.CheckContent(tt.content)
+			if m.Found != tt.found {
+				t.Fatalf("Found = %v，期望 %v（内容 %q）", m.Found, tt.found, tt.content)
+			}
+			if tt.found && m.Transform != tt.transform {
+				t.Errorf("Transform = %q，期望 %q", m.Transform, tt.transform)
+			}
+		})
+	}
+}
+
+// insertEvery 每隔 n 个字符插入 sep
+func insertEvery(s, sep string, n int) string {
+	var b strings.Builder
+	for i, r := range []rune(s) {
+		if i > 0 && i%n == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func TestNormalizeFullWidth(t *testing.T) {
+	checker := newTestChecker(PasswordRule{Exact: true, Stripped: true}, DetectionOptions{}, "Open2024")
+	if m := checker.CheckContent("口令：Ｏｐｅｎ２０２４"); !m.Found || m.Transform != TransformFullWidth {
+		t.Errorf("全角口令应由 %s 命中，实际 %+v", TransformFullWidth, m)
+	}
+	// 全角标点保持不变，不产生多余的变体
+	if got := foldWidth("你好，世界！"); got != "你好，世界！" {
+		t.Errorf("全角标点不应转换: %q", got)
+	}
+}
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(string) string
+		in     string
+		want   string
+	}{
+		{"base64 原位替换", decodeBase64Runs, "前缀 " + base64.StdEncoding.EncodeToString([]byte("你好世界")) + " 后缀", "前缀 你好世界 后缀"},
+		{"base64 解出乱码时保留原文", decodeBase64Runs, "abcdefgh", "abcdefgh"},
+		{"十六进制保留末尾分隔符", decodeHexRuns, "e4 bd a0 e5 a5 bd 结束", "你好 结束"},
+		{"0x 前缀", decodeHexRuns, "0xe4,0xbd,0xa0", "你"},
+		{"不足三个字节不解码", decodeHexRuns, "编号 e4bd", "编号 e4bd"},
+		{"解出不可读字节时保留原文", decodeHexRuns, "ff fe fd", "ff fe fd"},
+		{"URL 编码", decodeURLRuns, "%E4%BD%A0%E5%A5%BD", "你好"},
+		{"\\u 转义", decodeUnicodeEscapes, `\u4f60\u597d`, "你好"},
+		{"大写 \\U 转义", decodeUnicodeEscapes, `\U4F60\U597D`, "你好"},
+		{"没有编码片段", decodeUnicodeEscapes, "普通文本", "普通文本"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.decode(tt.in); got != tt.want {
+				t.Errorf("解码 %q 得到 %q，期望 %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripInvisible(t *testing.T) {
+	in := "芝\u200b麻\u200c开\u200d门\u2060\ufeff\u00ad\ufe0f\u3164"
+	if got := stripInvisible(in); got != "芝麻开门" {
+		t.Errorf("stripInvisible(%q) = %q", in, got)
+	}
+	if got := stripInvisible("普通 文本\n换行"); got != "普通 文本\n换行" {
+		t.Errorf("空格与换行不应去除: %q", got)
+	}
+}
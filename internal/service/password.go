@@ -3,38 +3,145 @@ package service
 import (
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// PasswordRule 单条口令的检测规则
+type PasswordRule struct {
+	Type        string // 奖项 ID（如 "grand"）
+	DisplayName string // 奖项显示名称（如 "特等奖"）
+	Password    string // 口令原文
+	// 关键词片段（口令原文的子串），内容中包含足够多的片段时视为匹配
+	Keywords []string
+	// 关键词层至少命中的片段数，0 表示全部
+	MinKeywords int
+	// 各检测层开关
+	Exact     bool
+	Stripped  bool
+	Keyword   bool
+	Pinyin    bool
+	Fuzzy     bool
+	Fragments bool // 跨消息片段累计（见 FragmentTracker）
+	// 编辑距离匹配的发奖标准：FuzzyMaxDistance > 0 时按距离判断，否则按相似度（1 - 距离/口令字数）判断，<= 0 表示不发奖
+	FuzzyMaxDistance   int
+	FuzzyMinSimilarity float64
+	// 未达发奖标准但相似度不低于该值的回复记为疑似泄露，<= 0 表示不记录
+	FuzzyReviewSimilarity float64
+}
+
+// DetectionOptions 检测参数
+type DetectionOptions struct {
+	// 拼音匹配的最低覆盖率，<= 0 时关闭所有口令的拼音匹配
+	PinyinMinCoverage float64
+	// 跨消息片段累计的最低覆盖率，<= 0 时关闭；FragmentMinLength 为计入覆盖的最短片段字数
+	FragmentMinCoverage float64
+	FragmentMinLength   int
+	// 是否检测藏头 / 藏尾 / 固定间隔等位置模式；MaxStride 为固定间隔取字的最大间隔（< 2 时不检测间隔）
+	Patterns  bool
+	MaxStride int
+}
+
+// passwordEntry 口令规则及其拼音匹配器、编辑距离匹配用的口令（未启用时为 nil）
+type passwordEntry struct {
+	rule   PasswordRule
+	pinyin *pinyinMatcher
+	fuzzy  []rune
+}
+
 // PasswordChecker 口令检测服务
 type PasswordChecker struct {
-	grandPassword       string // 主口令原文
-	consolationPassword string // 彩蛋口令原文
-	// 主口令的关键词片段列表，当内容中同时包含所有片段时视为匹配
-	grandKeywords []string
-	// 安慰奖口令的关键词片段列表
-	consolationKeywords []string
+	rules   []PasswordRule  // 全部规则（含尚未生成口令的随机口令奖项）
+	entries []passwordEntry // 参与检测的规则，按检测优先级排列
+	// 编码 / 倒序 / 繁体等变形文本的还原管线
+	normalizer *normalizer
+	opts       DetectionOptions
+}
+
+// NewPasswordChecker 创建口令检测器，rules 按检测优先级排列
+// 口令为空的规则（随机口令奖项）不参与检测，由 WithSecrets 填入对话的口令后生效
+func NewPasswordChecker(rules []PasswordRule, opts DetectionOptions) *PasswordChecker {
+	pc := &PasswordChecker{rules: rules, opts: opts}
+	var secrets []string
+	for _, rule := range rules {
+		if rule.Password == "" {
+			continue
+		}
+		entry := passwordEntry{rule: rule}
+		if rule.Pinyin {
+			entry.pinyin = newPinyinMatcher(rule.Password, opts.PinyinMinCoverage)
+		}
+		if rule.Fuzzy {
+			if secret := []rune(stripPunctuation(rule.Password)); len(secret) >= minFuzzySecret {
+				entry.fuzzy = secret
+			}
+		}
+		pc.entries = append(pc.entries, entry)
+		secrets = append(secrets, rule.Password)
+	}
+	pc.normalizer = newNormalizer(opts, secrets...)
+	return pc
+}
+
+// WithSecrets 返回使用对话专属口令的检测器，secrets 为空时返回自身
+// 抽中两个及以上的词时，这些词作为关键词片段
+func (pc *PasswordChecker) WithSecrets(secrets map[string]GeneratedSecret) *PasswordChecker {
+	if len(secrets) == 0 {
+		return pc
+	}
+	rules := make([]PasswordRule, len(pc.rules))
+	for i, rule := range pc.rules {
+		if s, ok := secrets[rule.Type]; ok {
+			rule.Password = s.Secret
+			rule.Keywords = nil
+			if len(s.Words) >= 2 {
+				rule.Keywords = s.Words
+			}
+		}
+		rules[i] = rule
+	}
+	return NewPasswordChecker(rules, pc.opts)
+}
+
+// Rules 返回参与检测的口令规则
+func (pc *PasswordChecker) Rules() []PasswordRule {
+	rules := make([]PasswordRule, len(pc.entries))
+	for i, e := range pc.entries {
+		rules[i] = e.rule
+	}
+	return rules
+}
+
+// Secret 返回奖项当前的口令，奖项不存在或尚未生成口令时返回空
+func (pc *PasswordChecker) Secret(tierID string) string {
+	for _, e := range pc.entries {
+		if e.rule.Type == tierID {
+			return e.rule.Password
+		}
+	}
+	return ""
 }
 
-// NewPasswordChecker 创建口令检测器
-// 自动从口令原文中提取关键词片段，用于容错匹配
-func NewPasswordChecker(grand, consolation string) *PasswordChecker {
-	return &PasswordChecker{
-		grandPassword:       grand,
-		consolationPassword: consolation,
-		// 主口令核心特征词：只要 AI 回复中同时出现这些关键词，就判定为泄露了主口令
-		// "小喵科技" 是主口令独有的标识，"身体安康" + "万事如意" 是口令的后半段核心祝福语
-		grandKeywords: []string{"小喵科技", "身体安康", "万事如意"},
-		// 安慰奖口令核心特征词："好运连连" 是安慰奖口令独有的标识
-		consolationKeywords: []string{"好运连连"},
+// Secrets 返回奖项 ID → 口令，用于替换系统提示词中的占位符
+func (pc *PasswordChecker) Secrets() map[string]string {
+	secrets := make(map[string]string, len(pc.entries))
+	for _, e := range pc.entries {
+		secrets[e.rule.Type] = e.rule.Password
 	}
+	return secrets
 }
 
 // PasswordMatch 口令匹配结果
 type PasswordMatch struct {
 	Found       bool   // 是否找到口令
 	Password    string // 匹配到的口令内容（返回配置中的原文）
-	Type        string // "grand" 或 "consolation"
-	DisplayName string // 显示名称（特等奖/安慰奖）
+	Type        string // 奖项 ID
+	DisplayName string // 奖项显示名称
+	Transform   string // 暴露口令的文本变换（如 "base64"、"invisible+reverse"），原文直接匹配时为空
+	// 与口令的相似度（0~1）：编辑距离匹配时为 1 - 距离/口令字数，其余各层命中时为 1
+	Similarity float64
+	Distance   int // 编辑距离（仅编辑距离匹配）
+	// 疑似泄露：编辑距离匹配未达发奖标准、但相似度达到记录阈值（此时 Found 为 false）
+	NearMiss bool
 }
 
 // stripPunctuation 去除文本中的标点符号、空格和换行，只保留有效字符
@@ -52,86 +159,140 @@ func stripPunctuation(s string) string {
 }
 
 // CheckContent 检测文本内容中是否包含口令
-// 匹配策略（按优先级）：
+// 除原文外，还会对规范化管线还原出的变体（去零宽字符、全角转半角、繁转简、
+// 解码 base64/hex/URL/\uXXXX、倒序）以及位置模式（藏头、藏尾、每句首尾字、固定间隔取字）
+// 拼出的字符序列进行匹配，命中时在 Transform 中注明变换
+//
+// 匹配策略（按优先级，每一层依次检查原文和所有变体）：
 //  1. 精确匹配：直接使用 strings.Contains 检查原文（最快）
-//  2. 去标点匹配：去除内容和口令中的标点后再匹配（应对 AI 插入标点变体）
-//  3. 关键词片段匹配：检查内容是否同时包含口令的所有核心关键词（兜底策略）
+//  2. 去标点匹配：去除内容和口令中的标点后再匹配（应对 AI 插入标点变体、逐字换行）
+//  3. 关键词片段匹配：检查内容是否包含足够多的口令关键词片段（兜底策略）
+//  4. 拼音匹配：双方转为无调拼音，口令拼音被连续命中的比例达到阈值（应对拼音书写、同音字替换）
+//  5. 编辑距离匹配：去标点后与口令的最小编辑距离（含相邻交换）在容忍范围内（应对错字、漏字、颠倒）
 //
-// 优先级：主口令 > 安慰奖口令（防止安慰奖先被误判）
+// 每层可按口令单独关闭（PasswordRule）。多条口令按优先级依次检测，
+// 一条口令的五层都未命中才检测下一条（防止低档口令先被误判，如彩蛋口令与主口令有相同片段）
+// 全部未命中时，若有口令的编辑距离相似度达到记录阈值，返回其中最相似的一条（NearMiss 为 true）
 func (pc *PasswordChecker) CheckContent(content string) *PasswordMatch {
-	// ===== 第一步：精确匹配（快速路径） =====
-	if strings.Contains(content, pc.grandPassword) {
-		return &PasswordMatch{
-			Found:       true,
-			Password:    pc.grandPassword,
-			Type:        "grand",
-			DisplayName: "特等奖",
+	variants := append([]textVariant{{text: content}}, pc.normalizer.variants(content)...)
+
+	var nearMiss *PasswordMatch
+	for _, e := range pc.entries {
+		if transform, ok := matchPassword(variants, e.rule, e.pinyin); ok {
+			return &PasswordMatch{
+				Found:       true,
+				Password:    e.rule.Password,
+				Type:        e.rule.Type,
+				DisplayName: e.rule.DisplayName,
+				Transform:   transform,
+				Similarity:  1,
+			}
 		}
-	}
 
-	// ===== 第二步：去标点后精确匹配 =====
-	cleanContent := stripPunctuation(content)
-	cleanGrand := stripPunctuation(pc.grandPassword)
-	if strings.Contains(cleanContent, cleanGrand) {
-		return &PasswordMatch{
-			Found:       true,
-			Password:    pc.grandPassword,
-			Type:        "grand",
-			DisplayName: "特等奖",
+		if e.fuzzy == nil {
+			continue
+		}
+		transform, distance := bestFuzzy(variants, e.fuzzy)
+		similarity := 1 - float64(distance)/float64(len(e.fuzzy))
+		m := &PasswordMatch{
+			Password:    e.rule.Password,
+			Type:        e.rule.Type,
+			DisplayName: e.rule.DisplayName,
+			Transform:   joinTransforms(splitTransforms(transform), TransformFuzzy),
+			Similarity:  similarity,
+			Distance:    distance,
+		}
+		if e.rule.fuzzyAccepted(distance, similarity) {
+			m.Found = true
+			return m
+		}
+		// 疑似泄露只保留相似度最高的一条，继续检测低优先级的口令
+		if review := e.rule.FuzzyReviewSimilarity; review > 0 && similarity >= review &&
+			(nearMiss == nil || similarity > nearMiss.Similarity) {
+			m.NearMiss = true
+			nearMiss = m
 		}
 	}
 
-	// ===== 第三步：关键词片段容错匹配（主口令） =====
-	// 当所有关键词片段都出现在内容中时，判定为主口令泄露
-	if matchAllKeywords(content, pc.grandKeywords) {
-		return &PasswordMatch{
-			Found:       true,
-			Password:    pc.grandPassword,
-			Type:        "grand",
-			DisplayName: "特等奖",
-		}
+	if nearMiss != nil {
+		return nearMiss
 	}
+	return &PasswordMatch{Found: false}
+}
+
+// matchPassword 按前四层策略在各变体中查找口令，返回命中变体的变换名称
+// 先在所有变体上做完精确匹配再进入下一层，使报告的变换尽量准确
+// （如插入零宽字符的口令由 invisible 变体精确命中，而不是由原文去标点命中）
+func matchPassword(variants []textVariant, rule PasswordRule, py *pinyinMatcher) (string, bool) {
+	positional := utf8.RuneCountInString(stripPunctuation(rule.Password)) >= minPositionalSecret
 
-	// ===== 安慰奖：同样三层匹配 =====
-	if strings.Contains(content, pc.consolationPassword) {
-		return &PasswordMatch{
-			Found:       true,
-			Password:    pc.consolationPassword,
-			Type:        "consolation",
-			DisplayName: "安慰奖",
+	if rule.Exact {
+		for _, v := range variants {
+			if v.positional && !positional {
+				continue
+			}
+			if strings.Contains(v.text, rule.Password) {
+				return v.transform, true
+			}
 		}
 	}
 
-	if strings.Contains(cleanContent, stripPunctuation(pc.consolationPassword)) {
-		return &PasswordMatch{
-			Found:       true,
-			Password:    pc.consolationPassword,
-			Type:        "consolation",
-			DisplayName: "安慰奖",
+	if rule.Stripped {
+		cleanPassword := stripPunctuation(rule.Password)
+		for _, v := range variants {
+			if v.positional && !positional {
+				continue
+			}
+			if strings.Contains(stripPunctuation(v.text), cleanPassword) {
+				return v.transform, true
+			}
 		}
 	}
 
-	if matchAllKeywords(content, pc.consolationKeywords) {
-		return &PasswordMatch{
-			Found:       true,
-			Password:    pc.consolationPassword,
-			Type:        "consolation",
-			DisplayName: "安慰奖",
+	// 位置模式拼出的序列只参与以上两层
+	if rule.Keyword {
+		for _, v := range variants {
+			if v.positional {
+				continue
+			}
+			if matchKeywords(v.text, rule.Keywords, rule.MinKeywords) {
+				return v.transform, true
+			}
 		}
 	}
 
-	return &PasswordMatch{Found: false}
+	if py != nil {
+		for _, v := range variants {
+			if v.positional {
+				continue
+			}
+			if py.match(v.text) {
+				if v.transform == "" {
+					return TransformPinyin, true
+				}
+				return v.transform + "+" + TransformPinyin, true
+			}
+		}
+	}
+	return "", false
 }
 
-// matchAllKeywords 检查 content 是否同时包含 keywords 中的所有关键词
-func matchAllKeywords(content string, keywords []string) bool {
+// matchKeywords 检查 content 是否包含 keywords 中至少 min 个关键词（min 为 0 时要求全部包含）
+func matchKeywords(content string, keywords []string, min int) bool {
 	if len(keywords) == 0 {
 		return false
 	}
+	if min <= 0 || min > len(keywords) {
+		min = len(keywords)
+	}
+	hits := 0
 	for _, kw := range keywords {
-		if !strings.Contains(content, kw) {
-			return false
+		if strings.Contains(content, kw) {
+			hits++
+			if hits >= min {
+				return true
+			}
 		}
 	}
-	return true
+	return false
 }
@@ -0,0 +1,15 @@
+package service
+
+import "fmt"
+
+// newTestChecker 为每条口令套用 layers 中的检测层开关（依次命名为 t1、t2……），用于单独检验某几层检测
+func newTestChecker(layers PasswordRule, opts DetectionOptions, passwords ...string) *PasswordChecker {
+	rules := make([]PasswordRule, len(passwords))
+	for i, p := range passwords {
+		rule := layers
+		rule.Type = fmt.Sprintf("t%d", i+1)
+		rule.Password = p
+		rules[i] = rule
+	}
+	return NewPasswordChecker(rules, opts)
+}
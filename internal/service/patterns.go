@@ -0,0 +1,109 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 位置模式名称（PasswordMatch.Transform），可叠加在清洗步骤之后，如 "traditional+line_head"
+const (
+	PatternLineHead     = "line_head"     // 每行首字（藏头诗）
+	PatternLineTail     = "line_tail"     // 每行末字（藏尾诗）
+	PatternSentenceHead = "sentence_head" // 每句首字
+	PatternSentenceTail = "sentence_tail" // 每句末字
+	PatternStride       = "stride"        // 固定间隔取字，如 stride3 表示每隔三个字取一个
+)
+
+// minPatternUnits 行 / 句少于该数量时不提取首尾字（单行的首尾字没有意义）
+const minPatternUnits = 2
+
+// minPositionalSecret 参与位置模式匹配的口令最少字数
+// 过短的口令在长回复的间隔取字序列中可能偶然出现
+const minPositionalSecret = 4
+
+var (
+	// listMarker 行首的列表标记，如 "1. "、"（2）"、"- "、"• "
+	listMarker = regexp.MustCompile(`^\s*(?:[-*•·>]+|\d+\s*[.、)）:：]|[（(]\s*\d+\s*[)）])\s*`)
+	// sentenceEnd 句子分隔符（诗句常以逗号断句，一并计入）
+	sentenceEnd = regexp.MustCompile(`[。！？!?；;，,\n]+`)
+)
+
+// positionalVariants 提取藏头 / 藏尾 / 固定间隔等位置模式的字符序列
+// 这些序列只做精确与去标点匹配：拼音和关键词层作用在拼凑出的序列上误报率过高
+func positionalVariants(text string, maxStride int) []textVariant {
+	var out []textVariant
+	add := func(name string, seq []rune) {
+		if len(seq) >= minPatternUnits {
+			out = append(out, textVariant{transform: name, text: string(seq), positional: true})
+		}
+	}
+
+	lines := strings.Split(text, "\n")
+	add(PatternLineHead, heads(lines, true))
+	add(PatternLineTail, tails(lines))
+
+	sentences := sentenceEnd.Split(text, -1)
+	if len(nonEmpty(sentences)) > len(nonEmpty(lines)) {
+		// 每行只有一句时与行首尾相同，不重复生成
+		add(PatternSentenceHead, heads(sentences, false))
+		add(PatternSentenceTail, tails(sentences))
+	}
+
+	// 固定间隔：在去标点的字符序列上，从每个起点每隔 k 个字取一个
+	chars := []rune(stripPunctuation(text))
+	for k := 2; k <= maxStride; k++ {
+		for offset := 0; offset < k && offset < len(chars); offset++ {
+			seq := make([]rune, 0, len(chars)/k+1)
+			for i := offset; i < len(chars); i += k {
+				seq = append(seq, chars[i])
+			}
+			add(PatternStride+strconv.Itoa(k), seq)
+		}
+	}
+	return out
+}
+
+// heads 取每段文本的第一个字母 / 数字 / 汉字，stripMarker 为 true 时先去除行首的列表标记
+func heads(parts []string, stripMarker bool) []rune {
+	var seq []rune
+	for _, p := range parts {
+		if stripMarker {
+			p = listMarker.ReplaceAllString(p, "")
+		}
+		for _, r := range p {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				seq = append(seq, r)
+				break
+			}
+		}
+	}
+	return seq
+}
+
+// tails 取每段文本的最后一个字母 / 数字 / 汉字
+func tails(parts []string) []rune {
+	var seq []rune
+	for _, p := range parts {
+		runes := []rune(p)
+		for i := len(runes) - 1; i >= 0; i-- {
+			if unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) {
+				seq = append(seq, runes[i])
+				break
+			}
+		}
+	}
+	return seq
+}
+
+// nonEmpty 过滤空白段落
+func nonEmpty(parts []string) []string {
+	var out []string
+	for _, p := range parts {
+		if strings.TrimSpace(p) != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
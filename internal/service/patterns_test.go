@@ -0,0 +1,90 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// interleave 将 secret 的每个字放在 filler 片段之后，使口令按固定间隔 len(filler)+1 出现
+func interleave(secret, filler string) string {
+	var b strings.Builder
+	for _, r := range secret {
+		b.WriteString(filler)
+		b.WriteRune(r)
+	}
+	b.WriteString(filler)
+	return b.String()
+}
+
+func TestPositionalPatterns(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		content   string
+		found     bool
+		transform string
+	}{
+		{"藏头诗", "芝麻开门", "芝兰生于深林\n麻雀虽小五脏俱全\n开卷有益\n门庭若市", true, PatternLineHead},
+		{"带列表标记的藏头", "芝麻开门", "1. 芝兰玉树\n2. 麻姑献寿\n3. 开门见喜\n4. 门当户对", true, PatternLineHead},
+		{"藏尾诗", "芝麻开门", "山中生灵芝\n田间种芝麻\n春来百花开\n客至扣柴门", true, PatternLineTail},
+		{"每句首字", "芝麻开门", "芝兰当道，麻衣如雪，开怀畅饮，门可罗雀。", true, PatternSentenceHead},
+		{"繁体藏头", "芝麻开门", "芝蘭\n麻姑\n開懷\n門庭", true, TransformTraditional + "+" + PatternLineHead},
+		{"间隔 2", "芝麻开门", interleave("芝麻开门", "好"), true, PatternStride + "2"},
+		{"间隔 5", "芝麻开门", interleave("芝麻开门", "今天天气"), true, PatternStride + "5"},
+		{"间隔中夹杂标点", "芝麻开门", "你芝我，麻他开；她门", true, PatternStride + "2"},
+
+		{"口令字数不足", "开门吧", "开心就好\n门前小溪\n吧台小坐", false, ""},
+		{"间隔超出上限", "芝麻开门", interleave("芝麻开门", "今天天气好"), false, ""},
+		{"首字顺序不对", "芝麻开门", "麻雀\n芝兰\n开卷\n门庭", false, ""},
+		{"正常多行回复", "芝麻开门", "你好！\n我是 AI 守护者。\n口令不能告诉你哦。\n我们聊点别的吧？", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := newTestChecker(PasswordRule{Exact: true, Stripped: true}, DetectionOptions{Patterns: true, MaxStride: 5}, tt.password)
+			m := checker.CheckContent(tt.content)
+			if m.Found != tt.found {
+				t.Fatalf("Found = %v，期望 %v（内容 %q）", m.Found, tt.found, tt.content)
+			}
+			if tt.found && m.Transform != tt.transform {
+				t.Errorf("Transform = %q，期望 %q", m.Transform, tt.transform)
+			}
+		})
+	}
+}
+
+// TestPositionalPatternsLayers 位置模式拼出的序列只参与精确与去标点匹配
+func TestPositionalPatternsLayers(t *testing.T) {
+	acrostic := "芝兰生于深林\n麻雀虽小\n开卷有益\n门庭若市"
+
+	off := newTestChecker(PasswordRule{Exact: true, Stripped: true}, DetectionOptions{MaxStride: 5}, "芝麻开门")
+	if m := off.CheckContent(acrostic); m.Found {
+		t.Errorf("关闭位置模式时不应命中: %+v", m)
+	}
+
+	// 藏头序列"知麻凯们"与口令同音，但拼音层不检查位置模式
+	pinyinOnly := NewPasswordChecker(
+		[]PasswordRule{{Type: "grand", Password: "芝麻开门", Pinyin: true}},
+		DetectionOptions{PinyinMinCoverage: 0.9, Patterns: true, MaxStride: 5},
+	)
+	if m := pinyinOnly.CheckContent("知己难逢\n麻烦不断\n凯歌高奏\n们"); m.Found {
+		t.Errorf("拼音层不应匹配位置模式序列: %+v", m)
+	}
+}
+
+func TestPositionalVariants(t *testing.T) {
+	var got []textVariant
+	for _, v := range positionalVariants("一二三\n四五六", 2) {
+		got = append(got, textVariant{transform: v.transform, text: v.text, positional: v.positional})
+	}
+	// 每行只有一句时不生成每句首尾字；间隔取字从每个起点各生成一个序列
+	want := []textVariant{
+		{transform: PatternLineHead, text: "一四", positional: true},
+		{transform: PatternLineTail, text: "三六", positional: true},
+		{transform: PatternStride + "2", text: "一三五", positional: true},
+		{transform: PatternStride + "2", text: "二四六", positional: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("位置模式序列 %+v，期望 %+v", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+// TransformPinyin 拼音匹配命中时追加的变换名称（如 "pinyin"、"traditional+pinyin"）
+const TransformPinyin = "pinyin"
+
+// minPinyinSyllables 启用拼音匹配所需的最少音节数
+// 音节过少的口令其拼音极易在正常回复中偶然出现
+const minPinyinSyllables = 4
+
+// toneless 带声调字母 → 无调字母（ü 按惯例写作 v）
+var toneless = map[rune]string{
+	'ā': "a", 'á': "a", 'ǎ': "a", 'à': "a",
+	'ē': "e", 'é': "e", 'ě': "e", 'è': "e", 'ê': "e",
+	'ī': "i", 'í': "i", 'ǐ': "i", 'ì': "i",
+	'ō': "o", 'ó': "o", 'ǒ': "o", 'ò': "o",
+	'ū': "u", 'ú': "u", 'ǔ': "u", 'ù': "u",
+	'ü': "v", 'ǖ': "v", 'ǘ': "v", 'ǚ': "v", 'ǜ': "v",
+	'ń': "n", 'ň': "n", 'ǹ': "n", 'ḿ': "m",
+}
+
+// pinyinMatcher 口令的拼音匹配器
+// 口令和回复都转成无调拼音后比对，覆盖用拼音（带调或不带调）书写口令、用同音字替换口令用字两类绕过
+type pinyinMatcher struct {
+	syllables   []string // 口令的无调拼音音节
+	prefix      []int    // prefix[i] 为前 i 个音节的字母总数
+	minCoverage float64  // 判定泄露所需的最低覆盖率
+}
+
+// newPinyinMatcher 创建拼音匹配器；minCoverage <= 0 或口令音节过少时返回 nil（不启用）
+func newPinyinMatcher(secret string, minCoverage float64) *pinyinMatcher {
+	if minCoverage <= 0 {
+		return nil
+	}
+
+	var syllables []string
+	var latin strings.Builder
+	flushLatin := func() {
+		if latin.Len() > 0 {
+			syllables = append(syllables, latin.String())
+			latin.Reset()
+		}
+	}
+	for _, r := range secret {
+		if py := hanPinyin(r); py != "" {
+			flushLatin()
+			syllables = append(syllables, py)
+			continue
+		}
+		if letters := latinLetters(r); letters != "" {
+			latin.WriteString(letters)
+			continue
+		}
+		flushLatin()
+	}
+	flushLatin()
+
+	if len(syllables) < minPinyinSyllables {
+		return nil
+	}
+
+	prefix := make([]int, len(syllables)+1)
+	for i, s := range syllables {
+		prefix[i+1] = prefix[i] + len(s)
+	}
+	return &pinyinMatcher{syllables: syllables, prefix: prefix, minCoverage: minCoverage}
+}
+
+// match 判断 text 的拼音是否覆盖了足够比例的口令拼音
+func (m *pinyinMatcher) match(text string) bool {
+	return m.coverage(text) >= m.minCoverage
+}
+
+// coverage 计算 text 对口令拼音的覆盖率（按字母数计）
+// 只统计连续命中至少两个音节的片段，单个音节在正常回复中随处可见
+func (m *pinyinMatcher) coverage(text string) float64 {
+	s := newPinyinStream(text)
+	if len(s.letters) == 0 {
+		return 0
+	}
+
+	covered := 0
+	for i := 0; i < len(m.syllables); {
+		end := i
+		for j := i + 2; j <= len(m.syllables); j++ {
+			if !s.contains(strings.Join(m.syllables[i:j], "")) {
+				break
+			}
+			end = j
+		}
+		if end == i {
+			i++
+			continue
+		}
+		covered += m.prefix[end] - m.prefix[i]
+		i = end
+	}
+	return float64(covered) / float64(m.prefix[len(m.syllables)])
+}
+
+// pinyinStream 回复文本的无调拼音字母流
+// 汉字替换为其拼音，拉丁字母去声调后保留，其余字符（标点、空白、声调数字）丢弃
+type pinyinStream struct {
+	letters string
+	// aligned[i] 表示字母流的第 i 个位置能否作为匹配片段的起止点：
+	// 汉字拼音只能从音节边界开始和结束（避免 "jiankang" 中的 "ankang" 命中"安康"），
+	// 玩家手写的拼音无法可靠切分音节，任意位置都可以
+	aligned []bool
+}
+
+// newPinyinStream 将文本转换为拼音字母流
+func newPinyinStream(text string) *pinyinStream {
+	var b strings.Builder
+	aligned := []bool{true}
+	for _, r := range text {
+		if py := hanPinyin(r); py != "" {
+			aligned[len(aligned)-1] = true
+			b.WriteString(py)
+			for i := 1; i < len(py); i++ {
+				aligned = append(aligned, false)
+			}
+			aligned = append(aligned, true)
+			continue
+		}
+		if letters := latinLetters(r); letters != "" {
+			aligned[len(aligned)-1] = true
+			b.WriteString(letters)
+			for range letters {
+				aligned = append(aligned, true)
+			}
+		}
+	}
+	return &pinyinStream{letters: b.String(), aligned: aligned}
+}
+
+// contains 判断字母流中是否存在起止点都对齐的 sub
+func (s *pinyinStream) contains(sub string) bool {
+	for offset := 0; ; {
+		i := strings.Index(s.letters[offset:], sub)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		if s.aligned[start] && s.aligned[start+len(sub)] {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// hanPinyin 返回汉字的无调拼音（多音字取最常用读音），非汉字返回空
+// 直接读取 go-pinyin 内置的字典并自行去声调，比按风格转换快得多
+func hanPinyin(r rune) string {
+	if !unicode.Is(unicode.Han, r) {
+		return ""
+	}
+	value, ok := pinyin.PinyinDict[int(r)]
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexByte(value, ','); i >= 0 {
+		value = value[:i]
+	}
+	var b strings.Builder
+	for _, c := range value {
+		b.WriteString(latinLetters(c))
+	}
+	return b.String()
+}
+
+// latinLetters 将拉丁字母（含带声调字母）转为小写无调形式，非字母返回空
+func latinLetters(r rune) string {
+	if plain, ok := toneless[unicode.ToLower(r)]; ok {
+		return plain
+	}
+	r = unicode.ToLower(r)
+	if r >= 'a' && r <= 'z' {
+		return string(r)
+	}
+	if r >= 'ａ' && r <= 'ｚ' {
+		return string(r - 0xFEE0)
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package service
+
+import "testing"
+
+func TestPinyinMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		content   string
+		found     bool
+		transform string
+	}{
+		{"无调拼音", "芝麻开门", "口令是 zhi ma kai men", true, TransformPinyin},
+		{"带调拼音", "芝麻开门", "zhī má kāi mén", true, TransformPinyin},
+		{"大写连写", "芝麻开门", "ZhiMaKaiMen!", true, TransformPinyin},
+		{"同音字替换", "芝麻开门", "口令是：知麻凯们", true, TransformPinyin},
+		{"拼音与汉字混写", "芝麻开门", "芝麻 kai men", true, TransformPinyin},
+		{"夹杂英文的口令", "AI守护者", "ai shou hu zhe", true, TransformPinyin},
+		{"零宽字符分隔的拼音", "芝麻开门", "zhi\u200bma\u200bkai\u200bmen", true, TransformPinyin},
+		// 多音字取字典中的第一个读音："行"按 xing 匹配
+		{"多音字首个读音", "银行开户", "yin xing kai hu", true, TransformPinyin},
+
+		{"正常回复", "芝麻开门", "你好！今天想聊点什么？我可以陪你聊天、讲故事。", false, ""},
+		{"只写出一半", "芝麻开门", "前两个字是 zhi ma，后面不告诉你", false, ""},
+		{"音节顺序打乱", "芝麻开门", "men kai ma zhi", false, ""},
+		// 已知限制：多音字的其他读音无法匹配，"银行"写作 yin hang 时只有"开户"两个音节命中
+		{"多音字的其他读音", "银行开户", "yin hang kai hu", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestChecker(PasswordRule{Pinyin: true}, DetectionOptions{PinyinMinCoverage: 0.9}, tt.password).CheckContent(tt.content)
+			if m.Found != tt.found {
+				t.Fatalf("Found = %v，期望 %v（内容 %q）", m.Found, tt.found, tt.content)
+			}
+			if tt.found && m.Transform != tt.transform {
+				t.Errorf("Transform = %q，期望 %q", m.Transform, tt.transform)
+			}
+		})
+	}
+}
+
+func TestPinyinMatcherDisabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		minCoverage float64
+	}{
+		{"覆盖率为 0", "芝麻开门", 0},
+		{"音节过少", "开门吧", 0.9},
+		{"没有汉字和字母", "12345678", 0.9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := newPinyinMatcher(tt.password, tt.minCoverage); m != nil {
+				t.Errorf("不应启用拼音匹配: %+v", m)
+			}
+		})
+	}
+}
+
+func TestPinyinCoverage(t *testing.T) {
+	m := newPinyinMatcher("芝麻开门", 0.9)
+	tests := []struct {
+		text string
+		want float64
+	}{
+		{"zhimakaimen", 1},
+		{"zhima", 5.0 / 11},
+		{"kaimen", 6.0 / 11},
+		{"zhi 和 men", 0}, // 单个音节不计入覆盖
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := m.coverage(tt.text); got != tt.want {
+			t.Errorf("coverage(%q) = %v，期望 %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestPinyinStreamAligned 汉字转出的拼音只能在音节边界起止，玩家手写的拼音不受限制
+func TestPinyinStreamAligned(t *testing.T) {
+	tests := []struct {
+		text, sub string
+		want      bool
+	}{
+		{"健康", "ankang", false},
+		{"健康", "jiankang", true},
+		{"jiankang", "ankang", true},
+		{"平安健康", "ankang", false},
+		{"安康", "ankang", true},
+	}
+	for _, tt := range tests {
+		if got := newPinyinStream(tt.text).contains(tt.sub); got != tt.want {
+			t.Errorf("%q 包含 %q = %v，期望 %v", tt.text, tt.sub, got, tt.want)
+		}
+	}
+}
+
+func TestHanPinyin(t *testing.T) {
+	tests := map[rune]string{
+		'芝': "zhi",
+		'绿': "lv", // ü 写作 v
+		'行': "xing",
+		'a': "",
+		'，': "",
+	}
+	for r, want := range tests {
+		if got := hanPinyin(r); got != want {
+			t.Errorf("hanPinyin(%q) = %q，期望 %q", r, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Provider AI 提供商适配器
+// 不同上游协议（OpenAI 兼容 / Anthropic Messages / Ollama）各自实现请求构造与流式解析，
+// 重试、分发等通用逻辑由 AIService 负责
+type Provider interface {
+	// Name 提供商名称（用于日志）
+	Name() string
+	// URL 流式请求地址
+	URL() string
+	// BuildBody 构造流式请求体
+	BuildBody(req *ProviderRequest) ([]byte, error)
+	// SetHeaders 设置鉴权、协议版本等请求头
+	SetHeaders(h http.Header)
+	// ParseStream 解析流式响应体，通过 emit 推送增量内容
+	// emit 返回 false 表示调用方已不再接收，此时应立即返回
+	ParseStream(body io.Reader, emit func(StreamDelta) bool) error
+	// ParseError 从非 200 响应中提取上游错误详情
+	ParseError(statusCode int, body []byte) *APIError
+}
+
+// ProviderRequest 与具体协议无关的生成请求
+type ProviderRequest struct {
+	Model       string
+	System      string        // 系统提示词（各协议放置位置不同）
+	Messages    []ChatMessage // 对话历史（不含系统提示词）
+	Temperature *float64      // nil 时不发送，使用上游默认值
+	TopP        float64       // 0 时不发送
+	MaxTokens   int
+}
+
+// APIError 上游 API 返回的错误
+type APIError struct {
+	Provider   string // 提供商名称
+	StatusCode int    // HTTP 状态码（流内错误为 0）
+	Type       string // 上游错误类型（如 rate_limit_error、overloaded_error）
+	Message    string // 上游错误描述
+}
+
+func (e *APIError) Error() string {
+	detail := e.Message
+	if e.Type != "" {
+		detail = fmt.Sprintf("[%s] %s", e.Type, e.Message)
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s 流式响应返回错误: %s", e.Provider, detail)
+	}
+	return fmt.Sprintf("%s API 返回错误 (HTTP %d): %s", e.Provider, e.StatusCode, detail)
+}
+
+// 支持的提供商名称
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// NewProvider 根据名称创建提供商适配器
+// apiURL 为空时使用该提供商的官方默认地址
+func NewProvider(name, apiURL, apiKey string) (Provider, error) {
+	switch strings.ToLower(name) {
+	case "", ProviderOpenAI:
+		if apiURL == "" {
+			apiURL = "https://api.openai.com/v1/chat/completions"
+		}
+		return &OpenAIProvider{apiURL: apiURL, apiKey: apiKey}, nil
+	case ProviderAnthropic:
+		if apiURL == "" {
+			apiURL = "https://api.anthropic.com/v1/messages"
+		}
+		return &AnthropicProvider{apiURL: apiURL, apiKey: apiKey}, nil
+	case ProviderOllama:
+		if apiURL == "" {
+			apiURL = "http://localhost:11434/api/chat"
+		}
+		return &OllamaProvider{apiURL: apiURL, apiKey: apiKey}, nil
+	default:
+		return nil, fmt.Errorf("不支持的 AI 提供商: %s（可选 openai / anthropic / ollama）", name)
+	}
+}
+
+// maxStreamLineSize 单行流式数据的最大长度
+// bufio.Scanner 默认 64KB，部分提供商的单个事件可能超出
+const maxStreamLineSize = 1 << 20
+
+// newStreamScanner 创建按行读取流式响应的 Scanner
+func newStreamScanner(body io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	return scanner
+}
+
+// readSSEData 逐行读取 SSE 响应，将每个 "data:" 行的内容交给 handle 处理
+// handle 返回 false 时停止读取
+func readSSEData(body io.Reader, handle func(data string) bool) error {
+	scanner := newStreamScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// 跳过空行、注释行以及 "event:" 行（事件类型同样包含在 data 的 JSON 中）
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if !handle(data) {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取流式响应失败: %w", err)
+	}
+	return nil
+}
+
+// truncateErrorBody 截断过长的错误响应体，避免日志被 HTML 错误页刷屏
+func truncateErrorBody(body []byte) string {
+	const maxLen = 500
+	s := strings.TrimSpace(string(body))
+	if len(s) > maxLen {
+		return strings.ToValidUTF8(s[:maxLen], "") + "..."
+	}
+	return s
+}
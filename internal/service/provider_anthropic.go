@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// anthropicVersion Anthropic Messages API 版本号
+const anthropicVersion = "2023-06-01"
+
+// anthropicDefaultMaxTokens Anthropic 要求必须传 max_tokens，未配置时使用此值
+const anthropicDefaultMaxTokens = 2000
+
+// AnthropicProvider Anthropic 原生 Messages 接口（/v1/messages）
+type AnthropicProvider struct {
+	apiURL string
+	apiKey string
+}
+
+// anthropicRequest Messages API 请求体
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Stream      bool               `json:"stream"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        float64            `json:"top_p,omitempty"`
+}
+
+// anthropicMessage Messages API 消息结构
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock 内容块（text 或 image）
+type anthropicContentBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+// anthropicImageSource 图片来源（base64 内联）
+type anthropicImageSource struct {
+	Type      string `json:"type"` // 固定为 "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// anthropicEvent 流式事件（message_start / content_block_delta / message_stop / error 等）
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"` // message_start
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage anthropicUsage        `json:"usage"` // message_delta
+	Error *anthropicErrorDetail `json:"error"`
+}
+
+// anthropicUsage token 用量：输入用量在 message_start 中给出，输出用量在 message_delta 中累计
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// anthropicErrorDetail Anthropic 错误详情
+type anthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (p *AnthropicProvider) Name() string { return ProviderAnthropic }
+
+func (p *AnthropicProvider) URL() string { return p.apiURL }
+
+func (p *AnthropicProvider) SetHeaders(h http.Header) {
+	h.Set("x-api-key", p.apiKey)
+	h.Set("anthropic-version", anthropicVersion)
+	h.Set("Accept", "text/event-stream")
+}
+
+// BuildBody 构造请求体：系统提示词放在顶层 system 字段
+func (p *AnthropicProvider) BuildBody(req *ProviderRequest) ([]byte, error) {
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+
+	return json.Marshal(anthropicRequest{
+		Model:       req.Model,
+		System:      req.System,
+		Messages:    normalizeAnthropicMessages(req.Messages),
+		MaxTokens:   maxTokens,
+		Stream:      true,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	})
+}
+
+// normalizeAnthropicMessages 将对话历史整理为 Messages API 要求的格式
+// Messages API 要求第一条必须是 user 消息，且 user / assistant 严格交替：
+//   - 丢弃开头的 assistant 消息（如开场白）
+//   - 合并连续的同角色消息（如福利机制追加的 assistant 消息）
+//   - 跳过空文本块（API 不接受空 text）
+func normalizeAnthropicMessages(history []ChatMessage) []anthropicMessage {
+	messages := make([]anthropicMessage, 0, len(history))
+	for _, msg := range history {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		if len(messages) == 0 && msg.Role == "assistant" {
+			continue
+		}
+
+		blocks := anthropicBlocks(msg)
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(messages); n > 0 && messages[n-1].Role == msg.Role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			continue
+		}
+		messages = append(messages, anthropicMessage{Role: msg.Role, Content: blocks})
+	}
+	return messages
+}
+
+// anthropicBlocks 将消息片段转换为内容块，图片使用原生 base64 image 块
+func anthropicBlocks(msg ChatMessage) []anthropicContentBlock {
+	var blocks []anthropicContentBlock
+	for _, part := range msg.ContentParts() {
+		switch part.Type {
+		case PartText:
+			if part.Text != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+			}
+		case PartImage:
+			blocks = append(blocks, anthropicContentBlock{
+				Type: "image",
+				Source: &anthropicImageSource{
+					Type:      "base64",
+					MediaType: part.MediaType,
+					Data:      part.Data,
+				},
+			})
+		}
+	}
+	return blocks
+}
+
+// ParseStream 解析 Messages API 的 SSE 事件流
+// 文本增量位于 content_block_delta 事件，message_stop 表示结束
+// 用量来自 message_start（输入）和 message_delta（输出）
+func (p *AnthropicProvider) ParseStream(body io.Reader, emit func(StreamDelta) bool) error {
+	var streamErr error
+	var usage *Usage
+	err := readSSEData(body, func(data string) bool {
+		var ev anthropicEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return true
+		}
+
+		switch ev.Type {
+		case "message_start":
+			u := ev.Message.Usage
+			usage = &Usage{
+				PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+				CompletionTokens: u.OutputTokens,
+			}
+		case "message_delta":
+			if usage == nil {
+				usage = &Usage{}
+			}
+			if ev.Usage.OutputTokens > 0 {
+				usage.CompletionTokens = ev.Usage.OutputTokens
+			}
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				return emit(StreamDelta{Content: ev.Delta.Text})
+			}
+		case "message_stop":
+			emit(StreamDelta{Done: true, Usage: usage})
+			return false
+		case "error":
+			// 流中途错误（如 overloaded_error）
+			apiErr := &APIError{Provider: p.Name()}
+			if ev.Error != nil {
+				apiErr.Type = ev.Error.Type
+				apiErr.Message = ev.Error.Message
+			}
+			streamErr = apiErr
+			return false
+		}
+		return true
+	})
+	if streamErr != nil {
+		return streamErr
+	}
+	return err
+}
+
+// ParseError 解析 {"type": "error", "error": {"type": ..., "message": ...}} 格式的错误响应
+func (p *AnthropicProvider) ParseError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{Provider: p.Name(), StatusCode: statusCode}
+
+	var resp struct {
+		Error *anthropicErrorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != nil && resp.Error.Message != "" {
+		apiErr.Type = resp.Error.Type
+		apiErr.Message = resp.Error.Message
+		return apiErr
+	}
+
+	apiErr.Message = truncateErrorBody(body)
+	return apiErr
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OllamaProvider Ollama 原生对话接口（/api/chat）
+// 流式响应为 NDJSON：每行一个 JSON 对象，最后一行 done=true
+type OllamaProvider struct {
+	apiURL string
+	apiKey string // 本地部署通常为空；经反向代理鉴权时作为 Bearer Token
+}
+
+// ollamaRequest /api/chat 请求体
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+// ollamaMessage Ollama 消息结构（图片以 base64 列表附在消息上）
+type ollamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+// ollamaOptions 模型参数
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+// ollamaStreamLine NDJSON 流中的单行
+type ollamaStreamLine struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+	// 最后一行（done=true）附带的 token 用量
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+func (p *OllamaProvider) Name() string { return ProviderOllama }
+
+func (p *OllamaProvider) URL() string { return p.apiURL }
+
+func (p *OllamaProvider) SetHeaders(h http.Header) {
+	if p.apiKey != "" {
+		h.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	h.Set("Accept", "application/x-ndjson")
+}
+
+// BuildBody 构造请求体：系统提示词作为第一条 system 消息
+func (p *OllamaProvider) BuildBody(req *ProviderRequest) ([]byte, error) {
+	messages := make([]ollamaMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range req.Messages {
+		om := ollamaMessage{Role: msg.Role, Content: msg.Text()}
+		for _, part := range msg.Parts {
+			if part.Type == PartImage {
+				om.Images = append(om.Images, part.Data)
+			}
+		}
+		messages = append(messages, om)
+	}
+
+	body := ollamaRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   true,
+	}
+	if req.Temperature != nil || req.TopP != 0 || req.MaxTokens != 0 {
+		body.Options = &ollamaOptions{Temperature: req.Temperature, TopP: req.TopP, NumPredict: req.MaxTokens}
+	}
+	return json.Marshal(body)
+}
+
+// ParseStream 逐行解析 NDJSON 流
+func (p *OllamaProvider) ParseStream(body io.Reader, emit func(StreamDelta) bool) error {
+	scanner := newStreamScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var sl ollamaStreamLine
+		if err := json.Unmarshal([]byte(line), &sl); err != nil {
+			continue
+		}
+
+		if sl.Error != "" {
+			return &APIError{Provider: p.Name(), Message: sl.Error}
+		}
+
+		if sl.Message.Content != "" {
+			if !emit(StreamDelta{Content: sl.Message.Content}) {
+				return nil
+			}
+		}
+
+		if sl.Done {
+			emit(StreamDelta{Done: true, Usage: &Usage{PromptTokens: sl.PromptEvalCount, CompletionTokens: sl.EvalCount}})
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取流式响应失败: %w", err)
+	}
+	return nil
+}
+
+// ParseError 解析 {"error": "..."} 格式的错误响应
+func (p *OllamaProvider) ParseError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{Provider: p.Name(), StatusCode: statusCode}
+
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != "" {
+		apiErr.Message = resp.Error
+		return apiErr
+	}
+
+	apiErr.Message = truncateErrorBody(body)
+	return apiErr
+}
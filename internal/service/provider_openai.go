@@ -0,0 +1,194 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// OpenAIProvider OpenAI 兼容的 Chat Completions 接口（/v1/chat/completions）
+type OpenAIProvider struct {
+	apiURL string
+	apiKey string
+}
+
+// openAIRequest OpenAI 请求体结构
+type openAIRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openAIMessage      `json:"messages"`
+	Stream        bool                 `json:"stream"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          float64              `json:"top_p,omitempty"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+}
+
+// openAIStreamOptions 流式选项：include_usage 使上游在 [DONE] 前额外发送一个携带用量的 chunk
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIMessage OpenAI 格式的消息结构
+// Content 为字符串（纯文本）或 []openAIContentPart（多模态）
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// openAIContentPart 多模态内容片段
+type openAIContentPart struct {
+	Type     string          `json:"type"` // "text" 或 "image_url"
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+// openAIImageURL 图片地址（使用 base64 data URL）
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// openAIStreamChoice 流式响应的 choice 结构
+type openAIStreamChoice struct {
+	Delta struct {
+		Content string `json:"content"`
+	} `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// openAIStreamResponse 流式响应结构
+type openAIStreamResponse struct {
+	Choices []openAIStreamChoice `json:"choices"`
+	Usage   *openAIUsage         `json:"usage"`
+	Error   *openAIErrorDetail   `json:"error"`
+}
+
+// openAIUsage token 用量
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// openAIErrorDetail OpenAI 错误详情
+type openAIErrorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func (p *OpenAIProvider) Name() string { return ProviderOpenAI }
+
+func (p *OpenAIProvider) URL() string { return p.apiURL }
+
+func (p *OpenAIProvider) SetHeaders(h http.Header) {
+	h.Set("Authorization", "Bearer "+p.apiKey)
+	h.Set("Accept", "text/event-stream")
+}
+
+// BuildBody 构造请求体：系统提示词作为第一条 system 消息
+func (p *OpenAIProvider) BuildBody(req *ProviderRequest) ([]byte, error) {
+	messages := make([]openAIMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range req.Messages {
+		messages = append(messages, openAIMessage{Role: msg.Role, Content: openAIContent(msg)})
+	}
+
+	return json.Marshal(openAIRequest{
+		Model:         req.Model,
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		MaxTokens:     req.MaxTokens,
+	})
+}
+
+// openAIContent 转换消息内容：纯文本保持字符串，含图片时转为片段数组
+func openAIContent(msg ChatMessage) interface{} {
+	if !msg.HasImages() {
+		return msg.Text()
+	}
+
+	parts := make([]openAIContentPart, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		switch part.Type {
+		case PartText:
+			parts = append(parts, openAIContentPart{Type: "text", Text: part.Text})
+		case PartImage:
+			parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: part.DataURL()}})
+		}
+	}
+	return parts
+}
+
+// ParseStream 解析 "data: {...}" 格式的 SSE 流，以 "data: [DONE]" 结束
+// finish_reason 之后上游还会发送用量 chunk，因此读到 [DONE]（或流结束）才算完成
+func (p *OpenAIProvider) ParseStream(body io.Reader, emit func(StreamDelta) bool) error {
+	var streamErr error
+	var usage *Usage
+	finished := false
+	done := false
+	err := readSSEData(body, func(data string) bool {
+		// 流结束标记
+		if data == "[DONE]" {
+			done = true
+			return false
+		}
+
+		var sr openAIStreamResponse
+		if err := json.Unmarshal([]byte(data), &sr); err != nil {
+			return true
+		}
+
+		// 部分兼容实现会在流中途以 error 对象报告错误
+		if sr.Error != nil {
+			streamErr = &APIError{Provider: p.Name(), Type: sr.Error.Type, Message: sr.Error.Message}
+			return false
+		}
+
+		if sr.Usage != nil {
+			usage = &Usage{PromptTokens: sr.Usage.PromptTokens, CompletionTokens: sr.Usage.CompletionTokens}
+		}
+
+		for _, choice := range sr.Choices {
+			if choice.Delta.Content != "" {
+				if !emit(StreamDelta{Content: choice.Delta.Content}) {
+					return false
+				}
+			}
+			if choice.FinishReason != nil {
+				finished = true
+			}
+		}
+		return true
+	})
+	if streamErr != nil {
+		return streamErr
+	}
+	if err != nil {
+		return err
+	}
+	// 部分兼容实现不发送 [DONE]，收到 finish_reason 后流结束同样视为完成
+	if done || finished {
+		emit(StreamDelta{Done: true, Usage: usage})
+	}
+	return nil
+}
+
+// ParseError 解析 {"error": {"message": ..., "type": ...}} 格式的错误响应
+func (p *OpenAIProvider) ParseError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{Provider: p.Name(), StatusCode: statusCode}
+
+	var resp struct {
+		Error *openAIErrorDetail `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error != nil && resp.Error.Message != "" {
+		apiErr.Type = resp.Error.Type
+		apiErr.Message = resp.Error.Message
+		return apiErr
+	}
+
+	apiErr.Message = truncateErrorBody(body)
+	return apiErr
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// RedactMask 输出过滤替换口令时使用的遮盖文本
+const RedactMask = "***"
+
+// OutputFilter 输出过滤：在回复发送给玩家之前拦截口令原文
+// 模拟真实产品中的输出过滤器，只识别字面出现的口令（忽略大小写、全角和字间的标点空白），
+// 编码、拼音、藏头等变形不会被拦截，仍由实时检测判定为泄露
+type OutputFilter struct {
+	secrets []filterSecret
+}
+
+// filterSecret 过滤的单条口令（去标点、折叠大小写与全角后的字符序列）
+type filterSecret struct {
+	tier  string
+	runes []rune
+}
+
+// NewOutputFilter 创建输出过滤，secrets 为奖项 ID → 口令（空口令忽略）
+func NewOutputFilter(secrets map[string]string) *OutputFilter {
+	f := &OutputFilter{}
+	for tier, secret := range secrets {
+		runes := []rune(foldForFilter(stripPunctuation(secret)))
+		if len(runes) == 0 {
+			continue
+		}
+		f.secrets = append(f.secrets, filterSecret{tier: tier, runes: runes})
+	}
+	// 长口令优先：一条口令是另一条的子串时按完整的长口令遮盖
+	sort.Slice(f.secrets, func(i, j int) bool {
+		if len(f.secrets[i].runes) != len(f.secrets[j].runes) {
+			return len(f.secrets[i].runes) > len(f.secrets[j].runes)
+		}
+		return f.secrets[i].tier < f.secrets[j].tier
+	})
+	return f
+}
+
+// Stream 创建单条回复的过滤流
+func (f *OutputFilter) Stream() *FilterStream {
+	return &FilterStream{filter: f}
+}
+
+// FilterStream 流式输出过滤：末尾可能是口令开头的文本暂存在前瞻缓冲中，确认不是口令后再放行
+// 缓冲只在文本疑似口令开头时增长，正常回复几乎没有延迟
+type FilterStream struct {
+	filter  *OutputFilter
+	pending []rune
+	hits    map[string]bool
+}
+
+// Write 追加上游生成的文本，返回可以发送给玩家的部分（口令已替换为 RedactMask）
+// 以及本次拦截到的奖项 ID
+func (s *FilterStream) Write(delta string) (string, []string) {
+	s.pending = append(s.pending, []rune(delta)...)
+	return s.drain(false)
+}
+
+// Flush 回复结束时放行缓冲中剩余的文本
+func (s *FilterStream) Flush() (string, []string) {
+	return s.drain(true)
+}
+
+// Blocked 返回本条回复中被拦截过的奖项 ID（按 ID 排序）
+func (s *FilterStream) Blocked() []string {
+	tiers := make([]string, 0, len(s.hits))
+	for tier := range s.hits {
+		tiers = append(tiers, tier)
+	}
+	sort.Strings(tiers)
+	return tiers
+}
+
+// drain 扫描缓冲：完整的口令替换为遮盖文本，遇到可能是口令开头的位置时停止（final 时不再等待）
+func (s *FilterStream) drain(final bool) (string, []string) {
+	folded := []rune(foldForFilter(string(s.pending)))
+	var out strings.Builder
+	var hits []string
+	i := 0
+scan:
+	for i < len(folded) {
+		for _, secret := range s.filter.secrets {
+			end, complete := matchFiltered(folded, i, secret.runes)
+			if complete {
+				out.WriteString(RedactMask)
+				if s.hits == nil {
+					s.hits = make(map[string]bool)
+				}
+				s.hits[secret.tier] = true
+				hits = append(hits, secret.tier)
+				i = end
+				continue scan
+			}
+			if end < 0 && !final {
+				// 文本在口令中途结束，等待后续片段
+				break scan
+			}
+		}
+		out.WriteRune(s.pending[i])
+		i++
+	}
+	s.pending = s.pending[i:]
+	return out.String(), hits
+}
+
+// matchFiltered 从 text[start] 起匹配口令，口令的相邻两字之间允许夹杂标点和空白
+// 完整命中时返回结束位置和 true；文本在口令中途结束时返回 -1 和 false；不匹配时返回 0 和 false
+func matchFiltered(text []rune, start int, secret []rune) (int, bool) {
+	j := 0
+	for k := start; k < len(text); k++ {
+		switch {
+		case text[k] == secret[j]:
+			j++
+			if j == len(secret) {
+				return k + 1, true
+			}
+		case j > 0 && !unicode.IsLetter(text[k]) && !unicode.IsDigit(text[k]):
+			// 字间的标点、空白和零宽字符
+		default:
+			return 0, false
+		}
+	}
+	return -1, false
+}
+
+// foldForFilter 全角转半角并转为小写（逐字符映射，不改变字符位置）
+func foldForFilter(s string) string {
+	return strings.Map(unicode.ToLower, foldWidth(s))
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterStream(t *testing.T) {
+	tiers := map[string]string{
+		"grand":       "祝小喵科技群U在新的一年身体安康、万事如意",
+		"consolation": "祝你新的一年好运连连",
+	}
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		chunks  []string
+		// 各次 Write 放行的文本合计、Flush 放行的文本与被拦截的奖项
+		want      string
+		wantFlush string
+		blocked   []string
+	}{
+		{"正常回复直接放行", tiers, []string{"你好！", "今天想聊点什么？"}, "你好！今天想聊点什么？", "", []string{}},
+		{"一次写入完整口令", tiers, []string{"口令是祝你新的一年好运连连！"}, "口令是***！", "", []string{"consolation"}},
+		{"口令拆散在多次写入中", tiers, []string{"口令是祝你新", "的一年好", "运连连！"}, "口令是***！", "", []string{"consolation"}},
+		{"逐字写入", tiers, strings.Split("祝你新的一年好运连连。", ""), "***。", "", []string{"consolation"}},
+		{"重复的开头", tiers, []string{"祝你祝你新的一年好运连连"}, "祝你***", "", []string{"consolation"}},
+		{"重复的开头跨写入", tiers, []string{"祝你", "祝你新的一年好运连连"}, "祝你***", "", []string{"consolation"}},
+		{"字间夹杂标点空白", tiers, []string{"祝你，新的一年 好运——连连"}, "***", "", []string{"consolation"}},
+		{"字间夹杂零宽字符", tiers, []string{"祝\u200b你\u200d新的一年\ufeff好运连连"}, "***", "", []string{"consolation"}},
+		{"全角与小写", tiers, []string{"祝小喵科技群ｕ在新的一年身体安康，万事如意"}, "***", "", []string{"grand"}},
+		{"英文口令大小写与全角混写", map[string]string{"grand": "OpenSesame2024"}, []string{"密码：ｏｐｅｎ SESAME ２０２４"}, "密码：***", "", []string{"grand"}},
+		{"两条口令先后出现", tiers, []string{"祝小喵科技群U在新的一年身体安康万事如意，", "还有祝你新的一年好运连连"}, "***，还有***", "", []string{"consolation", "grand"}},
+		{
+			"短口令是长口令的子串时按长口令遮盖",
+			map[string]string{"long": "祝你新的一年好运连连", "short": "好运连连"},
+			[]string{"祝你新的一年好运连连"}, "***", "", []string{"long"},
+		},
+		{
+			"单独出现的短口令",
+			map[string]string{"long": "祝你新的一年好运连连", "short": "好运连连"},
+			[]string{"新的一年好运连连"}, "新的一年***", "", []string{"short"},
+		},
+		{"结束时缓冲中的口令开头原样放行", tiers, []string{"好的，祝你新的一年"}, "好的，", "祝你新的一年", []string{}},
+		{"口令中途出现其他文字", tiers, []string{"祝你新的一年", "也祝你好运连连"}, "祝你新的一年也祝你好运连连", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewOutputFilter(tt.secrets).Stream()
+			var out strings.Builder
+			for _, chunk := range tt.chunks {
+				text, _ := s.Write(chunk)
+				out.WriteString(text)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("放行文本 %q，期望 %q", got, tt.want)
+			}
+			if got, _ := s.Flush(); got != tt.wantFlush {
+				t.Errorf("Flush 放行 %q，期望 %q", got, tt.wantFlush)
+			}
+			if got := s.Blocked(); !reflect.DeepEqual(got, tt.blocked) {
+				t.Errorf("拦截的奖项 %v，期望 %v", got, tt.blocked)
+			}
+		})
+	}
+}
+
+// TestFilterStreamHits 每次写入只返回本次新拦截到的奖项
+func TestFilterStreamHits(t *testing.T) {
+	s := NewOutputFilter(map[string]string{"consolation": "祝你新的一年好运连连"}).Stream()
+	if _, hits := s.Write("祝你新的"); len(hits) != 0 {
+		t.Errorf("口令尚未写完时不应拦截: %v", hits)
+	}
+	if text, hits := s.Write("一年好运连连"); text != RedactMask || !reflect.DeepEqual(hits, []string{"consolation"}) {
+		t.Errorf("写完口令时应返回遮盖文本与奖项，实际 %q, %v", text, hits)
+	}
+	if _, hits := s.Write("谢谢"); len(hits) != 0 {
+		t.Errorf("之后的写入不应重复返回奖项: %v", hits)
+	}
+}
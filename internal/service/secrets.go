@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// SecretTemplate 随机口令模板
+type SecretTemplate struct {
+	Text  string   // 模板原文，如 "祝{animal}{blessing}"
+	Slots []string // 模板中依次出现的词表名称
+}
+
+// GeneratedSecret 为单个奖项生成的口令
+type GeneratedSecret struct {
+	Secret string   `json:"secret"` // 口令原文
+	Words  []string `json:"words"`  // 依次抽中的词，用作关键词片段
+}
+
+// SecretVault 随机口令的生成与加解密
+// 口令以 AES-256-GCM 加密后保存在对话记录中，数据库泄露时不会直接暴露各对话的口令
+type SecretVault struct {
+	aead      cipher.AEAD
+	templates map[string]SecretTemplate // 奖项 ID → 模板
+	wordLists map[string][]string
+}
+
+// NewSecretVault 创建随机口令保管器，key 经 SHA-256 派生为 AES-256 密钥
+func NewSecretVault(key string, templates map[string]SecretTemplate, wordLists map[string][]string) (*SecretVault, error) {
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretVault{aead: aead, templates: templates, wordLists: wordLists}, nil
+}
+
+// Generate 为每个配置了模板的奖项随机生成一条口令
+func (v *SecretVault) Generate() (map[string]GeneratedSecret, error) {
+	secrets := make(map[string]GeneratedSecret, len(v.templates))
+	for tierID, tpl := range v.templates {
+		text := tpl.Text
+		words := make([]string, 0, len(tpl.Slots))
+		for _, slot := range tpl.Slots {
+			list := v.wordLists[slot]
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(list))))
+			if err != nil {
+				return nil, fmt.Errorf("生成随机数失败: %w", err)
+			}
+			word := list[n.Int64()]
+			text = strings.Replace(text, "{"+slot+"}", word, 1)
+			words = append(words, word)
+		}
+		secrets[tierID] = GeneratedSecret{Secret: text, Words: words}
+	}
+	return secrets, nil
+}
+
+// Seal 加密口令，返回 base64(nonce || 密文)
+func (v *SecretVault) Seal(secrets map[string]GeneratedSecret) (string, error) {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(v.aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Open 解密 Seal 生成的密文
+func (v *SecretVault) Open(sealed string) (map[string]GeneratedSecret, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("口令密文格式错误: %w", err)
+	}
+	if len(data) < v.aead.NonceSize() {
+		return nil, errors.New("口令密文过短")
+	}
+	nonce, ciphertext := data[:v.aead.NonceSize()], data[v.aead.NonceSize():]
+	plain, err := v.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		// 通常是更换了 random_secrets.key
+		return nil, fmt.Errorf("口令解密失败: %w", err)
+	}
+
+	var secrets map[string]GeneratedSecret
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("解析口令失败: %w", err)
+	}
+	return secrets, nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// AddBlockedLeak 记录一条被输出过滤拦截的回复
+func (s *Store) AddBlockedLeak(b *model.BlockedLeak) {
+	_, err := s.db.Exec(
+		`INSERT INTO blocked_leaks (conversation_id, user_id, nickname, tiers, action, content, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		b.ConversationID, b.UserID, b.Nickname, strings.Join(b.Tiers, ","), b.Action, b.Content, time.Now(),
+	)
+	if err != nil {
+		log.Printf("记录输出拦截失败: %v", err)
+	}
+}
+
+// GetBlockedLeaks 分页获取输出过滤拦截记录，最新的在前
+func (s *Store) GetBlockedLeaks(page, pageSize int) ([]model.BlockedLeak, int) {
+	var total int
+	s.db.QueryRow(`SELECT COUNT(*) FROM blocked_leaks`).Scan(&total)
+
+	offset := (page - 1) * pageSize
+	rows, err := s.db.Query(
+		`SELECT id, conversation_id, user_id, nickname, tiers, action, content, created_at
+		 FROM blocked_leaks ORDER BY id DESC LIMIT ? OFFSET ?`,
+		pageSize, offset,
+	)
+	if err != nil {
+		return []model.BlockedLeak{}, total
+	}
+	defer rows.Close()
+
+	leaks := []model.BlockedLeak{}
+	for rows.Next() {
+		var b model.BlockedLeak
+		var tiers string
+		if err := rows.Scan(&b.ID, &b.ConversationID, &b.UserID, &b.Nickname, &tiers, &b.Action, &b.Content, &b.CreatedAt); err != nil {
+			continue
+		}
+		b.Tiers = splitTags(tiers)
+		leaks = append(leaks, b)
+	}
+	return leaks, total
+}
@@ -0,0 +1,537 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// postgresDSNEnv 设置后一致性检查同时在该 PostgreSQL 数据库上运行（必须是空库）
+const postgresDSNEnv = "AGC_TEST_POSTGRES_DSN"
+
+// conformanceChecks 所有后端必须通过的行为检查，SQLite 与 PostgreSQL 共用
+// 各项检查写入固定的测试数据，在同一个空数据库上按顺序运行
+var conformanceChecks = []struct {
+	name string
+	run  func(r Repository) error
+}{
+	{"用户与会话", checkUsersAndSessions},
+	{"会话过期与撤销", checkSessionExpiry},
+	{"邮箱验证码", checkLoginCodes},
+	{"对话与消息", checkConversations},
+	{"对话列表", checkConversationLists},
+	{"获奖记录与名额", checkWinners},
+	{"并发发奖", checkConcurrentAwards},
+	{"并发猜测", checkConcurrentGuesses},
+	{"福利状态与闯关进度", checkBonusAndLevels},
+	{"随机口令", checkSecrets},
+	{"检测记录", checkDetectionRecords},
+	{"用量统计", checkUsage},
+}
+
+// TestConformance 在临时 SQLite 文件上运行一致性检查；设置 AGC_TEST_POSTGRES_DSN 时同时检查 PostgreSQL
+func TestConformance(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) Repository
+	}{
+		{DriverSQLite, func(t *testing.T) Repository { return openTestStore(t) }},
+		{DriverPostgres, openPostgresStore},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			r := b.open(t)
+			for _, c := range conformanceChecks {
+				t.Run(c.name, func(t *testing.T) {
+					if err := c.run(r); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+		})
+	}
+}
+
+// openPostgresStore 打开 AGC_TEST_POSTGRES_DSN 指定的数据库并执行迁移，未设置时跳过
+// 检查会写入测试数据，已有数据表时拒绝运行
+func openPostgresStore(t *testing.T) Repository {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("未设置 %s，跳过 PostgreSQL", postgresDSNEnv)
+	}
+	s, err := Open(DriverPostgres, dsn)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(s.Close)
+	if tables, err := s.TableCount(); err != nil {
+		t.Fatalf("读取数据库结构失败: %v", err)
+	} else if tables > 0 {
+		t.Fatalf("数据库中已有 %d 张表，一致性检查只能在空库上运行", tables)
+	}
+	if _, err := s.Migrate(); err != nil {
+		t.Fatalf("数据库迁移失败: %v", err)
+	}
+	return s
+}
+
+// expect 条件不成立时返回检查失败
+func expect(ok bool, format string, args ...interface{}) error {
+	if ok {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// firstError 返回第一个非 nil 的错误
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recent 时间是否在当前时间前后 1 分钟内（各后端的时间精度与时区处理不同）
+func recent(t time.Time) bool {
+	d := time.Since(t)
+	return d > -time.Minute && d < time.Minute
+}
+
+func checkUsersAndSessions(r Repository) error {
+	u := r.GetOrCreateUser("c-user", "甲")
+	if u == nil {
+		return fmt.Errorf("GetOrCreateUser 返回 nil")
+	}
+	again := r.GetOrCreateUser("c-user", "乙")
+	if err := firstError(
+		expect(u.ID == "c-user" && u.Contact == "c-user" && !u.IsAdmin, "新用户字段不正确: %+v", u),
+		expect(again != nil && again.ID == u.ID && again.Nickname == "乙", "再次登录应更新昵称: %+v", again),
+	); err != nil {
+		return err
+	}
+
+	token := r.CreateSession(u.ID, time.Hour)
+	other := r.CreateSession(u.ID, time.Hour)
+	got := r.GetUserBySession(token, time.Hour)
+	if err := firstError(
+		expect(len(token) >= 43, "CreateSession 返回的令牌过短: %q", token),
+		expect(token != other, "两次 CreateSession 返回相同的令牌"),
+		expect(got != nil && got.ID == u.ID && got.Nickname == "乙", "GetUserBySession 返回 %+v", got),
+		expect(r.GetUserBySession("no-such-token", time.Hour) == nil, "未知令牌应返回 nil"),
+		expect(r.GetUserBySession("", time.Hour) == nil, "空令牌应返回 nil"),
+	); err != nil {
+		return err
+	}
+	r.DeleteSession(token)
+	return firstError(
+		expect(r.GetUserBySession(token, time.Hour) == nil, "DeleteSession 后令牌仍然有效"),
+		expect(r.GetUserBySession(other, time.Hour) != nil, "DeleteSession 不应影响同一用户的其他会话"),
+	)
+}
+
+func checkSessionExpiry(r Repository) error {
+	r.GetOrCreateUser("c-session", "丙")
+	expired := r.CreateSession("c-session", -time.Second)
+	if err := firstError(
+		expect(r.GetUserBySession(expired, time.Hour) == nil, "已过期的会话仍然有效"),
+		expect(r.GetUserBySession(expired, time.Hour) == nil, "过期会话被访问后不应续期"),
+	); err != nil {
+		return err
+	}
+
+	r.CreateSession("c-session", -time.Second)
+	live := r.CreateSession("c-session", time.Hour)
+	if err := firstError(
+		expect(r.DeleteExpiredSessions() == 1, "DeleteExpiredSessions 应只清理 1 个过期会话"),
+		expect(r.GetUserBySession(live, time.Hour) != nil, "DeleteExpiredSessions 删除了未过期的会话"),
+	); err != nil {
+		return err
+	}
+
+	kept := r.CreateSession("c-user", time.Hour)
+	r.CreateSession("c-session", time.Hour)
+	return firstError(
+		expect(r.DeleteUserSessions("c-session") == 2, "DeleteUserSessions 应删除该用户的 2 个会话"),
+		expect(r.GetUserBySession(live, time.Hour) == nil, "DeleteUserSessions 后会话仍然有效"),
+		expect(r.GetUserBySession(kept, time.Hour) != nil, "DeleteUserSessions 删除了其他用户的会话"),
+		expect(r.DeleteUserSessions("c-session") == 0, "重复撤销应返回 0"),
+	)
+}
+
+func checkLoginCodes(r Repository) error {
+	const email = "c@example.com"
+	before := time.Now().Add(-time.Minute)
+	if err := firstError(
+		expect(r.CheckLoginCode(email, "123456", 3) == LoginCodeExpired, "未获取验证码时应返回 expired"),
+		expect(r.GetLastLoginCodeTime(email).IsZero(), "未发送过验证码时应返回零值"),
+	); err != nil {
+		return err
+	}
+
+	r.AddLoginCode(email, "111111", time.Hour)
+	r.AddLoginCode(email, "222222", time.Hour)
+	r.AddLoginCode("other@example.com", "222222", time.Hour)
+	if err := firstError(
+		expect(r.CountLoginCodesSince(email, before) == 2, "CountLoginCodesSince 应为 2，实际 %d", r.CountLoginCodesSince(email, before)),
+		expect(r.CountLoginCodesSince(email, time.Now().Add(time.Minute)) == 0, "未来时间之后不应有验证码"),
+		expect(recent(r.GetLastLoginCodeTime(email)), "GetLastLoginCodeTime 返回 %v", r.GetLastLoginCodeTime(email)),
+		expect(r.CheckLoginCode(email, "111111", 3) == LoginCodeWrong, "重新获取后旧验证码应失效"),
+		expect(r.CheckLoginCode(email, "222222", 3) == LoginCodeValid, "最新的验证码应验证通过"),
+		expect(r.CheckLoginCode(email, "222222", 3) == LoginCodeExpired, "验证码不能重复使用"),
+		expect(r.CheckLoginCode("other@example.com", "222222", 3) == LoginCodeValid, "其他邮箱的验证码不应受影响"),
+	); err != nil {
+		return err
+	}
+
+	r.AddLoginCode(email, "333333", time.Hour)
+	if err := firstError(
+		expect(r.CheckLoginCode(email, "000000", 2) == LoginCodeWrong, "错误的验证码应返回 wrong"),
+		expect(r.CheckLoginCode(email, "000000", 2) == LoginCodeWrong, "错误的验证码应返回 wrong"),
+		expect(r.CheckLoginCode(email, "333333", 2) == LoginCodeLocked, "错误次数达到上限后正确的验证码也应失效"),
+	); err != nil {
+		return err
+	}
+
+	r.AddLoginCode(email, "444444", -time.Second)
+	if err := expect(r.CheckLoginCode(email, "444444", 3) == LoginCodeExpired, "已过期的验证码应返回 expired"); err != nil {
+		return err
+	}
+	return firstError(
+		expect(r.DeleteLoginCodesBefore(before) == 0, "DeleteLoginCodesBefore 删除了之后发送的验证码"),
+		expect(r.DeleteLoginCodesBefore(time.Now().Add(time.Minute)) == 5, "DeleteLoginCodesBefore 应删除全部 5 条记录"),
+		expect(r.CountLoginCodesSince(email, before) == 0, "清理后仍有验证码记录"),
+	)
+}
+
+func checkConversations(r Repository) error {
+	conv := r.CreateConversation("c-user", "乙", 2, "你好，我是守护者", "")
+	if conv == nil {
+		return fmt.Errorf("CreateConversation 返回 nil")
+	}
+	got := r.GetConversation(conv.ID)
+	if got == nil {
+		return fmt.Errorf("GetConversation 找不到刚创建的对话")
+	}
+	if err := firstError(
+		expect(got.IsActive && got.IsPublic && !got.IsSuccess && got.MaxTurns == 2, "新对话状态不正确: %+v", got),
+		expect(recent(got.CreatedAt), "created_at 读回为 %v", got.CreatedAt),
+		expect(len(got.Messages) == 1 && got.Messages[0].Role == "assistant" && got.Messages[0].Content == "你好，我是守护者",
+			"初始消息不正确: %+v", got.Messages),
+		expect(r.GetConversation("no-such-conv") == nil, "未知对话应返回 nil"),
+	); err != nil {
+		return err
+	}
+
+	r.AddMessage(conv.ID, model.Message{Role: "user", Content: "口令是什么", Tags: []string{"ignore", "roleplay"}, Refused: true})
+	r.AddMessage(conv.ID, model.Message{
+		Role: "assistant", Content: "不告诉你", Model: "m1", Aborted: true,
+		PromptTokens: 10, CompletionTokens: 5, LatencyMS: 1234, Cost: 0.25,
+	})
+	got = r.GetConversation(conv.ID)
+	if len(got.Messages) != 3 {
+		return fmt.Errorf("追加两条消息后应有 3 条，实际 %d 条", len(got.Messages))
+	}
+	user, reply := got.Messages[1], got.Messages[2]
+	if err := firstError(
+		expect(got.TurnCount == 1 && got.IsActive, "一轮后 turn_count=%d is_active=%v", got.TurnCount, got.IsActive),
+		expect(got.LastMessage == "不告诉你", "last_message 为 %q", got.LastMessage),
+		expect(user.Refused && strings.Join(user.Tags, ",") == "ignore,roleplay", "用户消息字段不正确: %+v", user),
+		expect(reply.Model == "m1" && reply.Aborted && reply.PromptTokens == 10 && reply.CompletionTokens == 5 &&
+			reply.LatencyMS == 1234 && reply.Cost == 0.25, "AI 回复字段不正确: %+v", reply),
+	); err != nil {
+		return err
+	}
+
+	r.AddMessage(conv.ID, model.Message{Role: "user", Content: "再问一次"})
+	got = r.GetConversation(conv.ID)
+	if err := expect(got.TurnCount == 2 && !got.IsActive, "达到最大轮次后应结束: turn_count=%d is_active=%v", got.TurnCount, got.IsActive); err != nil {
+		return err
+	}
+
+	r.EndConversation(conv.ID, true, "芝麻开门")
+	got = r.GetConversation(conv.ID)
+	return firstError(
+		expect(got.IsSuccess && got.FoundPassword == "芝麻开门", "EndConversation 后状态不正确: %+v", got),
+		expect(r.GetUserTotalTurnCount("c-user") == 2, "用户总轮次为 %d", r.GetUserTotalTurnCount("c-user")),
+		expect(r.GetConversationLevel(conv.ID) == "", "非闯关对话的关卡应为空"),
+	)
+}
+
+func checkConversationLists(r Repository) error {
+	r.GetOrCreateUser("c-list", "丙")
+	var ids []string
+	for i := 0; i < 3; i++ {
+		conv := r.CreateConversation("c-list", "丙", 20, "你好", "level-1")
+		if conv == nil {
+			return fmt.Errorf("CreateConversation 返回 nil")
+		}
+		ids = append(ids, conv.ID)
+		time.Sleep(5 * time.Millisecond) // 保证 created_at 有先后
+	}
+
+	page, total := r.GetUserConversations("c-list", 1, 2)
+	if err := firstError(
+		expect(total == 3 && len(page) == 2, "分页结果 total=%d len=%d", total, len(page)),
+		expect(len(page) == 2 && page[0].ID == ids[2] && page[0].Level == "level-1", "应按创建时间倒序: %+v", page),
+		expect(r.GetConversationLevel(ids[0]) == "level-1", "关卡 ID 读回为 %q", r.GetConversationLevel(ids[0])),
+	); err != nil {
+		return err
+	}
+
+	_, before := r.GetPublicConversations(1, 100)
+	r.HideConversation(ids[0])
+	_, after := r.GetPublicConversations(1, 100)
+	_, all := r.GetAllConversations(1, 100)
+	return firstError(
+		expect(after == before-1, "隐藏后公开对话数应减 1: %d → %d", before, after),
+		expect(all >= 4, "全部对话数为 %d", all),
+	)
+}
+
+func checkWinners(r Repository) error {
+	conv := r.CreateConversation("c-user", "乙", 20, "你好", "")
+	conv2 := r.CreateConversation("c-list", "丙", 20, "你好", "")
+	conv3 := r.CreateConversation("c-list", "丙", 20, "你好", "")
+
+	result, first := r.RecordWinner("乙", conv.ID, "t1", "一等奖", "芝麻开门", "10元", "direct", 2)
+	if err := expect(result == AwardGranted && first, "首位获奖: result=%s first=%v", result, first); err != nil {
+		return err
+	}
+	result, first = r.RecordWinner("乙", conv.ID, "t1", "一等奖", "芝麻开门", "10元", "review", 2)
+	if err := expect(result == AwardDuplicate && !first, "同一对话重复发奖: result=%s", result); err != nil {
+		return err
+	}
+	result, first = r.RecordWinner("丙", conv2.ID, "t1", "一等奖", "芝麻开门", "10元", DetectionGuess, 2)
+	if err := expect(result == AwardGranted && !first, "猜中口令不占首位: result=%s first=%v", result, first); err != nil {
+		return err
+	}
+	result, _ = r.RecordWinner("丙", conv3.ID, "t1", "一等奖", "芝麻开门", "10元", "direct", 2)
+	if err := expect(result == AwardSoldOut, "名额已满: result=%s", result); err != nil {
+		return err
+	}
+
+	winners, total := r.GetWinners("t1", 1, 10)
+	categories := map[string]bool{}
+	for _, w := range winners {
+		categories[w.Category] = true
+	}
+	_, others := r.GetWinners("no-such-tier", 1, 10)
+	return firstError(
+		expect(r.GetWinnerCount("t1") == 2 && total == 2, "获奖数为 %d（列表 %d）", r.GetWinnerCount("t1"), total),
+		expect(categories["t1-first"] && categories["t1-deduced"], "获奖类别为 %v", categories),
+		expect(len(winners) == 2 && winners[0].PrizeName == "一等奖" && recent(winners[0].Timestamp), "获奖记录字段不正确: %+v", winners),
+		expect(others == 0, "按奖项筛选无效"),
+		expect(r.HasUserWonPassword("c-user", "t1") && !r.HasUserWonPassword("c-user", "t2"), "HasUserWonPassword 不正确"),
+		expect(r.IsPasswordAlreadyUsedByUser(conv.ID, "开门") && !r.IsPasswordAlreadyUsedByUser(conv3.ID, "开门"), "IsPasswordAlreadyUsedByUser 不正确"),
+	)
+}
+
+func checkConcurrentAwards(r Repository) error {
+	const attempts, quota = 20, 5
+	convs := make([]string, attempts)
+	for i := range convs {
+		conv := r.CreateConversation("c-race", "丁", 20, "你好", "")
+		if conv == nil {
+			return fmt.Errorf("CreateConversation 返回 nil")
+		}
+		convs[i] = conv.ID
+	}
+
+	var mu sync.Mutex
+	results := map[string]int{}
+	firsts := 0
+	var wg sync.WaitGroup
+	for i := 0; i < attempts*2; i++ {
+		wg.Add(1)
+		go func(convID string) {
+			defer wg.Done()
+			result, first := r.RecordWinner("丁", convID, "race", "抢答奖", "口令", "1元", "direct", quota)
+			mu.Lock()
+			defer mu.Unlock()
+			results[result]++
+			if first {
+				firsts++
+			}
+		}(convs[i%attempts])
+	}
+	wg.Wait()
+
+	return firstError(
+		expect(results[AwardFailed] == 0, "并发发奖出现数据库错误: %v", results),
+		expect(results[AwardGranted] == quota && r.GetWinnerCount("race") == quota, "应恰好发出 %d 个名额: %v", quota, results),
+		expect(firsts == 1, "首位获奖者应只有 1 个，实际 %d 个", firsts),
+	)
+}
+
+func checkConcurrentGuesses(r Repository) error {
+	const attempts, limit = 20, 3
+	race := func(userID string, limits GuessLimits) map[string]int {
+		var mu sync.Mutex
+		results := map[string]int{}
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, _, _ := r.AddGuess(&model.Guess{UserID: userID, ConversationID: "conv-gr", Guess: "芝麻"}, limits)
+				mu.Lock()
+				defer mu.Unlock()
+				results[result]++
+			}()
+		}
+		wg.Wait()
+		return results
+	}
+
+	daily := race("c-guess-race", GuessLimits{Since: time.Now().Add(-time.Minute), MaxAttempts: limit})
+	cooling := race("c-cool-race", GuessLimits{Cooldown: time.Hour})
+	return firstError(
+		expect(daily[GuessFailed] == 0 && cooling[GuessFailed] == 0, "并发猜测出现数据库错误: %v %v", daily, cooling),
+		expect(daily[GuessRecorded] == limit && daily[GuessLimitReached] == attempts-limit,
+			"每日次数应恰好用掉 %d 次: %v", limit, daily),
+		expect(cooling[GuessRecorded] == 1 && cooling[GuessCoolingDown] == attempts-1,
+			"冷却期内应只记录 1 次: %v", cooling),
+	)
+}
+
+func checkBonusAndLevels(r Repository) error {
+	if err := expect(r.GetUserBonusStatus("c-user") == "", "初始福利状态应为空"); err != nil {
+		return err
+	}
+	r.SetUserBonusStatus("c-user", "offered")
+	r.SetUserBonusStatus("c-user", "continued")
+	if err := expect(r.GetUserBonusStatus("c-user") == "continued", "福利状态为 %q", r.GetUserBonusStatus("c-user")); err != nil {
+		return err
+	}
+
+	r.ClearLevel("c-user", "level-1", "conv-a")
+	r.ClearLevel("c-user", "level-1", "conv-b")
+	r.ClearLevel("c-user", "level-2", "conv-c")
+	cleared := r.GetClearedLevels("c-user")
+	return expect(len(cleared) == 2 && cleared["level-1"] && cleared["level-2"], "已通过关卡为 %v", cleared)
+}
+
+func checkSecrets(r Repository) error {
+	conv := r.CreateConversation("c-user", "乙", 20, "你好", "")
+	if err := expect(r.GetConversationSecrets(conv.ID) == "", "新对话不应有口令"); err != nil {
+		return err
+	}
+	r.SetConversationSecrets(conv.ID, "sealed-conv")
+	first := r.GetOrSetUserSecrets("c-user", "sealed-1")
+	second := r.GetOrSetUserSecrets("c-user", "sealed-2")
+	return firstError(
+		expect(r.GetConversationSecrets(conv.ID) == "sealed-conv", "对话口令读回为 %q", r.GetConversationSecrets(conv.ID)),
+		expect(first == "sealed-1" && second == "sealed-1", "用户口令应以先写入者为准: %q, %q", first, second),
+	)
+}
+
+func checkDetectionRecords(r Repository) error {
+	id := r.AddLeakReview(&model.LeakReview{
+		ConversationID: "conv-r", UserID: "c-user", Nickname: "乙", Content: "回复",
+		LeakType: "t1", Confidence: 0.9, Reason: "拼音", JudgeModel: "judge", Status: ReviewPending,
+	})
+	if id <= 0 {
+		return fmt.Errorf("AddLeakReview 返回 ID %d", id)
+	}
+	review := r.GetLeakReview(id)
+	if err := firstError(
+		expect(review != nil && review.Confidence == 0.9 && review.ResolvedAt == nil && recent(review.CreatedAt), "审核记录字段不正确: %+v", review),
+		expect(r.AddLeakReview(&model.LeakReview{Status: ReviewAwarded}) > id, "审核记录 ID 应递增"),
+	); err != nil {
+		return err
+	}
+	resolved := r.ResolveLeakReview(id, ReviewApproved)
+	_, pending := r.GetLeakReviews(ReviewPending, 1, 10)
+	_, all := r.GetLeakReviews("", 1, 10)
+	if err := firstError(
+		expect(resolved != nil && resolved.Status == ReviewApproved && resolved.ResolvedAt != nil, "处理结果不正确: %+v", resolved),
+		expect(r.ResolveLeakReview(id, ReviewRejected) == nil, "已处理的记录不能再次处理"),
+		expect(pending == 0 && all == 2, "按状态筛选: pending=%d all=%d", pending, all),
+	); err != nil {
+		return err
+	}
+
+	r.AddFragmentProgress("conv-f", []model.FragmentProgress{{Tier: "t1", Start: 2, Length: 2, Fragment: "开门"}})
+	r.AddFragmentProgress("conv-f", []model.FragmentProgress{
+		{Tier: "t1", Start: 2, Length: 2, Fragment: "开门"},
+		{Tier: "t1", Start: 0, Length: 2, Fragment: "芝麻"},
+	})
+	fragments := r.GetFragmentProgress("conv-f")
+	if err := expect(len(fragments) == 2 && fragments[0].Fragment == "芝麻" && recent(fragments[0].CreatedAt),
+		"片段进度应去重并按位置排列: %+v", fragments); err != nil {
+		return err
+	}
+
+	limits := GuessLimits{Since: time.Now().Add(-time.Minute), MaxAttempts: 2}
+	first, used1, _ := r.AddGuess(&model.Guess{UserID: "c-guess", ConversationID: "conv-g", Guess: "芝麻", Similarity: 0.5}, limits)
+	second, used2, _ := r.AddGuess(&model.Guess{UserID: "c-guess", ConversationID: "conv-g", Guess: "芝麻开门", MatchedTier: "t1", Similarity: 1}, limits)
+	third, used3, _ := r.AddGuess(&model.Guess{UserID: "c-guess", ConversationID: "conv-g", Guess: "开门"}, limits)
+	cooling, _, wait := r.AddGuess(&model.Guess{UserID: "c-guess", ConversationID: "conv-g", Guess: "开门"}, GuessLimits{Cooldown: time.Hour})
+	other, _, _ := r.AddGuess(&model.Guess{UserID: "c-other", ConversationID: "conv-g", Guess: "开门"}, GuessLimits{Cooldown: time.Hour, MaxAttempts: 2})
+	if err := firstError(
+		expect(first == GuessRecorded && used1 == 1 && second == GuessRecorded && used2 == 2,
+			"前两次猜测应记录: %s/%d, %s/%d", first, used1, second, used2),
+		expect(third == GuessLimitReached && used3 == 2, "次数用完后应拒绝: %s/%d", third, used3),
+		expect(cooling == GuessCoolingDown && wait > 59*time.Minute, "冷却期内应拒绝: %s, 剩余 %v", cooling, wait),
+		expect(other == GuessRecorded, "频率限制应按用户统计: %s", other),
+	); err != nil {
+		return err
+	}
+
+	r.AddBlockedLeak(&model.BlockedLeak{ConversationID: "conv-b", UserID: "c-user", Nickname: "乙", Tiers: []string{"t1", "t2"}, Action: "refuse", Content: "芝麻开门"})
+	leaks, total := r.GetBlockedLeaks(1, 10)
+	if err := expect(total == 1 && len(leaks) == 1 && strings.Join(leaks[0].Tiers, ",") == "t1,t2" && leaks[0].ID > 0,
+		"拦截记录不正确: %+v", leaks); err != nil {
+		return err
+	}
+
+	stats := r.GetInputTagStats()
+	tags := map[string]model.InputTagStat{}
+	for _, s := range stats {
+		tags[s.Tag] = s
+	}
+	return expect(tags["ignore"].Messages == 1 && tags["ignore"].Refused == 1 && tags["ignore"].SuccessConversations == 1,
+		"输入标签统计不正确: %+v", stats)
+}
+
+func checkUsage(r Repository) error {
+	conv := r.CreateConversation("c-usage", "戊", 20, "你好", "")
+	r.AddMessage(conv.ID, model.Message{Role: "assistant", Content: "a", Model: "m2", PromptTokens: 100, CompletionTokens: 20, LatencyMS: 100, Cost: 1.5})
+	r.AddMessage(conv.ID, model.Message{Role: "assistant", Content: "b", Model: "m2", PromptTokens: 50, CompletionTokens: 30, LatencyMS: 300, Cost: 0.5})
+
+	tokens, cost := r.GetConversationSpend(conv.ID)
+	userTokens, _ := r.GetUserSpendSince("c-usage", time.Now().Add(-time.Minute))
+	futureTokens, _ := r.GetSpendSince(time.Now().Add(time.Minute))
+	allTokens, _ := r.GetSpendSince(time.Now().Add(-time.Minute))
+	if err := firstError(
+		expect(tokens == 200 && cost == 2, "对话用量为 %d tokens / %v", tokens, cost),
+		expect(userTokens == 200, "用户用量为 %d", userTokens),
+		expect(futureTokens == 0 && allTokens >= 200, "按时间统计: 之后 %d / 之前 %d", futureTokens, allTokens),
+	); err != nil {
+		return err
+	}
+
+	var byModel *model.UsageStat
+	for _, s := range r.GetUsageStats(UsageByModel, "", 10) {
+		if s.Key == "m2" {
+			s := s
+			byModel = &s
+		}
+	}
+	byUser := r.GetUsageStats(UsageByUser, "c-usage", 10)
+	total := r.GetUsageTotal()
+	return firstError(
+		expect(byModel != nil && byModel.Messages == 2 && byModel.PromptTokens == 150 && byModel.AvgLatencyMS == 200,
+			"按模型汇总不正确: %+v", byModel),
+		expect(len(byUser) == 1 && byUser[0].Label == "戊" && byUser[0].Cost == 2, "按用户汇总不正确: %+v", byUser),
+		expect(total.Messages >= 3 && total.Key == "total", "全站汇总不正确: %+v", total),
+	)
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// 存储后端
+const (
+	DriverSQLite   = "sqlite"   // 单机部署（默认）
+	DriverPostgres = "postgres" // 多实例部署，多个服务实例共用一个数据库
+)
+
+// dialect 存储后端之间的差异
+// SQL 统一按 SQLite 的写法书写（? 占位符），两种后端共用同一套查询
+type dialect struct {
+	driverName string // database/sql 驱动名
+	migrations string // 内置迁移文件目录
+	numbered   bool   // 占位符是否改写为 $1, $2 ...
+	// lockAward 发奖事务开始时执行的加锁语句：SQLite 的事务以 BEGIN IMMEDIATE 开始，已持有写锁
+	lockAward string
+	// lockGuess 记录猜测的事务开始时执行的加锁语句：频率检查与写入之间不允许其他猜测写入
+	lockGuess string
+	// lockSchema 迁移事务开始时执行的加锁语句：多个实例同时启动时依次迁移
+	lockSchema string
+	// countTables 统计数据表数量（不含迁移记录表）
+	countTables string
+}
+
+var dialects = map[string]dialect{
+	DriverSQLite: {
+		driverName:  "sqlite",
+		migrations:  "migrations/sqlite",
+		countTables: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'`,
+	},
+	DriverPostgres: {
+		driverName: "pgx",
+		migrations: "migrations/postgres",
+		numbered:   true,
+		lockAward:  `LOCK TABLE winners IN SHARE ROW EXCLUSIVE MODE`,
+		lockGuess:  `LOCK TABLE guesses IN SHARE ROW EXCLUSIVE MODE`,
+		lockSchema: `SELECT pg_advisory_xact_lock(20251017)`,
+		countTables: `SELECT COUNT(*) FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name != 'schema_migrations'`,
+	},
+}
+
+// rebind 将 ? 占位符改写为后端的写法（跳过字符串字面量中的 ?）
+func (d dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlDB 按方言改写 SQL 的数据库连接池
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *sqlDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *sqlDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+// Begin 开始事务
+func (db *sqlDB) Begin() (*sqlTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// sqlTx 按方言改写 SQL 的事务
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *sqlTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *sqlTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *sqlTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+// lock 执行加锁语句（为空时跳过）
+func (tx *sqlTx) lock(stmt string) error {
+	if stmt == "" {
+		return nil
+	}
+	_, err := tx.Tx.Exec(stmt)
+	return err
+}
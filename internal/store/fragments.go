@@ -0,0 +1,46 @@
+package store
+
+import (
+	"log"
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// AddFragmentProgress 记录对话中新透露的口令片段（已记录过的片段忽略）
+func (s *Store) AddFragmentProgress(convID string, fragments []model.FragmentProgress) {
+	now := time.Now()
+	for _, f := range fragments {
+		_, err := s.db.Exec(
+			`INSERT INTO fragment_progress (conversation_id, tier_id, start, length, fragment, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(conversation_id, tier_id, start, length) DO NOTHING`,
+			convID, f.Tier, f.Start, f.Length, f.Fragment, now,
+		)
+		if err != nil {
+			log.Printf("记录口令片段失败: %v", err)
+		}
+	}
+}
+
+// GetFragmentProgress 获取对话已透露的口令片段，按奖项和位置排列
+func (s *Store) GetFragmentProgress(convID string) []model.FragmentProgress {
+	rows, err := s.db.Query(
+		`SELECT tier_id, start, length, fragment, created_at FROM fragment_progress
+		 WHERE conversation_id = ? ORDER BY tier_id, start, length`, convID,
+	)
+	if err != nil {
+		return []model.FragmentProgress{}
+	}
+	defer rows.Close()
+
+	fragments := []model.FragmentProgress{}
+	for rows.Next() {
+		var f model.FragmentProgress
+		if err := rows.Scan(&f.Tier, &f.Start, &f.Length, &f.Fragment, &f.CreatedAt); err != nil {
+			continue
+		}
+		fragments = append(fragments, f)
+	}
+	return fragments
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// splitTags 解析以逗号分隔的消息标签
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// GetInputTagStats 按输入检测标签汇总用户消息，按消息数降序
+// 用于分析玩家常用的攻击手法及其成功率
+func (s *Store) GetInputTagStats() []model.InputTagStat {
+	rows, err := s.db.Query(
+		`SELECT m.tags, m.refused, m.conversation_id, c.user_id, c.is_success
+		 FROM messages m JOIN conversations c ON c.id = m.conversation_id
+		 WHERE m.role = 'user' AND m.tags != ''`,
+	)
+	if err != nil {
+		return []model.InputTagStat{}
+	}
+	defer rows.Close()
+
+	type tagAgg struct {
+		stat          model.InputTagStat
+		users         map[string]bool
+		conversations map[string]bool
+	}
+	aggs := make(map[string]*tagAgg)
+	for rows.Next() {
+		var tags, convID, userID string
+		var refused, success int
+		if err := rows.Scan(&tags, &refused, &convID, &userID, &success); err != nil {
+			continue
+		}
+		for _, tag := range splitTags(tags) {
+			a := aggs[tag]
+			if a == nil {
+				a = &tagAgg{
+					stat:          model.InputTagStat{Tag: tag},
+					users:         make(map[string]bool),
+					conversations: make(map[string]bool),
+				}
+				aggs[tag] = a
+			}
+			a.stat.Messages++
+			a.stat.Refused += refused
+			a.users[userID] = true
+			if !a.conversations[convID] {
+				a.conversations[convID] = true
+				a.stat.SuccessConversations += success
+			}
+		}
+	}
+
+	stats := make([]model.InputTagStat, 0, len(aggs))
+	for _, a := range aggs {
+		a.stat.Users = len(a.users)
+		a.stat.Conversations = len(a.conversations)
+		stats = append(stats, a.stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Messages != stats[j].Messages {
+			return stats[i].Messages > stats[j].Messages
+		}
+		return stats[i].Tag < stats[j].Tag
+	})
+	return stats
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// DetectionGuess 猜中口令的获奖记录泄露方式（获奖类别记为 "<奖项ID>-deduced"）
+const DetectionGuess = "guess"
+
+// 猜测记录结果（AddGuess 的返回值）
+const (
+	GuessRecorded     = "recorded" // 已记录
+	GuessCoolingDown  = "cooldown" // 距上次猜测未满冷却时间，未记录
+	GuessLimitReached = "limit"    // 统计周期内的次数已用完，未记录
+	GuessFailed       = "failed"   // 数据库错误，未记录
+)
+
+// GuessLimits 提交猜测的频率限制（Cooldown、MaxAttempts 不大于 0 表示不限制）
+type GuessLimits struct {
+	Cooldown    time.Duration // 同一用户两次猜测的最小间隔
+	Since       time.Time     // 次数统计的起点（当日开始时间）
+	MaxAttempts int           // 自 Since 起最多猜测次数
+}
+
+// AddGuess 在频率限制内记录一次口令猜测
+// 返回记录结果、自 limits.Since 起已猜测的次数（记录成功时含本次）以及冷却剩余时间（仅 GuessCoolingDown 时有值）
+// 检查与写入在同一事务中完成，同一用户并发提交时也不会绕过冷却时间或超出次数
+func (s *Store) AddGuess(g *model.Guess, limits GuessLimits) (string, int, time.Duration) {
+	result, used, wait, err := s.addGuess(g, limits)
+	if err != nil {
+		log.Printf("记录口令猜测失败: %v", err)
+		return GuessFailed, 0, 0
+	}
+	return result, used, wait
+}
+
+func (s *Store) addGuess(g *model.Guess, limits GuessLimits) (string, int, time.Duration, error) {
+	// 持有写锁期间同一时刻只有一个猜测事务（SQLite 以 BEGIN IMMEDIATE 开始事务，PostgreSQL 锁定 guesses 表）
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer tx.Rollback()
+	if err := tx.lock(s.db.dialect.lockGuess); err != nil {
+		return "", 0, 0, err
+	}
+
+	now := time.Now()
+	if limits.Cooldown > 0 {
+		var last time.Time
+		err := tx.QueryRow(
+			`SELECT created_at FROM guesses WHERE user_id = ? ORDER BY id DESC LIMIT 1`, g.UserID,
+		).Scan(&last)
+		if err != nil && err != sql.ErrNoRows {
+			return "", 0, 0, err
+		}
+		if wait := last.Add(limits.Cooldown).Sub(now); wait > 0 {
+			return GuessCoolingDown, 0, wait, nil
+		}
+	}
+
+	var used int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM guesses WHERE user_id = ? AND created_at >= ?`,
+		g.UserID, limits.Since.In(time.Local),
+	).Scan(&used); err != nil {
+		return "", 0, 0, err
+	}
+	if limits.MaxAttempts > 0 && used >= limits.MaxAttempts {
+		return GuessLimitReached, used, 0, nil
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO guesses (user_id, conversation_id, guess, matched_tier, similarity, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		g.UserID, g.ConversationID, g.Guess, g.MatchedTier, g.Similarity, now,
+	); err != nil {
+		return "", 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", 0, 0, err
+	}
+	return GuessRecorded, used + 1, 0, nil
+}
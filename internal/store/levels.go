@@ -0,0 +1,43 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// GetConversationLevel 获取对话所属的关卡 ID，非闯关对话返回空字符串
+func (s *Store) GetConversationLevel(convID string) string {
+	var level string
+	s.db.QueryRow(`SELECT level FROM conversations WHERE id = ?`, convID).Scan(&level)
+	return level
+}
+
+// ClearLevel 记录用户通过关卡（重复通关时保留首次记录）
+func (s *Store) ClearLevel(userID, levelID, convID string) {
+	_, err := s.db.Exec(
+		`INSERT INTO level_progress (user_id, level_id, conversation_id, cleared_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(user_id, level_id) DO NOTHING`,
+		userID, levelID, convID, time.Now(),
+	)
+	if err != nil {
+		log.Printf("记录闯关进度失败: %v", err)
+	}
+}
+
+// GetClearedLevels 获取用户已通过的关卡 ID 集合
+func (s *Store) GetClearedLevels(userID string) map[string]bool {
+	cleared := make(map[string]bool)
+	rows, err := s.db.Query(`SELECT level_id FROM level_progress WHERE user_id = ?`, userID)
+	if err != nil {
+		return cleared
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			cleared[id] = true
+		}
+	}
+	return cleared
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+// 验证码校验结果（CheckLoginCode 的返回值）
+const (
+	LoginCodeValid   = "valid"   // 验证通过，验证码已作废
+	LoginCodeWrong   = "wrong"   // 验证码错误，已计入尝试次数
+	LoginCodeExpired = "expired" // 没有有效的验证码（未获取、已过期或已使用）
+	LoginCodeLocked  = "locked"  // 错误次数已达上限，需重新获取
+)
+
+// hashLoginCode 验证码与邮箱一起哈希后保存
+func hashLoginCode(email, code string) string {
+	sum := sha256.Sum256([]byte(email + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddLoginCode 记录发送给邮箱的登录验证码，ttl 后过期；该邮箱之前获取的验证码一并作废
+func (s *Store) AddLoginCode(email, code string, ttl time.Duration) {
+	s.db.Exec(`UPDATE login_codes SET used = 1 WHERE email = ? AND used = 0`, email)
+	now := time.Now()
+	_, err := s.db.Exec(
+		`INSERT INTO login_codes (email, code_hash, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		email, hashLoginCode(email, code), now, now.Add(ttl),
+	)
+	if err != nil {
+		log.Printf("记录登录验证码失败: %v", err)
+	}
+}
+
+// CountLoginCodesSince 统计自 since 起发送给邮箱的验证码数量
+func (s *Store) CountLoginCodesSince(email string, since time.Time) int {
+	var count int
+	s.db.QueryRow(
+		`SELECT COUNT(*) FROM login_codes WHERE email = ? AND created_at >= ?`,
+		email, since.In(time.Local),
+	).Scan(&count)
+	return count
+}
+
+// GetLastLoginCodeTime 获取最近一次向邮箱发送验证码的时间，从未发送时返回零值
+func (s *Store) GetLastLoginCodeTime(email string) time.Time {
+	var last time.Time
+	s.db.QueryRow(
+		`SELECT created_at FROM login_codes WHERE email = ? ORDER BY id DESC LIMIT 1`, email,
+	).Scan(&last)
+	return last
+}
+
+// CheckLoginCode 校验邮箱最近一次获取的验证码，每个验证码最多校验 maxAttempts 次，验证通过后作废
+// 尝试次数与作废均为条件更新，多个实例并发校验同一验证码时也不会超出次数或重复使用
+func (s *Store) CheckLoginCode(email, code string, maxAttempts int) string {
+	var id int64
+	var hash string
+	var attempts int
+	err := s.db.QueryRow(
+		`SELECT id, code_hash, attempts FROM login_codes
+		 WHERE email = ? AND used = 0 AND expires_at > ? ORDER BY id DESC LIMIT 1`,
+		email, time.Now(),
+	).Scan(&id, &hash, &attempts)
+	if err != nil {
+		return LoginCodeExpired
+	}
+	if attempts >= maxAttempts {
+		return LoginCodeLocked
+	}
+
+	res, err := s.db.Exec(
+		`UPDATE login_codes SET attempts = attempts + 1 WHERE id = ? AND attempts < ?`, id, maxAttempts,
+	)
+	if err != nil {
+		log.Printf("更新验证码尝试次数失败: %v", err)
+		return LoginCodeExpired
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return LoginCodeLocked
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashLoginCode(email, code))) != 1 {
+		return LoginCodeWrong
+	}
+
+	res, err = s.db.Exec(`UPDATE login_codes SET used = 1 WHERE id = ? AND used = 0`, id)
+	if err != nil {
+		log.Printf("作废验证码失败: %v", err)
+		return LoginCodeExpired
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return LoginCodeExpired
+	}
+	return LoginCodeValid
+}
+
+// DeleteLoginCodesBefore 删除 before 之前发送的验证码记录，返回删除的记录数
+func (s *Store) DeleteLoginCodesBefore(before time.Time) int {
+	res, err := s.db.Exec(`DELETE FROM login_codes WHERE created_at < ?`, before.In(time.Local))
+	if err != nil {
+		log.Printf("清理登录验证码失败: %v", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
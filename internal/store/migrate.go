@@ -0,0 +1,284 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles 编号的升级迁移，文件名格式为 "<4 位版本号>_<名称>.sql"，版本号从 1 开始连续递增
+// 每种后端各有一套迁移，同一版本号对应相同的表结构；已发布的迁移不能修改，表结构变更一律新增迁移文件
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration 一个表结构迁移
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+var migrationName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
+
+// loadMigrations 读取 dir 中内置的迁移文件，按版本号排序并校验编号连续
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("迁移文件名 %q 不符合 <版本号>_<名称>.sql 格式", e.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		version, _ := strconv.Atoi(m[1])
+		migrations = append(migrations, Migration{Version: version, Name: m[2], SQL: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("迁移版本号不连续：期望 %04d，实际为 %04d_%s", i+1, m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// legacyColumns 迁移机制引入前由启动时补列添加的列（仅 SQLite）
+// 旧版本创建的数据库没有迁移记录，应用 0001 时一并补齐，之后的迁移可以假定表结构与 0001 一致
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"messages", "model", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "image_url", "TEXT NOT NULL DEFAULT ''"},
+	{"messages", "aborted", "INTEGER NOT NULL DEFAULT 0"},
+	{"messages", "prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"messages", "completion_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"messages", "latency_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"messages", "cost", "REAL NOT NULL DEFAULT 0"},
+	{"messages", "refused", "INTEGER NOT NULL DEFAULT 0"},
+	{"messages", "tags", "TEXT NOT NULL DEFAULT ''"},
+	{"winners", "prize_name", "TEXT NOT NULL DEFAULT ''"},
+	{"winners", "detection", "TEXT NOT NULL DEFAULT ''"},
+	{"conversations", "secrets", "TEXT NOT NULL DEFAULT ''"},
+	{"conversations", "level", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// querier *sql.DB 与 *sql.Tx 共有的查询方法
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// legacyColumnStatements 返回旧版本数据库需要补充的列（表尚不存在时跳过，由 0001 创建完整的表）
+func legacyColumnStatements(q querier) ([]string, error) {
+	var stmts []string
+	for _, c := range legacyColumns {
+		columns, err := tableColumns(q, c.table)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) > 0 && !columns[c.column] {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition))
+		}
+	}
+	return stmts, nil
+}
+
+// tableColumns 返回表的列名集合，表不存在时为空
+func tableColumns(q querier, table string) (map[string]bool, error) {
+	rows, err := q.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("读取表 %s 的结构失败: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// ensureMigrationTable 创建迁移记录表（多个实例同时启动时依次执行）
+func (s *Store) ensureMigrationTable() error {
+	tx, err := s.db.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		if err = tx.lock(s.db.dialect.lockSchema); err == nil {
+			_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+				version    INTEGER PRIMARY KEY,
+				name       TEXT NOT NULL,
+				applied_at TIMESTAMP NOT NULL
+			)`)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("创建迁移记录表失败: %w", err)
+	}
+	return nil
+}
+
+// SchemaVersion 返回数据库已应用的最高迁移版本（未应用任何迁移时为 0）
+func (s *Store) SchemaVersion() (int, error) {
+	if err := s.ensureMigrationTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// PendingMigrations 返回尚未应用的迁移
+// 数据库版本高于程序内置的迁移时返回错误（旧版本程序不能打开新版本的数据库）
+func (s *Store) PendingMigrations() ([]Migration, error) {
+	migrations, err := loadMigrations(s.db.dialect.migrations)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > len(migrations) {
+		return nil, fmt.Errorf("数据库结构版本 %d 高于当前程序支持的版本 %d，请使用新版本程序", version, len(migrations))
+	}
+	return migrations[version:], nil
+}
+
+// PlanMigrations 返回待执行的 SQL（不修改数据库），用于 migrate -dry-run
+// 旧版本数据库在 0001 中需要补充的列以 ALTER TABLE 语句列出
+func (s *Store) PlanMigrations() ([]Migration, error) {
+	pending, err := s.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 && pending[0].Version == 1 && s.driver == DriverSQLite {
+		stmts, err := legacyColumnStatements(s.db)
+		if err != nil {
+			return nil, err
+		}
+		for _, stmt := range stmts {
+			pending[0].SQL += "\n" + stmt + ";"
+		}
+	}
+	return pending, nil
+}
+
+// Migrate 按顺序应用尚未应用的迁移，每个迁移在独立的事务中执行，失败时回滚并停止
+// 已有数据的 SQLite 数据库在应用前先备份到 "<数据库文件>.<时间>.bak"
+func (s *Store) Migrate() ([]Migration, error) {
+	pending, err := s.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	if err := s.backup(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		ok, err := s.applyMigration(m)
+		if err != nil {
+			return applied, fmt.Errorf("应用迁移 %04d_%s 失败（已回滚）: %w", m.Version, m.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		applied = append(applied, m)
+		log.Printf("🗃️ 已应用数据库迁移 %04d_%s", m.Version, m.Name)
+	}
+	return applied, nil
+}
+
+// applyMigration 在事务中执行单个迁移并记录版本
+// 加锁后该版本已被另一个同时启动的实例应用时跳过，返回 false
+func (s *Store) applyMigration(m Migration) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := tx.lock(s.db.dialect.lockSchema); err != nil {
+		return false, err
+	}
+
+	var done int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, m.Version).Scan(&done); err != nil {
+		return false, err
+	}
+	if done > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return false, err
+	}
+	if m.Version == 1 && s.driver == DriverSQLite {
+		stmts, err := legacyColumnStatements(tx)
+		if err != nil {
+			return false, err
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return false, err
+			}
+		}
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Name, time.Now(),
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// TableCount 返回数据库中的数据表数量（不含迁移记录表）
+func (s *Store) TableCount() (int, error) {
+	var n int
+	err := s.db.QueryRow(s.db.dialect.countTables).Scan(&n)
+	return n, err
+}
+
+// backup 迁移前备份已有数据的 SQLite 数据库（新建的空数据库不备份）
+// PostgreSQL 不自动备份，升级前请使用 pg_dump
+func (s *Store) backup() error {
+	if s.driver != DriverSQLite {
+		return nil
+	}
+	if tables, _ := s.TableCount(); tables == 0 || s.path == "" {
+		return nil
+	}
+
+	dest := fmt.Sprintf("%s.%s.bak", s.path, time.Now().Format("20060102-150405"))
+	if _, err := s.db.Exec(`VACUUM INTO ?`, dest); err != nil {
+		return fmt.Errorf("迁移前备份数据库失败: %w", err)
+	}
+	log.Printf("💾 迁移前已备份数据库: %s", dest)
+	return nil
+}
@@ -0,0 +1,5 @@
+-- 同一对话的同一奖项只能获奖一次（与 SQLite 的 0002_unique_winners 对应）
+CREATE UNIQUE INDEX IF NOT EXISTS idx_winners_conv_tier ON winners(conversation_id, prize_type);
+
+-- 发奖时按奖项统计名额
+CREATE INDEX IF NOT EXISTS idx_winners_prize_type ON winners(prize_type);
@@ -0,0 +1,17 @@
+-- 会话改为随机令牌并记录有效期（与 SQLite 的 0003_expiring_sessions 对应）
+DROP TABLE IF EXISTS sessions;
+
+-- 会话表（令牌的 SHA-256 -> user_id）
+CREATE TABLE sessions (
+	token_hash   TEXT PRIMARY KEY,
+	user_id      TEXT NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL,
+	last_seen_at TIMESTAMPTZ NOT NULL,
+	expires_at   TIMESTAMPTZ NOT NULL
+);
+
+-- 退出全部设备、管理员撤销会话时按用户删除
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- 定期清理过期会话
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,16 @@
+-- 邮箱登录验证码（与 SQLite 的 0004_login_codes 对应）
+CREATE TABLE IF NOT EXISTS login_codes (
+	id         BIGSERIAL PRIMARY KEY,
+	email      TEXT NOT NULL,
+	code_hash  TEXT NOT NULL,
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	used       INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- 校验与发送频率限制时按邮箱查询
+CREATE INDEX IF NOT EXISTS idx_login_codes_email ON login_codes(email);
+
+-- 定期清理旧记录
+CREATE INDEX IF NOT EXISTS idx_login_codes_created_at ON login_codes(created_at);
@@ -0,0 +1,156 @@
+-- 初始表结构（迁移机制引入时的完整结构）
+-- 迁移机制引入前创建的数据库缺少的列，由迁移程序在应用本迁移时补充
+
+-- 用户表
+CREATE TABLE IF NOT EXISTS users (
+	id       TEXT PRIMARY KEY,
+	contact  TEXT NOT NULL,
+	nickname TEXT NOT NULL,
+	is_admin INTEGER NOT NULL DEFAULT 0
+);
+
+-- 会话表（session token -> user_id）
+CREATE TABLE IF NOT EXISTS sessions (
+	token   TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL
+);
+
+-- 对话表
+CREATE TABLE IF NOT EXISTS conversations (
+	id             TEXT PRIMARY KEY,
+	user_id        TEXT NOT NULL,
+	nickname       TEXT NOT NULL,
+	turn_count     INTEGER NOT NULL DEFAULT 0,
+	max_turns      INTEGER NOT NULL DEFAULT 20,
+	is_active      INTEGER NOT NULL DEFAULT 1,
+	is_success     INTEGER NOT NULL DEFAULT 0,
+	is_public      INTEGER NOT NULL DEFAULT 1,
+	found_password TEXT NOT NULL DEFAULT '',
+	last_message   TEXT NOT NULL DEFAULT '',
+	secrets        TEXT NOT NULL DEFAULT '',
+	level          TEXT NOT NULL DEFAULT '',
+	created_at     DATETIME NOT NULL
+);
+
+-- 消息表
+CREATE TABLE IF NOT EXISTS messages (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id   TEXT NOT NULL,
+	role              TEXT NOT NULL,
+	content           TEXT NOT NULL,
+	image_url         TEXT NOT NULL DEFAULT '',
+	model             TEXT NOT NULL DEFAULT '',
+	aborted           INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	latency_ms        INTEGER NOT NULL DEFAULT 0,
+	cost              REAL NOT NULL DEFAULT 0,
+	refused           INTEGER NOT NULL DEFAULT 0,
+	tags              TEXT NOT NULL DEFAULT '',
+	created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 获奖者表
+CREATE TABLE IF NOT EXISTS winners (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	nickname        TEXT NOT NULL,
+	conversation_id TEXT NOT NULL,
+	category        TEXT NOT NULL,
+	prize_type      TEXT NOT NULL,
+	prize_name      TEXT NOT NULL DEFAULT '',
+	prize_amount    TEXT NOT NULL,
+	password        TEXT NOT NULL,
+	detection       TEXT NOT NULL DEFAULT '',
+	timestamp       DATETIME NOT NULL
+);
+
+-- 口令首次获取标记表（键为 "<奖项ID>_first_claimed" / "<奖项ID>_claim_count"）
+CREATE TABLE IF NOT EXISTS claim_status (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+-- 用户福利口令状态表
+-- status 可选值: "offered"(已弹出选择), "continued"(选择继续挑战), "claimed_<奖项ID>"(已获得该奖项的口令)
+CREATE TABLE IF NOT EXISTS user_bonus_status (
+	user_id TEXT PRIMARY KEY,
+	status  TEXT NOT NULL DEFAULT '',
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 用户的随机口令（random_secrets.scope 为 user 时，该用户的所有对话共用）
+-- secrets 为加密后的口令，与 conversations.secrets 格式相同
+CREATE TABLE IF NOT EXISTS user_secrets (
+	user_id    TEXT PRIMARY KEY,
+	secrets    TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+-- 口令泄露审核队列（判定模型认为间接泄露的回复）
+-- status 可选值: "pending"(待审核), "approved"(已批准并发奖), "rejected"(已驳回), "awarded"(已自动发奖)
+CREATE TABLE IF NOT EXISTS leak_reviews (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL,
+	user_id         TEXT NOT NULL,
+	nickname        TEXT NOT NULL,
+	content         TEXT NOT NULL,
+	leak_type       TEXT NOT NULL,
+	confidence      REAL NOT NULL DEFAULT 0,
+	reason          TEXT NOT NULL DEFAULT '',
+	judge_model     TEXT NOT NULL DEFAULT '',
+	status          TEXT NOT NULL DEFAULT 'pending',
+	created_at      DATETIME NOT NULL,
+	resolved_at     DATETIME
+);
+
+-- 跨消息片段累计进度：对话中已透露的口令片段
+-- start / length 为片段在口令（去标点后）中的字符位置，同一片段只记录一次
+CREATE TABLE IF NOT EXISTS fragment_progress (
+	conversation_id TEXT NOT NULL,
+	tier_id         TEXT NOT NULL,
+	start           INTEGER NOT NULL,
+	length          INTEGER NOT NULL,
+	fragment        TEXT NOT NULL,
+	created_at      DATETIME NOT NULL,
+	PRIMARY KEY (conversation_id, tier_id, start, length)
+);
+
+-- 猜口令记录：玩家直接提交的口令猜测，matched_tier 为猜中的奖项 ID（未猜中为空）
+CREATE TABLE IF NOT EXISTS guesses (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id         TEXT NOT NULL,
+	conversation_id TEXT NOT NULL,
+	guess           TEXT NOT NULL,
+	matched_tier    TEXT NOT NULL DEFAULT '',
+	similarity      REAL NOT NULL DEFAULT 0,
+	created_at      DATETIME NOT NULL
+);
+
+-- 闯关进度：用户已通过的关卡（每关只记录首次通关）
+CREATE TABLE IF NOT EXISTS level_progress (
+	user_id         TEXT NOT NULL,
+	level_id        TEXT NOT NULL,
+	conversation_id TEXT NOT NULL,
+	cleared_at      DATETIME NOT NULL,
+	PRIMARY KEY (user_id, level_id)
+);
+
+-- 输出过滤拦截记录：守护者回复中被遮盖或替换的口令原文
+-- tiers 为命中的奖项 ID（逗号分隔），action 为 "redact" 或 "refuse"，content 为过滤前的回复原文
+CREATE TABLE IF NOT EXISTS blocked_leaks (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	conversation_id TEXT NOT NULL,
+	user_id         TEXT NOT NULL,
+	nickname        TEXT NOT NULL,
+	tiers           TEXT NOT NULL,
+	action          TEXT NOT NULL,
+	content         TEXT NOT NULL,
+	created_at      DATETIME NOT NULL
+);
+
+-- 索引：加速常用查询
+CREATE INDEX IF NOT EXISTS idx_messages_conv_id ON messages(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_is_public ON conversations(is_public);
+CREATE INDEX IF NOT EXISTS idx_leak_reviews_status ON leak_reviews(status);
+CREATE INDEX IF NOT EXISTS idx_guesses_user_id ON guesses(user_id, created_at);
@@ -0,0 +1,13 @@
+-- 同一对话的同一奖项只能获奖一次
+-- 并发发奖可能已产生重复的获奖记录：保留最早的一条，再建立唯一索引
+DELETE FROM winners WHERE id NOT IN (
+	SELECT MIN(id) FROM winners GROUP BY conversation_id, prize_type
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_winners_conv_tier ON winners(conversation_id, prize_type);
+
+-- 发奖时按奖项统计名额
+CREATE INDEX IF NOT EXISTS idx_winners_prize_type ON winners(prize_type);
+
+-- 获奖计数以清理后的获奖记录为准重新同步
+INSERT OR REPLACE INTO claim_status (key, value)
+	SELECT prize_type || '_claim_count', CAST(COUNT(*) AS TEXT) FROM winners GROUP BY prize_type;
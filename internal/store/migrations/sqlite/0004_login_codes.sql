@@ -0,0 +1,17 @@
+-- 邮箱登录验证码（只保存验证码的 SHA-256）
+-- 保留已使用和已过期的记录用于发送频率限制，由定期清理删除
+CREATE TABLE IF NOT EXISTS login_codes (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	email      TEXT NOT NULL,
+	code_hash  TEXT NOT NULL,
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	used       INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL
+);
+
+-- 校验与发送频率限制时按邮箱查询
+CREATE INDEX IF NOT EXISTS idx_login_codes_email ON login_codes(email);
+
+-- 定期清理旧记录
+CREATE INDEX IF NOT EXISTS idx_login_codes_created_at ON login_codes(created_at);
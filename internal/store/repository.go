@@ -0,0 +1,71 @@
+package store
+
+import (
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// Repository 数据持久化接口，处理器只依赖该接口
+// Store 为 SQLite 与 PostgreSQL 两种后端的实现，行为差异由 conformance_test.go 中的一致性检查校验
+type Repository interface {
+	Close()
+
+	// ========== 用户与会话 ==========
+	GetOrCreateUser(contact, nickname string) *model.User
+	CreateSession(userID string, ttl time.Duration) string
+	GetUserBySession(token string, ttl time.Duration) *model.User
+	DeleteSession(token string)
+	DeleteUserSessions(userID string) int
+	DeleteExpiredSessions() int
+	AddLoginCode(email, code string, ttl time.Duration)
+	CountLoginCodesSince(email string, since time.Time) int
+	GetLastLoginCodeTime(email string) time.Time
+	CheckLoginCode(email, code string, maxAttempts int) string
+	DeleteLoginCodesBefore(before time.Time) int
+
+	// ========== 对话与消息 ==========
+	CreateConversation(userID, nickname string, maxTurns int, initialMessage, level string) *model.Conversation
+	GetConversation(convID string) *model.Conversation
+	AddMessage(convID string, msg model.Message)
+	EndConversation(convID string, isSuccess bool, foundPassword string)
+	HideConversation(convID string)
+	GetUserConversations(userID string, page, pageSize int) ([]model.ConversationPreview, int)
+	GetPublicConversations(page, pageSize int) ([]model.ConversationPreview, int)
+	GetAllConversations(page, pageSize int) ([]*model.Conversation, int)
+	GetUserTotalTurnCount(userID string) int
+	GetConversationLevel(convID string) string
+	GetConversationSecrets(convID string) string
+	SetConversationSecrets(convID, sealed string)
+	GetOrSetUserSecrets(userID, sealed string) string
+
+	// ========== 获奖与福利 ==========
+	RecordWinner(nickname, convID, tierID, tierName, password, prizeAmount, detection string, quota int) (string, bool)
+	GetWinners(tierID string, page, pageSize int) ([]model.Winner, int)
+	GetWinnerCount(tierID string) int
+	HasUserWonPassword(userID, passwordType string) bool
+	IsPasswordAlreadyUsedByUser(convID, password string) bool
+	GetUserBonusStatus(userID string) string
+	SetUserBonusStatus(userID, status string)
+	ClearLevel(userID, levelID, convID string)
+	GetClearedLevels(userID string) map[string]bool
+
+	// ========== 检测记录 ==========
+	AddLeakReview(r *model.LeakReview) int64
+	GetLeakReviews(status string, page, pageSize int) ([]model.LeakReview, int)
+	GetLeakReview(id int64) *model.LeakReview
+	ResolveLeakReview(id int64, status string) *model.LeakReview
+	AddFragmentProgress(convID string, fragments []model.FragmentProgress)
+	GetFragmentProgress(convID string) []model.FragmentProgress
+	AddGuess(g *model.Guess, limits GuessLimits) (string, int, time.Duration)
+	AddBlockedLeak(b *model.BlockedLeak)
+	GetBlockedLeaks(page, pageSize int) ([]model.BlockedLeak, int)
+	GetInputTagStats() []model.InputTagStat
+
+	// ========== 用量统计 ==========
+	GetUsageTotal() model.UsageStat
+	GetUsageStats(groupBy, userID string, limit int) []model.UsageStat
+	GetSpendSince(since time.Time) (int64, float64)
+	GetUserSpendSince(userID string, since time.Time) (int64, float64)
+	GetConversationSpend(convID string) (int64, float64)
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// 审核状态
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+	ReviewAwarded  = "awarded"
+)
+
+// AddLeakReview 新增一条泄露审核记录，返回记录 ID
+func (s *Store) AddLeakReview(r *model.LeakReview) int64 {
+	now := time.Now()
+	var resolvedAt interface{}
+	if r.Status != ReviewPending {
+		resolvedAt = now
+	}
+	// RETURNING 两种后端均支持（PostgreSQL 的驱动不提供 LastInsertId）
+	var id int64
+	err := s.db.QueryRow(
+		`INSERT INTO leak_reviews (conversation_id, user_id, nickname, content, leak_type, confidence, reason, judge_model, status, created_at, resolved_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		r.ConversationID, r.UserID, r.Nickname, r.Content, r.LeakType, r.Confidence, r.Reason, r.JudgeModel, r.Status, now, resolvedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// GetLeakReviews 按状态分页获取审核记录（status 为空时返回全部），最新的在前
+func (s *Store) GetLeakReviews(status string, page, pageSize int) ([]model.LeakReview, int) {
+	where := ""
+	args := []interface{}{}
+	if status != "" {
+		where = ` WHERE status = ?`
+		args = append(args, status)
+	}
+
+	var total int
+	s.db.QueryRow(`SELECT COUNT(*) FROM leak_reviews`+where, args...).Scan(&total)
+
+	offset := (page - 1) * pageSize
+	rows, err := s.db.Query(
+		`SELECT `+reviewColumns+` FROM leak_reviews`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, pageSize, offset)...,
+	)
+	if err != nil {
+		return []model.LeakReview{}, total
+	}
+	defer rows.Close()
+
+	reviews := []model.LeakReview{}
+	for rows.Next() {
+		if r, err := scanReview(rows); err == nil {
+			reviews = append(reviews, *r)
+		}
+	}
+	return reviews, total
+}
+
+// GetLeakReview 按 ID 获取审核记录，不存在时返回 nil
+func (s *Store) GetLeakReview(id int64) *model.LeakReview {
+	r, err := scanReview(s.db.QueryRow(`SELECT `+reviewColumns+` FROM leak_reviews WHERE id = ?`, id))
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+// ResolveLeakReview 处理一条待审核记录，返回处理后的记录
+// 仅 pending 状态可被处理；记录不存在或已处理时返回 nil（并发处理时只有一方成功）
+func (s *Store) ResolveLeakReview(id int64, status string) *model.LeakReview {
+	res, err := s.db.Exec(
+		`UPDATE leak_reviews SET status = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+		status, time.Now(), id, ReviewPending,
+	)
+	if err != nil {
+		return nil
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil
+	}
+
+	return s.GetLeakReview(id)
+}
+
+// reviewColumns 审核记录的查询列（与 scanReview 顺序一致）
+const reviewColumns = `id, conversation_id, user_id, nickname, content, leak_type, confidence, reason, judge_model, status, created_at, resolved_at`
+
+// scanReview 扫描一行审核记录
+func scanReview(row interface{ Scan(...interface{}) error }) (*model.LeakReview, error) {
+	var r model.LeakReview
+	var resolvedAt sql.NullTime
+	err := row.Scan(
+		&r.ID, &r.ConversationID, &r.UserID, &r.Nickname, &r.Content, &r.LeakType,
+		&r.Confidence, &r.Reason, &r.JudgeModel, &r.Status, &r.CreatedAt, &resolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		r.ResolvedAt = &resolvedAt.Time
+	}
+	return &r, nil
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// GetConversationSecrets 获取对话加密保存的随机口令，未生成时返回空
+func (s *Store) GetConversationSecrets(convID string) string {
+	var sealed string
+	s.db.QueryRow(`SELECT secrets FROM conversations WHERE id = ?`, convID).Scan(&sealed)
+	return sealed
+}
+
+// SetConversationSecrets 保存对话的随机口令（已加密）
+func (s *Store) SetConversationSecrets(convID, sealed string) {
+	if _, err := s.db.Exec(`UPDATE conversations SET secrets = ? WHERE id = ?`, sealed, convID); err != nil {
+		log.Printf("保存对话口令失败: %v", err)
+	}
+}
+
+// GetOrSetUserSecrets 获取用户的随机口令，尚未生成时保存 sealed
+// 返回最终生效的口令（并发创建对话时以先写入者为准）
+func (s *Store) GetOrSetUserSecrets(userID, sealed string) string {
+	_, err := s.db.Exec(
+		`INSERT INTO user_secrets (user_id, secrets, created_at) VALUES (?, ?, ?)
+		 ON CONFLICT(user_id) DO NOTHING`,
+		userID, sealed, time.Now(),
+	)
+	if err != nil {
+		log.Printf("保存用户口令失败: %v", err)
+		return sealed
+	}
+
+	var stored string
+	if err := s.db.QueryRow(`SELECT secrets FROM user_secrets WHERE user_id = ?`, userID).Scan(&stored); err != nil {
+		return sealed
+	}
+	return stored
+}
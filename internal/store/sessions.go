@@ -0,0 +1,96 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// sessionRenewInterval 会话续期的最小间隔：同一会话在此间隔内的多次访问只续期一次，避免每个请求都写库
+const sessionRenewInterval = time.Minute
+
+// hashSessionToken 数据库只保存令牌的 SHA-256，泄露数据库不会泄露可用的令牌
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession 创建会话，返回 256 位随机令牌；会话在 ttl 内无访问即过期
+func (s *Store) CreateSession(userID string, ttl time.Duration) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	_, err := s.db.Exec(
+		`INSERT INTO sessions (token_hash, user_id, created_at, last_seen_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		hashSessionToken(token), userID, now, now, now.Add(ttl),
+	)
+	if err != nil {
+		log.Printf("创建会话失败: %v", err)
+		return ""
+	}
+	return token
+}
+
+// GetUserBySession 通过会话令牌获取用户，会话不存在或已过期时返回 nil
+// 会话有效时将过期时间顺延为 ttl 之后（滑动续期）
+func (s *Store) GetUserBySession(token string, ttl time.Duration) *model.User {
+	if token == "" {
+		return nil
+	}
+	hash := hashSessionToken(token)
+	var userID string
+	var lastSeen, expiresAt time.Time
+	err := s.db.QueryRow(
+		`SELECT user_id, last_seen_at, expires_at FROM sessions WHERE token_hash = ?`, hash,
+	).Scan(&userID, &lastSeen, &expiresAt)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if !now.Before(expiresAt) {
+		s.db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, hash)
+		return nil
+	}
+	if now.Sub(lastSeen) >= sessionRenewInterval {
+		s.db.Exec(
+			`UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE token_hash = ?`,
+			now, now.Add(ttl), hash,
+		)
+	}
+	return s.getUserByID(userID)
+}
+
+// DeleteSession 删除会话
+func (s *Store) DeleteSession(token string) {
+	s.db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, hashSessionToken(token))
+}
+
+// DeleteUserSessions 删除用户的全部会话（所有设备退出登录），返回删除的会话数
+func (s *Store) DeleteUserSessions(userID string) int {
+	res, err := s.db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		log.Printf("删除用户会话失败: %v", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
+
+// DeleteExpiredSessions 清理已过期的会话，返回清理的会话数
+func (s *Store) DeleteExpiredSessions() int {
+	res, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		log.Printf("清理过期会话失败: %v", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
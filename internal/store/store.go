@@ -6,118 +6,60 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
 	"time"
 
 	"ai-guardian-challenge/internal/model"
-
-	_ "modernc.org/sqlite"
 )
 
-// Store SQLite 数据存储
+// Store 基于 database/sql 的数据存储，支持 SQLite 与 PostgreSQL 两种后端
 type Store struct {
-	db *sql.DB
+	db     *sqlDB
+	driver string
+	path   string // SQLite 数据库文件（迁移前备份用）
 }
 
-// New 创建 SQLite 存储实例，自动初始化表结构
-func New(dbPath string) *Store {
-	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+// Store 实现 Repository
+var _ Repository = (*Store)(nil)
+
+// New 创建存储实例，自动应用尚未应用的表结构迁移
+// driver 为 sqlite 时 source 为数据库文件路径，为 postgres 时为连接串
+func New(driver, source string) *Store {
+	s, err := Open(driver, source)
 	if err != nil {
 		log.Fatalf("打开数据库失败: %v", err)
 	}
-
-	// 测试连接
-	if err := db.Ping(); err != nil {
-		log.Fatalf("数据库连接失败: %v", err)
+	if _, err := s.Migrate(); err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
 	}
-
-	s := &Store{db: db}
-	s.initTables()
 	return s
 }
 
-// initTables 初始化数据库表
-func (s *Store) initTables() {
-	queries := []string{
-		// 用户表
-		`CREATE TABLE IF NOT EXISTS users (
-			id       TEXT PRIMARY KEY,
-			contact  TEXT NOT NULL,
-			nickname TEXT NOT NULL,
-			is_admin INTEGER NOT NULL DEFAULT 0
-		)`,
-
-		// 会话表（session token -> user_id）
-		`CREATE TABLE IF NOT EXISTS sessions (
-			token   TEXT PRIMARY KEY,
-			user_id TEXT NOT NULL
-		)`,
-
-		// 对话表
-		`CREATE TABLE IF NOT EXISTS conversations (
-			id             TEXT PRIMARY KEY,
-			user_id        TEXT NOT NULL,
-			nickname       TEXT NOT NULL,
-			turn_count     INTEGER NOT NULL DEFAULT 0,
-			max_turns      INTEGER NOT NULL DEFAULT 20,
-			is_active      INTEGER NOT NULL DEFAULT 1,
-			is_success     INTEGER NOT NULL DEFAULT 0,
-			is_public      INTEGER NOT NULL DEFAULT 1,
-			found_password TEXT NOT NULL DEFAULT '',
-			last_message   TEXT NOT NULL DEFAULT '',
-			created_at     DATETIME NOT NULL
-		)`,
-
-		// 消息表
-		`CREATE TABLE IF NOT EXISTS messages (
-			id              INTEGER PRIMARY KEY AUTOINCREMENT,
-			conversation_id TEXT NOT NULL,
-			role            TEXT NOT NULL,
-			content         TEXT NOT NULL,
-			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// 获奖者表
-		`CREATE TABLE IF NOT EXISTS winners (
-			id              INTEGER PRIMARY KEY AUTOINCREMENT,
-			nickname        TEXT NOT NULL,
-			conversation_id TEXT NOT NULL,
-			category        TEXT NOT NULL,
-			prize_type      TEXT NOT NULL,
-			prize_amount    TEXT NOT NULL,
-			password        TEXT NOT NULL,
-			timestamp       DATETIME NOT NULL
-		)`,
-
-		// 口令首次获取标记表
-		`CREATE TABLE IF NOT EXISTS claim_status (
-			key   TEXT PRIMARY KEY,
-			value TEXT NOT NULL
-		)`,
-
-		// 用户福利口令状态表
-		// status 可选值: "offered"(已弹出选择), "continued"(选择继续挑战), "claimed_consolation"(已领取福利口令), "claimed_grand"(已获得主口令)
-		`CREATE TABLE IF NOT EXISTS user_bonus_status (
-			user_id TEXT PRIMARY KEY,
-			status  TEXT NOT NULL DEFAULT '',
-			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// 索引：加速常用查询
-		`CREATE INDEX IF NOT EXISTS idx_messages_conv_id ON messages(conversation_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_conversations_is_public ON conversations(is_public)`,
-	}
-
-	for _, q := range queries {
-		if _, err := s.db.Exec(q); err != nil {
-			log.Fatalf("初始化表结构失败: %v\nSQL: %s", err, q)
-		}
+// Open 打开数据库，不应用迁移（用于 migrate 子命令）
+func Open(driver, source string) (*Store, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的数据库类型 %q", driver)
+	}
+
+	dsn, path := source, ""
+	if driver == DriverSQLite {
+		// 事务使用 BEGIN IMMEDIATE：开始时即获取写锁，避免事务内先读后写时升级写锁失败
+		dsn = source + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+		path = source
+	}
+	db, err := sql.Open(d.driverName, dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	// 初始化 claim_status 默认值（如果不存在）
-	for _, key := range []string{"grand_first_claimed", "consolation_first_claimed", "consolation_claim_count"} {
-		s.db.Exec(`INSERT OR IGNORE INTO claim_status (key, value) VALUES (?, '0')`, key)
+	// 测试连接
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
 	}
+
+	return &Store{db: &sqlDB{DB: db, dialect: d}, driver: driver, path: path}, nil
 }
 
 // Close 关闭数据库连接
@@ -171,41 +113,17 @@ func (s *Store) getUserByID(userID string) *model.User {
 	return &user
 }
 
-// ========== Session 操作 ==========
-
-// CreateSession 创建会话
-func (s *Store) CreateSession(userID string) string {
-	token := fmt.Sprintf("%d-%s", time.Now().UnixMilli(), userID)
-	s.db.Exec(`INSERT INTO sessions (token, user_id) VALUES (?, ?)`, token, userID)
-	return token
-}
-
-// GetUserBySession 通过会话令牌获取用户
-func (s *Store) GetUserBySession(token string) *model.User {
-	row := s.db.QueryRow(`SELECT user_id FROM sessions WHERE token = ?`, token)
-	var userID string
-	if err := row.Scan(&userID); err != nil {
-		return nil
-	}
-	return s.getUserByID(userID)
-}
-
-// DeleteSession 删除会话
-func (s *Store) DeleteSession(token string) {
-	s.db.Exec(`DELETE FROM sessions WHERE token = ?`, token)
-}
-
 // ========== 对话操作 ==========
 
-// CreateConversation 创建新对话
-func (s *Store) CreateConversation(userID, nickname string, maxTurns int, initialMessage string) *model.Conversation {
+// CreateConversation 创建新对话，level 为关卡 ID（未开启闯关模式时为空）
+func (s *Store) CreateConversation(userID, nickname string, maxTurns int, initialMessage, level string) *model.Conversation {
 	convID := fmt.Sprintf("%d-%s", time.Now().UnixMilli(), generateID())
 	now := time.Now()
 
 	_, err := s.db.Exec(
-		`INSERT INTO conversations (id, user_id, nickname, turn_count, max_turns, is_active, is_success, is_public, found_password, last_message, created_at)
-		 VALUES (?, ?, ?, 0, ?, 1, 0, 1, '', '', ?)`,
-		convID, userID, nickname, maxTurns, now,
+		`INSERT INTO conversations (id, user_id, nickname, turn_count, max_turns, is_active, is_success, is_public, found_password, last_message, level, created_at)
+		 VALUES (?, ?, ?, 0, ?, 1, 0, 1, '', '', ?, ?)`,
+		convID, userID, nickname, maxTurns, level, now,
 	)
 	if err != nil {
 		log.Printf("创建对话失败: %v", err)
@@ -227,6 +145,7 @@ func (s *Store) CreateConversation(userID, nickname string, maxTurns int, initia
 		MaxTurns:  maxTurns,
 		IsActive:  true,
 		IsPublic:  true,
+		Level:     level,
 		CreatedAt: now,
 	}
 }
@@ -234,7 +153,7 @@ func (s *Store) CreateConversation(userID, nickname string, maxTurns int, initia
 // GetConversation 获取对话详情（含全部消息）
 func (s *Store) GetConversation(convID string) *model.Conversation {
 	row := s.db.QueryRow(
-		`SELECT id, user_id, nickname, turn_count, max_turns, is_active, is_success, is_public, found_password, last_message, created_at
+		`SELECT id, user_id, nickname, turn_count, max_turns, is_active, is_success, is_public, found_password, last_message, level, created_at
 		 FROM conversations WHERE id = ?`, convID,
 	)
 
@@ -244,7 +163,7 @@ func (s *Store) GetConversation(convID string) *model.Conversation {
 		&conv.ID, &conv.UserID, &conv.Nickname,
 		&conv.TurnCount, &conv.MaxTurns,
 		&isActive, &isSuccess, &isPublic,
-		&conv.FoundPassword, &conv.LastMessage, &conv.CreatedAt,
+		&conv.FoundPassword, &conv.LastMessage, &conv.Level, &conv.CreatedAt,
 	)
 	if err != nil {
 		return nil
@@ -263,7 +182,8 @@ func (s *Store) GetConversation(convID string) *model.Conversation {
 // getConversationMessages 获取对话的所有消息
 func (s *Store) getConversationMessages(convID string) []model.Message {
 	rows, err := s.db.Query(
-		`SELECT role, content FROM messages WHERE conversation_id = ? ORDER BY id ASC`, convID,
+		`SELECT role, content, image_url, model, aborted, refused, tags, prompt_tokens, completion_tokens, latency_ms, cost
+		 FROM messages WHERE conversation_id = ? ORDER BY id ASC`, convID,
 	)
 	if err != nil {
 		return nil
@@ -273,7 +193,16 @@ func (s *Store) getConversationMessages(convID string) []model.Message {
 	var messages []model.Message
 	for rows.Next() {
 		var msg model.Message
-		if err := rows.Scan(&msg.Role, &msg.Content); err == nil {
+		var aborted, refused int
+		var tags string
+		err := rows.Scan(
+			&msg.Role, &msg.Content, &msg.ImageURL, &msg.Model, &aborted, &refused, &tags,
+			&msg.PromptTokens, &msg.CompletionTokens, &msg.LatencyMS, &msg.Cost,
+		)
+		if err == nil {
+			msg.Aborted = aborted == 1
+			msg.Refused = refused == 1
+			msg.Tags = splitTags(tags)
 			messages = append(messages, msg)
 		}
 	}
@@ -282,10 +211,20 @@ func (s *Store) getConversationMessages(convID string) []model.Message {
 
 // AddMessage 向对话追加消息
 func (s *Store) AddMessage(convID string, msg model.Message) {
+	abortedInt, refusedInt := 0, 0
+	if msg.Aborted {
+		abortedInt = 1
+	}
+	if msg.Refused {
+		refusedInt = 1
+	}
+
 	// 插入消息
 	s.db.Exec(
-		`INSERT INTO messages (conversation_id, role, content, created_at) VALUES (?, ?, ?, ?)`,
-		convID, msg.Role, msg.Content, time.Now(),
+		`INSERT INTO messages (conversation_id, role, content, image_url, model, aborted, refused, tags, prompt_tokens, completion_tokens, latency_ms, cost, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		convID, msg.Role, msg.Content, msg.ImageURL, msg.Model, abortedInt, refusedInt, strings.Join(msg.Tags, ","),
+		msg.PromptTokens, msg.CompletionTokens, msg.LatencyMS, msg.Cost, time.Now(),
 	)
 
 	// 预览文本
@@ -293,6 +232,9 @@ func (s *Store) AddMessage(convID string, msg model.Message) {
 	if len(content) > 100 {
 		content = content[:100] + "..."
 	}
+	if content == "" && msg.ImageURL != "" {
+		content = "[图片]"
+	}
 
 	// 用户消息计入轮次
 	if msg.Role == "user" {
@@ -335,7 +277,7 @@ func (s *Store) GetUserConversations(userID string, page, pageSize int) ([]model
 
 	offset := (page - 1) * pageSize
 	rows, err := s.db.Query(
-		`SELECT id, nickname, is_success, is_active, turn_count, max_turns, last_message, found_password, created_at
+		`SELECT id, nickname, is_success, is_active, turn_count, max_turns, last_message, found_password, level, created_at
 		 FROM conversations WHERE user_id = ?
 		 ORDER BY created_at DESC LIMIT ? OFFSET ?`,
 		userID, pageSize, offset,
@@ -349,7 +291,7 @@ func (s *Store) GetUserConversations(userID string, page, pageSize int) ([]model
 	for rows.Next() {
 		var p model.ConversationPreview
 		var isSuccess, isActive int
-		if err := rows.Scan(&p.ID, &p.Nickname, &isSuccess, &isActive, &p.TurnCount, &p.MaxTurns, &p.LastMessage, &p.FoundPassword, &p.CreatedAt); err == nil {
+		if err := rows.Scan(&p.ID, &p.Nickname, &isSuccess, &isActive, &p.TurnCount, &p.MaxTurns, &p.LastMessage, &p.FoundPassword, &p.Level, &p.CreatedAt); err == nil {
 			p.IsSuccess = isSuccess == 1
 			p.IsActive = isActive == 1
 			p.Preview = p.LastMessage
@@ -370,7 +312,7 @@ func (s *Store) GetPublicConversations(page, pageSize int) ([]model.Conversation
 
 	offset := (page - 1) * pageSize
 	rows, err := s.db.Query(
-		`SELECT id, nickname, is_success, turn_count, created_at
+		`SELECT id, nickname, is_success, turn_count, level, created_at
 		 FROM conversations WHERE is_public = 1
 		 ORDER BY created_at DESC LIMIT ? OFFSET ?`,
 		pageSize, offset,
@@ -384,7 +326,7 @@ func (s *Store) GetPublicConversations(page, pageSize int) ([]model.Conversation
 	for rows.Next() {
 		var p model.ConversationPreview
 		var isSuccess int
-		if err := rows.Scan(&p.ID, &p.Nickname, &isSuccess, &p.TurnCount, &p.CreatedAt); err == nil {
+		if err := rows.Scan(&p.ID, &p.Nickname, &isSuccess, &p.TurnCount, &p.Level, &p.CreatedAt); err == nil {
 			p.IsSuccess = isSuccess == 1
 
 			// 获取用户的第一条消息作为预览
@@ -416,68 +358,107 @@ func (s *Store) GetPublicConversations(page, pageSize int) ([]model.Conversation
 
 // ========== 获奖操作 ==========
 
-// RecordWinner 记录获奖者、返回是否为第一个获奖者
-func (s *Store) RecordWinner(nickname, convID, passwordType, password, prizeAmount string) bool {
-	isFirst := false
-	category := ""
+// 发奖结果（RecordWinner 的返回值）
+const (
+	AwardGranted   = "granted"   // 已记录获奖
+	AwardDuplicate = "duplicate" // 该对话已获得过该奖项，未重复记录
+	AwardSoldOut   = "sold_out"  // 奖项名额已满，未记录
+	AwardFailed    = "failed"    // 数据库错误，未记录
+)
 
-	switch passwordType {
-	case "grand":
-		if s.getClaimStatus("grand_first_claimed") == "0" {
-			s.setClaimStatus("grand_first_claimed", "1")
-			isFirst = true
-			category = "grand-first"
-		} else {
-			category = "grand-subsequent"
+// RecordWinner 记录获奖者，返回发奖结果及是否为该奖项的第一个获奖者
+// tierID 为奖项 ID，获奖类别记为 "<奖项ID>-first" 或 "<奖项ID>-subsequent"；detection 为口令的泄露方式
+// 猜中口令（detection 为 DetectionGuess）的获奖类别记为 "<奖项ID>-deduced"，不占用首位获奖者
+// quota 为奖项名额（0 表示不限）。名额检查、首位标记、获奖记录与计数在同一个事务中完成，
+// 并发发奖不会超出名额或出现多个首位获奖者；同一对话的同一奖项只记录一次
+func (s *Store) RecordWinner(nickname, convID, tierID, tierName, password, prizeAmount, detection string, quota int) (string, bool) {
+	result, isFirst, err := s.recordWinner(nickname, convID, tierID, tierName, password, prizeAmount, detection, quota)
+	if err != nil {
+		log.Printf("记录获奖失败: 对话 %s, 奖项 %s: %v", convID, tierID, err)
+		return AwardFailed, false
+	}
+	return result, isFirst
+}
+
+func (s *Store) recordWinner(nickname, convID, tierID, tierName, password, prizeAmount, detection string, quota int) (string, bool, error) {
+	// 持有写锁期间其他发奖事务等待（SQLite 以 BEGIN IMMEDIATE 开始事务，PostgreSQL 锁定 winners 表）
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+	if err := tx.lock(s.db.dialect.lockAward); err != nil {
+		return "", false, err
+	}
+
+	var count, owned int
+	err = tx.QueryRow(
+		`SELECT COUNT(*), COUNT(CASE WHEN conversation_id = ? THEN 1 END) FROM winners WHERE prize_type = ?`,
+		convID, tierID,
+	).Scan(&count, &owned)
+	if err != nil {
+		return "", false, err
+	}
+	if owned > 0 {
+		return AwardDuplicate, false, nil
+	}
+	if quota > 0 && count >= quota {
+		return AwardSoldOut, false, nil
+	}
+
+	isFirst := false
+	category := tierID + "-subsequent"
+	if detection == DetectionGuess {
+		category = tierID + "-deduced"
+	} else {
+		// 条件更新：只有标记尚未置位时才会影响一行
+		res, err := tx.Exec(
+			`INSERT INTO claim_status (key, value) VALUES (?, '1')
+			 ON CONFLICT(key) DO UPDATE SET value = '1' WHERE claim_status.value != '1'`,
+			tierID+"_first_claimed",
+		)
+		if err != nil {
+			return "", false, err
 		}
-	case "consolation":
-		if s.getClaimStatus("consolation_first_claimed") == "0" {
-			s.setClaimStatus("consolation_first_claimed", "1")
+		if n, _ := res.RowsAffected(); n > 0 {
 			isFirst = true
-			category = "consolation-first"
-		} else {
-			category = "consolation-subsequent"
+			category = tierID + "-first"
 		}
-		count := s.getClaimStatus("consolation_claim_count")
-		var c int
-		fmt.Sscanf(count, "%d", &c)
-		s.setClaimStatus("consolation_claim_count", fmt.Sprintf("%d", c+1))
 	}
 
-	s.db.Exec(
-		`INSERT INTO winners (nickname, conversation_id, category, prize_type, prize_amount, password, timestamp)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		nickname, convID, category, passwordType, prizeAmount, password, time.Now(),
-	)
-
-	return isFirst
-}
-
-// getClaimStatus 获取口令声明状态
-func (s *Store) getClaimStatus(key string) string {
-	var value string
-	err := s.db.QueryRow(`SELECT value FROM claim_status WHERE key = ?`, key).Scan(&value)
-	if err != nil {
-		return "0"
+	// 唯一索引 (conversation_id, prize_type) 兜底，重复记录时事务回滚
+	if _, err := tx.Exec(
+		`INSERT INTO winners (nickname, conversation_id, category, prize_type, prize_name, prize_amount, password, detection, timestamp)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nickname, convID, category, tierID, tierName, prizeAmount, password, detection, time.Now(),
+	); err != nil {
+		return "", false, err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO claim_status (key, value) VALUES (?, '1')
+		 ON CONFLICT(key) DO UPDATE SET value = CAST(CAST(claim_status.value AS INTEGER) + 1 AS TEXT)`,
+		tierID+"_claim_count",
+	); err != nil {
+		return "", false, err
 	}
-	return value
-}
 
-// setClaimStatus 设置口令声明状态
-func (s *Store) setClaimStatus(key, value string) {
-	s.db.Exec(`INSERT OR REPLACE INTO claim_status (key, value) VALUES (?, ?)`, key, value)
+	if err := tx.Commit(); err != nil {
+		return "", false, err
+	}
+	return AwardGranted, isFirst, nil
 }
 
-// GetWinners 获取获奖者列表（分页）
-func (s *Store) GetWinners(page, pageSize int) ([]model.Winner, int) {
+// GetWinners 获取获奖者列表（分页），tierID 不为空时只返回该奖项（关卡）的获奖者
+func (s *Store) GetWinners(tierID string, page, pageSize int) ([]model.Winner, int) {
 	var total int
-	s.db.QueryRow(`SELECT COUNT(*) FROM winners`).Scan(&total)
+	s.db.QueryRow(`SELECT COUNT(*) FROM winners WHERE ? = '' OR prize_type = ?`, tierID, tierID).Scan(&total)
 
 	offset := (page - 1) * pageSize
 	rows, err := s.db.Query(
-		`SELECT nickname, conversation_id, category, prize_type, prize_amount, password, timestamp
-		 FROM winners ORDER BY timestamp DESC LIMIT ? OFFSET ?`,
-		pageSize, offset,
+		`SELECT nickname, conversation_id, category, prize_type, prize_name, prize_amount, password, detection, timestamp
+		 FROM winners WHERE ? = '' OR prize_type = ?
+		 ORDER BY timestamp DESC LIMIT ? OFFSET ?`,
+		tierID, tierID, pageSize, offset,
 	)
 	if err != nil {
 		return []model.Winner{}, total
@@ -487,7 +468,7 @@ func (s *Store) GetWinners(page, pageSize int) ([]model.Winner, int) {
 	var winners []model.Winner
 	for rows.Next() {
 		var w model.Winner
-		if err := rows.Scan(&w.Nickname, &w.ConversationID, &w.Category, &w.PrizeType, &w.PrizeAmount, &w.Password, &w.Timestamp); err == nil {
+		if err := rows.Scan(&w.Nickname, &w.ConversationID, &w.Category, &w.PrizeType, &w.PrizeName, &w.PrizeAmount, &w.Password, &w.Detection, &w.Timestamp); err == nil {
 			winners = append(winners, w)
 		}
 	}
@@ -510,7 +491,7 @@ func (s *Store) GetAllConversations(page, pageSize int) ([]*model.Conversation,
 
 	offset := (page - 1) * pageSize
 	rows, err := s.db.Query(
-		`SELECT id, user_id, nickname, turn_count, max_turns, is_active, is_success, is_public, found_password, last_message, created_at
+		`SELECT id, user_id, nickname, turn_count, max_turns, is_active, is_success, is_public, found_password, last_message, level, created_at
 		 FROM conversations ORDER BY created_at DESC LIMIT ? OFFSET ?`,
 		pageSize, offset,
 	)
@@ -527,7 +508,7 @@ func (s *Store) GetAllConversations(page, pageSize int) ([]*model.Conversation,
 			&conv.ID, &conv.UserID, &conv.Nickname,
 			&conv.TurnCount, &conv.MaxTurns,
 			&isActive, &isSuccess, &isPublic,
-			&conv.FoundPassword, &conv.LastMessage, &conv.CreatedAt,
+			&conv.FoundPassword, &conv.LastMessage, &conv.Level, &conv.CreatedAt,
 		); err == nil {
 			conv.IsActive = isActive == 1
 			conv.IsSuccess = isSuccess == 1
@@ -556,7 +537,7 @@ func (s *Store) GetUserTotalTurnCount(userID string) int {
 }
 
 // HasUserWonPassword 检查用户是否已经赢得过指定类型的口令
-// passwordType: "grand" 或 "consolation"
+// passwordType 为奖项 ID
 func (s *Store) HasUserWonPassword(userID, passwordType string) bool {
 	var count int
 	err := s.db.QueryRow(
@@ -571,22 +552,15 @@ func (s *Store) HasUserWonPassword(userID, passwordType string) bool {
 	return count > 0
 }
 
-// GetGrandWinnerCount 获取主口令已发放数量
-func (s *Store) GetGrandWinnerCount() int {
-	var count int
-	s.db.QueryRow(`SELECT COUNT(*) FROM winners WHERE prize_type = 'grand'`).Scan(&count)
-	return count
-}
-
-// GetConsolationWinnerCount 获取福利口令已发放数量
-func (s *Store) GetConsolationWinnerCount() int {
+// GetWinnerCount 获取指定奖项已发放数量
+func (s *Store) GetWinnerCount(tierID string) int {
 	var count int
-	s.db.QueryRow(`SELECT COUNT(*) FROM winners WHERE prize_type = 'consolation'`).Scan(&count)
+	s.db.QueryRow(`SELECT COUNT(*) FROM winners WHERE prize_type = ?`, tierID).Scan(&count)
 	return count
 }
 
 // GetUserBonusStatus 获取用户的福利口令状态
-// 返回值: ""(未触发), "offered"(已弹出选择), "continued"(选择继续), "claimed_consolation", "claimed_grand"
+// 返回值: ""(未触发), "offered"(已弹出选择), "continued"(选择继续), "claimed_<奖项ID>"
 func (s *Store) GetUserBonusStatus(userID string) string {
 	var status string
 	err := s.db.QueryRow(`SELECT status FROM user_bonus_status WHERE user_id = ?`, userID).Scan(&status)
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// openTestStore 在临时目录中打开一个空的 SQLite 数据库（已执行迁移），测试结束后自动关闭
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(s.Close)
+	if _, err := s.Migrate(); err != nil {
+		t.Fatalf("数据库迁移失败: %v", err)
+	}
+	return s
+}
+
+// TestRecordWinnerConcurrent 并发发奖：同一对话不重复获奖，名额不超发，首位获奖者只有一个
+func TestRecordWinnerConcurrent(t *testing.T) {
+	const goroutines = 40
+	tests := []struct {
+		name  string
+		convs int // 参与的对话数，goroutine 轮流使用
+		quota int
+		// 期望各结果的数量
+		granted, duplicate, soldOut int
+	}{
+		{"同一对话同一奖项", 1, 0, 1, goroutines - 1, 0},
+		{"名额已满", goroutines, 5, 5, 0, goroutines - 5},
+		{"重复与名额同时竞争", 10, 5, 5, 15, 20}, // 抢到名额的 5 个对话各重复 3 次，其余 5 个对话的 20 次均无名额
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+
+			var mu sync.Mutex
+			results := map[string]int{}
+			firsts := 0
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func(convID string) {
+					defer wg.Done()
+					result, first := s.RecordWinner("丁", convID, "grand", "大奖", "芝麻开门", "100元", "direct", tt.quota)
+					mu.Lock()
+					defer mu.Unlock()
+					results[result]++
+					if first {
+						firsts++
+					}
+				}(fmt.Sprintf("conv-%d", i%tt.convs))
+			}
+			wg.Wait()
+
+			if results[AwardFailed] != 0 {
+				t.Fatalf("并发发奖出现数据库错误: %v", results)
+			}
+			if results[AwardGranted] != tt.granted || results[AwardDuplicate] != tt.duplicate || results[AwardSoldOut] != tt.soldOut {
+				t.Errorf("发奖结果 %v，期望 granted=%d duplicate=%d sold_out=%d", results, tt.granted, tt.duplicate, tt.soldOut)
+			}
+			if firsts != 1 {
+				t.Errorf("首位获奖者应只有 1 个，实际 %d 个", firsts)
+			}
+			if n := s.GetWinnerCount("grand"); n != tt.granted {
+				t.Errorf("获奖记录数为 %d，期望 %d", n, tt.granted)
+			}
+			if tt.quota > 0 && s.GetWinnerCount("grand") > tt.quota {
+				t.Errorf("获奖记录数超出名额 %d", tt.quota)
+			}
+		})
+	}
+}
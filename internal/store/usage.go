@@ -0,0 +1,106 @@
+package store
+
+import (
+	"time"
+
+	"ai-guardian-challenge/internal/model"
+)
+
+// 用量汇总维度
+const (
+	UsageByUser         = "user"
+	UsageByConversation = "conversation"
+	UsageByModel        = "model"
+)
+
+// usageColumns 汇总查询的公共聚合列（仅统计实际调用过模型的 AI 回复）
+const usageColumns = `COUNT(*), COALESCE(SUM(m.prompt_tokens), 0), COALESCE(SUM(m.completion_tokens), 0),
+	COALESCE(SUM(m.cost), 0), CAST(COALESCE(AVG(m.latency_ms), 0) AS INTEGER)`
+
+// GetUsageTotal 获取全站 token 用量与费用合计
+func (s *Store) GetUsageTotal() model.UsageStat {
+	var stat model.UsageStat
+	row := s.db.QueryRow(
+		`SELECT COUNT(DISTINCT m.conversation_id), ` + usageColumns + `
+		 FROM messages m WHERE m.role = 'assistant' AND m.model != ''`,
+	)
+	row.Scan(&stat.Conversations, &stat.Messages, &stat.PromptTokens, &stat.CompletionTokens, &stat.Cost, &stat.AvgLatencyMS)
+	stat.Key = "total"
+	return stat
+}
+
+// GetUsageStats 按维度汇总 token 用量与费用，按费用（其次 token 总量）降序
+// groupBy 取 UsageByUser / UsageByConversation / UsageByModel；userID 非空时只统计该用户
+func (s *Store) GetUsageStats(groupBy, userID string, limit int) []model.UsageStat {
+	var keyExpr, labelExpr string
+	switch groupBy {
+	case UsageByConversation:
+		keyExpr, labelExpr = "c.id", "MAX(c.nickname)"
+	case UsageByModel:
+		keyExpr, labelExpr = "m.model", "''"
+	default:
+		keyExpr, labelExpr = "c.user_id", "MAX(c.nickname)"
+	}
+
+	query := `SELECT ` + keyExpr + `, ` + labelExpr + `, COUNT(DISTINCT c.id), ` + usageColumns + `
+		FROM messages m JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.role = 'assistant' AND m.model != ''`
+	args := []interface{}{}
+	if userID != "" {
+		query += ` AND c.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` GROUP BY ` + keyExpr + `
+		ORDER BY SUM(m.cost) DESC, SUM(m.prompt_tokens + m.completion_tokens) DESC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return []model.UsageStat{}
+	}
+	defer rows.Close()
+
+	stats := []model.UsageStat{}
+	for rows.Next() {
+		var stat model.UsageStat
+		err := rows.Scan(
+			&stat.Key, &stat.Label, &stat.Conversations,
+			&stat.Messages, &stat.PromptTokens, &stat.CompletionTokens, &stat.Cost, &stat.AvgLatencyMS,
+		)
+		if err == nil {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+// GetSpendSince 获取全站自 since 起的 token 总量与费用
+func (s *Store) GetSpendSince(since time.Time) (int64, float64) {
+	return s.querySpend(`WHERE m.created_at >= ?`, since.In(time.Local))
+}
+
+// GetUserSpendSince 获取指定用户自 since 起的 token 总量与费用
+func (s *Store) GetUserSpendSince(userID string, since time.Time) (int64, float64) {
+	return s.querySpend(
+		`JOIN conversations c ON c.id = m.conversation_id WHERE c.user_id = ? AND m.created_at >= ?`,
+		userID, since.In(time.Local),
+	)
+}
+
+// GetConversationSpend 获取指定对话累计的 token 总量与费用
+func (s *Store) GetConversationSpend(convID string) (int64, float64) {
+	return s.querySpend(`WHERE m.conversation_id = ?`, convID)
+}
+
+// querySpend 按条件汇总消息表中的 token 与费用
+// created_at 以 time.Now() 的文本形式写入，比较时参数需使用同一时区（time.Local）
+func (s *Store) querySpend(where string, args ...interface{}) (int64, float64) {
+	var tokens int64
+	var cost float64
+	s.db.QueryRow(
+		`SELECT COALESCE(SUM(m.prompt_tokens + m.completion_tokens), 0), COALESCE(SUM(m.cost), 0)
+		 FROM messages m `+where, args...,
+	).Scan(&tokens, &cost)
+	return tokens, cost
+}
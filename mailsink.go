@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// runMailSink mailsink 子命令：本地 SMTP 收信服务，收到的邮件打印到终端而不投递（作用同 MailHog）
+// 用于在没有真实邮件服务器时测试邮箱验证码登录：smtp.host 指向本服务，security 设为 none，不填用户名
+func runMailSink(args []string) {
+	fs := flag.NewFlagSet("mailsink", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:1025", "监听地址")
+	fs.Parse(args)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("本地收信服务启动失败: %v", err)
+	}
+	log.Printf("📮 本地收信服务已启动: %s（邮件只打印到终端，不会投递）", *addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("接受连接失败: %v", err)
+			continue
+		}
+		go serveSMTP(conn)
+	}
+}
+
+// serveSMTP 处理一个 SMTP 会话，只实现投递一封邮件所需的最小命令集（不支持 STARTTLS 与 AUTH）
+func serveSMTP(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 ai-guardian mailsink")
+
+	var from string
+	var to []string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO", "EHLO":
+			tp.PrintfLine("250 mailsink")
+		case "MAIL":
+			from, to = smtpPath(arg), nil
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			to = append(to, smtpPath(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			if len(to) == 0 {
+				tp.PrintfLine("503 需要先指定收件人")
+				continue
+			}
+			tp.PrintfLine("354 以单独一行的 . 结束")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			printMail(from, to, data)
+			tp.PrintfLine("250 OK")
+		case "RSET":
+			from, to = "", nil
+			tp.PrintfLine("250 OK")
+		case "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 不支持的命令")
+		}
+	}
+}
+
+// smtpPath 取出 "FROM:<a@b.c>" / "TO:<a@b.c>" 中的地址
+func smtpPath(arg string) string {
+	_, path, _ := strings.Cut(arg, ":")
+	path, _, _ = strings.Cut(strings.TrimSpace(path), " ")
+	return strings.Trim(path, "<>")
+}
+
+// printMail 打印收到的邮件：解码标题与正文（base64 / quoted-printable）
+func printMail(from string, to []string, data []byte) {
+	subject, body := "", string(data)
+	if msg, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		subject, _ = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		var r io.Reader = msg.Body
+		switch strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")) {
+		case "base64":
+			r = base64.NewDecoder(base64.StdEncoding, msg.Body)
+		case "quoted-printable":
+			r = quotedprintable.NewReader(msg.Body)
+		}
+		if b, err := io.ReadAll(r); err == nil {
+			body = string(b)
+		}
+	}
+	fmt.Printf("📨 %s → %s\n标题: %s\n%s\n%s\n", from, strings.Join(to, ", "), subject, strings.TrimSpace(body), strings.Repeat("-", 40))
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"ai-guardian-challenge/internal/config"
 	"ai-guardian-challenge/internal/handler"
@@ -28,26 +29,103 @@ func main() {
 		log.Fatalf("加载配置失败: %v", err)
 	}
 
-	// 初始化 SQLite 存储
-	dataStore := store.New("data.db")
+	// 子命令：migrate [-dry-run] 只处理数据库迁移，mailsink 启动本地收信服务，均不启动游戏服务
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(cfg.Database, os.Args[2:])
+			return
+		case "mailsink":
+			runMailSink(os.Args[2:])
+			return
+		}
+	}
+
+	// 初始化存储（SQLite / PostgreSQL）
+	dataStore := store.New(cfg.Database.Driver, cfg.Database.Source())
 	defer dataStore.Close()
+	log.Printf("🗄️ 数据库: %s", cfg.Database.Driver)
+
+	// 定期清理过期会话与旧的登录验证码（过期会话本身已无法使用，清理只为回收空间）
+	if interval := cfg.Server.Session.SweepInterval(); interval > 0 {
+		go sweepExpired(dataStore, interval)
+	}
 
 	// 初始化 AI 服务
+	var endpoints []service.Endpoint
+	for _, ep := range cfg.AI.EndpointList() {
+		provider, err := service.NewProvider(ep.Provider, ep.APIURL, ep.APIKey)
+		if err != nil {
+			log.Fatalf("初始化 AI 端点 %s 失败: %v", ep.Name, err)
+		}
+		endpoints = append(endpoints, service.Endpoint{
+			Name:     ep.Name,
+			Provider: provider,
+			Model:    ep.Model,
+		})
+		log.Printf("🤖 AI 端点 %s: %s (%s)", ep.Name, provider.Name(), provider.URL())
+	}
+	// 上下文窗口管理（可选）：超出窗口时丢弃或摘要最早的轮次
+	contextOptions := service.ContextOptions{Windows: cfg.AI.Context.Windows}
+	if len(cfg.AI.Context.Windows) > 0 && cfg.AI.Context.Strategy == config.ContextSummarize {
+		ep := cfg.AI.SummaryEndpoint()
+		provider, err := service.NewProvider(ep.Provider, ep.APIURL, ep.APIKey)
+		if err != nil {
+			log.Fatalf("初始化对话摘要端点失败: %v", err)
+		}
+		s := cfg.AI.Context.Summary
+		contextOptions.Summarizer = service.NewSummarizer(provider, ep.Model, s.MaxTokens, time.Duration(s.TimeoutSeconds)*time.Second)
+		log.Printf("📝 对话摘要: %s (%s)", ep.Model, provider.URL())
+	}
 	aiService := service.NewAIService(
-		cfg.AI.APIURL,
-		cfg.AI.APIKey,
-		cfg.AI.Model,
+		endpoints,
 		cfg.AI.SystemPrompt,
+		service.AIOptions{
+			Breaker: service.BreakerSettings{
+				FailureThreshold: cfg.AI.CircuitBreaker.FailureThreshold,
+				Cooldown:         time.Duration(cfg.AI.CircuitBreaker.CooldownSeconds) * time.Second,
+			},
+			RequestTimeout: cfg.AI.RequestTimeout(),
+			IdleTimeout:    cfg.AI.IdleTimeout(),
+			Temperature:    cfg.AI.Temperature,
+			TopP:           cfg.AI.TopP,
+			MaxTokens:      cfg.AI.MaxTokens,
+			Context:        contextOptions,
+		},
 	)
 
 	// 初始化口令检测器
-	passwordChecker := service.NewPasswordChecker(
-		cfg.Game.Passwords.Grand,
-		cfg.Game.Passwords.Consolation,
-	)
+	detectionOptions := service.DetectionOptions{
+		PinyinMinCoverage:   cfg.Game.Detection.PinyinMinCoverage,
+		FragmentMinCoverage: cfg.Game.Detection.FragmentMinCoverage,
+		FragmentMinLength:   cfg.Game.Detection.FragmentMinLength,
+		Patterns:            *cfg.Game.Detection.Patterns,
+		MaxStride:           cfg.Game.Detection.MaxStride,
+	}
+	passwordChecker := service.NewPasswordChecker(passwordRules(&cfg.Game, cfg.Game.Tiers), detectionOptions)
+
+	// 初始化随机口令（可选）
+	var secretVault *service.SecretVault
+	if rs := cfg.Game.RandomSecrets; rs.Enabled {
+		secretVault, err = service.NewSecretVault(rs.Key, secretTemplates(&cfg.Game), rs.WordLists)
+		if err != nil {
+			log.Fatalf("初始化随机口令失败: %v", err)
+		}
+		log.Printf("🎲 随机口令已开启，范围: %s", rs.Scope)
+	}
+	// 邮箱验证码登录（可选）
+	var mailer service.Mailer
+	if ec := cfg.Auth.EmailCode; ec.Enabled {
+		smtpMailer, err := service.NewSMTPMailer(ec.SMTP.Host, ec.SMTP.Port, ec.SMTP.Username, ec.SMTP.Password, ec.SMTP.From, ec.SMTP.Security)
+		if err != nil {
+			log.Fatalf("初始化发信服务失败: %v", err)
+		}
+		mailer = smtpMailer
+		log.Printf("📧 邮箱验证码登录已开启，SMTP: %s:%d (%s)", ec.SMTP.Host, ec.SMTP.Port, ec.SMTP.Security)
+	}
 
 	// 初始化 Handler
-	authHandler := handler.NewAuthHandler(dataStore, cfg)
+	authHandler := handler.NewAuthHandler(dataStore, cfg, mailer)
 	infoHandler := handler.NewInfoHandler(dataStore, cfg)
 
 	// 确定上传目录（web/Pic/）
@@ -55,7 +133,49 @@ func main() {
 	os.MkdirAll(uploadDir, 0755)
 	uploadHandler := handler.NewUploadHandler(uploadDir)
 
-	chatHandler := handler.NewChatHandler(dataStore, cfg, aiService, passwordChecker)
+	// 初始化口令泄露二次判定（可选）
+	var leakJudge service.LeakJudge
+	if cfg.AI.Judge.Enabled {
+		ep := cfg.AI.JudgeEndpoint()
+		provider, err := service.NewProvider(ep.Provider, ep.APIURL, ep.APIKey)
+		if err != nil {
+			log.Fatalf("初始化泄露判定端点失败: %v", err)
+		}
+		leakJudge = service.NewLLMJudge(provider, ep.Model)
+		log.Printf("🧑‍⚖️ 泄露判定: %s (%s), 阈值 %.2f, 自动发奖 %v",
+			ep.Model, provider.URL(), cfg.AI.Judge.Threshold, cfg.AI.Judge.AutoAward)
+	}
+
+	// 输入检测（可选）：内置规则 + 可选的分类模型
+	var inputGuard *service.InputGuard
+	if g := cfg.AI.InputGuard; g.Enabled {
+		classifiers := []service.InputClassifier{service.NewRuleClassifier()}
+		if g.Classifier.Enabled {
+			ep := cfg.AI.ClassifierEndpoint()
+			provider, err := service.NewProvider(ep.Provider, ep.APIURL, ep.APIKey)
+			if err != nil {
+				log.Fatalf("初始化输入检测分类端点失败: %v", err)
+			}
+			classifiers = append(classifiers, service.NewLLMClassifier(provider, ep.Model, g.Classifier.Threshold))
+			log.Printf("🛡️ 输入检测分类模型: %s (%s), 阈值 %.2f", ep.Model, provider.URL(), g.Classifier.Threshold)
+		}
+		guard, err := service.NewInputGuard(g.Policies, g.DefaultPolicy, classifiers...)
+		if err != nil {
+			log.Fatalf("ai.input_guard 配置错误: %v", err)
+		}
+		inputGuard = guard
+		log.Printf("🛡️ 输入检测已开启，默认处理方式 %s", g.DefaultPolicy)
+	}
+
+	// 闯关模式（可选）：各关卡使用独立的守护者提示词、口令与输入检测
+	levels, err := buildLevels(&cfg.Game, aiService, inputGuard, detectionOptions)
+	if err != nil {
+		log.Fatalf("game.levels 配置错误: %v", err)
+	}
+
+	secretManager := handler.NewSecretManager(dataStore, passwordChecker, secretVault, cfg.Game.RandomSecrets.Scope, levels)
+	chatHandler := handler.NewChatHandler(dataStore, cfg, aiService, secretManager, uploadHandler, leakJudge, inputGuard, levels)
+	adminHandler := handler.NewAdminHandler(dataStore, cfg, secretManager, aiService)
 
 	// 创建路由
 	mux := http.NewServeMux()
@@ -65,9 +185,13 @@ func main() {
 	mux.HandleFunc("/api/info", infoHandler.GetSiteInfo)
 	mux.HandleFunc("/api/check-auth", authHandler.CheckAuth)
 	mux.HandleFunc("/api/login", authHandler.Login)
+	mux.HandleFunc("/api/login/code", authHandler.SendLoginCode)
+	mux.HandleFunc("/api/login/verify", authHandler.VerifyLoginCode)
 	mux.HandleFunc("/api/logout", authHandler.Logout)
+	mux.HandleFunc("/api/logout-all", authHandler.LogoutAll)
 	mux.HandleFunc("/api/verify-captcha", authHandler.VerifyCaptcha)
 	mux.HandleFunc("/api/winners", infoHandler.GetWinners)
+	mux.HandleFunc("/api/levels", infoHandler.GetLevels)
 	mux.HandleFunc("/api/public/conversations", infoHandler.GetPublicConversations)
 
 	// 需登录接口
@@ -76,6 +200,18 @@ func main() {
 	mux.HandleFunc("/api/conversation/message", chatHandler.SendMessage)
 	mux.HandleFunc("/api/upload-image", uploadHandler.UploadImage)
 	mux.HandleFunc("/api/conversation/bonus-choice", chatHandler.BonusChoice)
+	mux.HandleFunc("/api/conversation/guess", chatHandler.SubmitGuess)
+
+	// 管理接口：请求头 X-Admin-Password 鉴权
+	mux.HandleFunc("/api/admin/usage", adminHandler.GetUsage)
+	mux.HandleFunc("/api/admin/usage/messages", adminHandler.GetMessageUsage)
+	mux.HandleFunc("/api/admin/leak-reviews", adminHandler.GetLeakReviews)
+	mux.HandleFunc("/api/admin/leak-reviews/resolve", adminHandler.ResolveLeakReview)
+	mux.HandleFunc("/api/admin/fragment-progress", adminHandler.GetFragmentProgress)
+	mux.HandleFunc("/api/admin/input-tags", adminHandler.GetInputTags)
+	mux.HandleFunc("/api/admin/endpoints", adminHandler.GetEndpoints)
+	mux.HandleFunc("/api/admin/blocked-leaks", adminHandler.GetBlockedLeaks)
+	mux.HandleFunc("/api/admin/sessions/revoke", adminHandler.RevokeSessions)
 
 	// 对话详情路由（支持 /api/conversation/{id} 格式）
 	mux.HandleFunc("/api/conversation/", chatHandler.GetConversation)
@@ -109,10 +245,98 @@ func main() {
 	log.Printf("🚀 AI 守护者挑战游戏服务已启动")
 	log.Printf("📍 访问地址: http://0.0.0.0:%d", cfg.Server.Port)
 	log.Printf("⏰ 活动截止: %s", cfg.Game.Deadline)
-	log.Printf("🔑 主口令: %s", cfg.Game.Passwords.Grand)
-	log.Printf("🎁 彩蛋口令: %s", cfg.Game.Passwords.Consolation)
+	for _, t := range cfg.Game.Tiers {
+		if cfg.Game.Randomized(&t) {
+			log.Printf("🔑 %s口令 [%s]: 随机生成（模板 %s）", t.Name, t.ID, t.Template)
+			continue
+		}
+		log.Printf("🔑 %s口令 [%s]: %s", t.Name, t.ID, t.Secret)
+	}
+	for i, l := range cfg.Game.Levels {
+		log.Printf("🧗 第 %d 关 %s [%s]: %s", i+1, l.Name, l.ID, l.Secret)
+	}
 
 	if err := http.ListenAndServe(addr, mux); err != nil {
 		log.Fatalf("服务器启动失败: %v", err)
 	}
 }
+
+// sweepExpired 每隔 interval 清理一次过期会话，以及一天前发送的登录验证码（发送频率限制只统计最近一小时）
+func sweepExpired(s store.Repository, interval time.Duration) {
+	for range time.Tick(interval) {
+		if n := s.DeleteExpiredSessions(); n > 0 {
+			log.Printf("🧹 已清理 %d 个过期会话", n)
+		}
+		if n := s.DeleteLoginCodesBefore(time.Now().Add(-24 * time.Hour)); n > 0 {
+			log.Printf("🧹 已清理 %d 条登录验证码记录", n)
+		}
+	}
+}
+
+// buildLevels 为各关卡创建使用本关提示词的 AI 服务、只检测本关口令的检测器，以及覆盖处理方式后的输入检测
+func buildLevels(game *config.GameConfig, ai *service.AIService, guard *service.InputGuard, opts service.DetectionOptions) (handler.Levels, error) {
+	levels := make(handler.Levels, 0, len(game.Levels))
+	for i := range game.Levels {
+		l := &game.Levels[i]
+		level := &handler.Level{
+			LevelConfig: l,
+			AI:          ai.WithSystemPrompt(l.SystemPrompt),
+			Checker:     service.NewPasswordChecker(passwordRules(game, []config.TierConfig{l.TierConfig}), opts),
+			Guard:       guard,
+		}
+		if guard != nil && len(l.InputPolicies) > 0 {
+			g, err := guard.WithPolicies(l.InputPolicies)
+			if err != nil {
+				return nil, fmt.Errorf("关卡 %s: %w", l.ID, err)
+			}
+			level.Guard = g
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// passwordRules 将奖项配置转换为检测器使用的口令规则（保持优先级顺序）
+// 随机口令奖项的口令留空，由各对话生成的口令填入
+func passwordRules(game *config.GameConfig, tiers []config.TierConfig) []service.PasswordRule {
+	rules := make([]service.PasswordRule, 0, len(tiers))
+	for _, t := range tiers {
+		m := t.Match
+		secret := t.Secret
+		if game.Randomized(&t) {
+			secret = ""
+		}
+		rules = append(rules, service.PasswordRule{
+			Type:        t.ID,
+			DisplayName: t.Name,
+			Password:    secret,
+			Keywords:    m.Keywords,
+			MinKeywords: m.MinKeywords,
+			Exact:       *m.Layers.Exact,
+			Stripped:    *m.Layers.Stripped,
+			Keyword:     *m.Layers.Keywords,
+			Pinyin:      *m.Layers.Pinyin,
+			Fuzzy:       *m.Layers.Fuzzy,
+			Fragments:   *m.Layers.Fragments,
+			// 编辑距离匹配的容忍度（-1 关闭，service 中 <= 0 即不生效）
+			FuzzyMaxDistance:      m.Fuzzy.MaxDistance,
+			FuzzyMinSimilarity:    m.Fuzzy.MinSimilarity,
+			FuzzyReviewSimilarity: m.Fuzzy.ReviewSimilarity,
+		})
+	}
+	return rules
+}
+
+// secretTemplates 收集随机口令奖项的模板
+func secretTemplates(game *config.GameConfig) map[string]service.SecretTemplate {
+	templates := make(map[string]service.SecretTemplate)
+	for _, t := range game.Tiers {
+		if game.Randomized(&t) {
+			templates[t.ID] = service.SecretTemplate{
+				Text:  t.Template,
+				Slots: config.TemplateSlots(t.Template),
+			}
+		}
+	}
+	return templates
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"ai-guardian-challenge/internal/config"
+	"ai-guardian-challenge/internal/store"
+)
+
+// runMigrate migrate 子命令：应用尚未应用的数据库迁移后退出
+// -dry-run 只打印待执行的 SQL，不修改数据库
+func runMigrate(db config.DatabaseConfig, args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只打印待执行的 SQL，不修改数据库")
+	fs.Parse(args)
+
+	s, err := store.Open(db.Driver, db.Source())
+	if err != nil {
+		log.Fatalf("打开数据库失败: %v", err)
+	}
+	defer s.Close()
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		log.Fatalf("读取数据库结构版本失败: %v", err)
+	}
+
+	if *dryRun {
+		pending, err := s.PlanMigrations()
+		if err != nil {
+			log.Fatalf("检查数据库迁移失败: %v", err)
+		}
+		if len(pending) == 0 {
+			fmt.Printf("数据库结构已是最新（版本 %d）\n", version)
+			return
+		}
+		fmt.Printf("当前版本 %d，待应用 %d 个迁移：\n", version, len(pending))
+		for _, m := range pending {
+			fmt.Printf("\n-- ========== %04d_%s ==========\n%s\n", m.Version, m.Name, m.SQL)
+		}
+		return
+	}
+
+	applied, err := s.Migrate()
+	if err != nil {
+		s.Close()
+		log.Printf("数据库迁移失败: %v", err)
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		fmt.Printf("数据库结构已是最新（版本 %d）\n", version)
+		return
+	}
+	fmt.Printf("已从版本 %d 升级到版本 %d\n", version, applied[len(applied)-1].Version)
+}
@@ -2,6 +2,8 @@
 let siteInfo = null;
 let isLoggedIn = false;
 let captchaVerified = false;
+let levels = [];          // 闯关模式的关卡（未开启时为空）
+let winnersLevel = '';    // 成功榜当前筛选的关卡，空表示全部
 
 // 加载站点信息
 async function loadInfo() {
@@ -12,11 +14,91 @@ async function loadInfo() {
         setInterval(updateCountdown, 1000);
         // 动态渲染管理员联系方式
         renderFooterContact();
+        // 邮箱验证码登录：以邮箱 + 验证码代替联系方式与人机验证
+        if (siteInfo.emailLogin) {
+            document.getElementById('contactInput').style.display = 'none';
+            document.getElementById('captchaContainer').style.display = 'none';
+            document.getElementById('emailLoginFields').style.display = '';
+        }
+        // 闯关模式：加载关卡列表
+        if (siteInfo.levelsEnabled) {
+            await loadLevels();
+        }
+        // 按配置的奖项渲染奖项卡片
+        renderPrizeCards();
     } catch (error) {
         console.error('加载站点信息失败:', error);
     }
 }
 
+// 加载关卡列表，并在成功榜上方渲染按关卡筛选的标签
+async function loadLevels() {
+    try {
+        const response = await fetch('/api/levels');
+        if (!response.ok) return;
+        const data = await response.json();
+        levels = data.levels || [];
+    } catch (error) {
+        console.error('加载关卡失败:', error);
+        return;
+    }
+
+    const tabs = document.getElementById('winnersLevelTabs');
+    tabs.innerHTML = '';
+    [{ id: '', name: '全部' }].concat(levels).forEach(level => {
+        const btn = document.createElement('button');
+        btn.className = `pagination-btn ${level.id === winnersLevel ? 'active' : ''}`;
+        btn.textContent = level.number ? `第${level.number}关 ${level.name}` : level.name;
+        btn.addEventListener('click', () => {
+            winnersLevel = level.id;
+            tabs.querySelectorAll('button').forEach(b => b.classList.remove('active'));
+            btn.classList.add('active');
+            loadWinners(1);
+        });
+        tabs.appendChild(btn);
+    });
+    tabs.style.display = '';
+}
+
+// 渲染奖项卡片（未返回奖项列表时保留页面中的静态卡片）
+// 闯关模式下各关卡同样以奖项卡片展示
+function renderPrizeCards() {
+    const section = document.getElementById('prizeSection');
+    const tiers = ((siteInfo && siteInfo.tiers) || []).concat(levels);
+    if (!section || tiers.length === 0) return;
+
+    section.innerHTML = '';
+    tiers.forEach(tier => {
+        let desc = tier.description || '';
+        if (tier.number) {
+            desc = `第 ${tier.number} 关 · 已通关 ${tier.winners} 人` + (desc ? `<br>${desc}` : '');
+        }
+        if (tier.quota > 0) {
+            desc += ` × ${tier.quota}名（剩余 ${tier.remaining}）`;
+        }
+
+        const card = document.createElement('div');
+        card.className = `prize-card ${tier.id}`;
+        card.innerHTML = `
+            <div class="prize-icon">${tier.icon || '🏅'}</div>
+            <div class="prize-title">${tier.name}</div>
+            <div class="prize-amount">${tier.prize || tier.name}</div>
+            <div class="prize-desc">${desc}</div>
+        `;
+        section.appendChild(card);
+    });
+}
+
+// winnerBadge 获奖榜徽章文字：优先使用记录中的奖项名称，旧记录按奖项 ID 推断
+function winnerBadge(winner) {
+    const tier = ((siteInfo && siteInfo.tiers) || []).concat(levels).find(t => t.id === winner.prizeType);
+    if (winner.prizeName || tier) {
+        const icon = (tier && tier.icon) || '🏅';
+        return `${icon} ${winner.prizeName || tier.name}`;
+    }
+    return winner.prizeType === 'grand' ? '🏆 特等奖' : '🎁 安慰奖';
+}
+
 // 检查认证状态
 async function checkAuth() {
     try {
@@ -96,8 +178,84 @@ function closeLoginModal() {
     document.getElementById('loginModal').classList.remove('active');
 }
 
+// 获取邮箱验证码，成功后按 resendAfter 倒计时
+async function sendLoginCode() {
+    const email = document.getElementById('emailInput').value.trim();
+    if (!email) {
+        alert('请填写邮箱地址');
+        return;
+    }
+
+    const btn = document.getElementById('sendCodeBtn');
+    btn.disabled = true;
+    try {
+        const response = await fetch('/api/login/code', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email })
+        });
+        const data = await response.json();
+        if (!data.success) {
+            alert(data.error || '验证码发送失败');
+            btn.disabled = false;
+            return;
+        }
+        let remaining = data.resendAfter || 0;
+        const tick = () => {
+            if (remaining <= 0) {
+                btn.textContent = '重新获取';
+                btn.disabled = false;
+                return;
+            }
+            btn.textContent = `${remaining} 秒后重新获取`;
+            remaining--;
+            setTimeout(tick, 1000);
+        };
+        tick();
+    } catch (error) {
+        console.error('发送验证码失败:', error);
+        alert('网络错误，请重试');
+        btn.disabled = false;
+    }
+}
+
+// 邮箱验证码登录
+async function submitEmailLogin() {
+    const email = document.getElementById('emailInput').value.trim();
+    const code = document.getElementById('codeInput').value.trim();
+    const nickname = document.getElementById('nicknameInput').value.trim();
+
+    if (!email || !code || !nickname) {
+        alert('请填写邮箱、验证码和昵称');
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/login/verify', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email, code, nickname })
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            window.location.href = '/user.html';
+        } else {
+            alert(data.error || '登录失败');
+        }
+    } catch (error) {
+        console.error('登录失败:', error);
+        alert('网络错误，请重试');
+    }
+}
+
 // 提交登录
 async function submitLogin() {
+    if (siteInfo && siteInfo.emailLogin) {
+        return submitEmailLogin();
+    }
+
     const contact = document.getElementById('contactInput').value.trim();
     const nickname = document.getElementById('nicknameInput').value.trim();
 
@@ -134,13 +292,15 @@ async function submitLogin() {
 // 加载获奖者列表
 async function loadWinners(page = 1) {
     try {
-        const response = await fetch(`/api/winners?page=${page}&pageSize=5`);
+        const levelQuery = winnersLevel ? `&level=${encodeURIComponent(winnersLevel)}` : '';
+        const response = await fetch(`/api/winners?page=${page}&pageSize=5${levelQuery}`);
         const result = await response.json();
         const winners = result.data || [];
         const container = document.getElementById('winnersDisplay');
 
         if (winners.length === 0) {
             container.innerHTML = '<div class="no-winners">暂无获奖者，成为第一个挑战成功的人吧！</div>';
+            document.getElementById('winnersPagination').innerHTML = '';
             return;
         }
 
@@ -153,7 +313,7 @@ async function loadWinners(page = 1) {
                 window.open(`/conversation.html?id=${winner.conversationId}`, '_blank');
             };
 
-            const badgeText = winner.prizeType === 'grand' ? '🏆 特等奖' : '🎁 安慰奖';
+            const badgeText = winnerBadge(winner);
 
             card.innerHTML = `
                 <span class="winner-badge">${badgeText}</span>
@@ -165,9 +325,11 @@ async function loadWinners(page = 1) {
             container.appendChild(card);
         });
 
-        // 分页
+        // 分页（切换关卡筛选后页数可能变少）
         if (result.totalPages > 1) {
             renderPagination('winnersPagination', page, result.totalPages, loadWinners);
+        } else {
+            document.getElementById('winnersPagination').innerHTML = '';
         }
     } catch (error) {
         console.error('加载获奖者失败:', error);
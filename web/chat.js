@@ -13,6 +13,7 @@ let thinkTagBuffer = '';           // 用于检测不完整的标签片段
 const urlParams = new URLSearchParams(window.location.search);
 const isNewChat = urlParams.get('new') === '1';
 const existingId = urlParams.get('id');
+const requestedLevel = urlParams.get('level') || '';
 
 async function init() {
     try {
@@ -63,7 +64,7 @@ async function confirmNewChat() {
         const response = await fetch('/api/conversation/new', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ turnstileToken: 'simple-verified' })
+            body: JSON.stringify({ turnstileToken: 'simple-verified', level: requestedLevel })
         });
 
         const data = await response.json();
@@ -76,7 +77,10 @@ async function confirmNewChat() {
             messagesDiv.innerHTML = '';
             addMessage('assistant', data.initialMessage);
 
-            updateTurnCounter(0, 20);
+            updateTurnCounter(0, data.maxTurns || 20);
+            if (data.level) {
+                showLevelBadge(data.level);
+            }
 
             document.getElementById('sendBtn').disabled = false;
             document.getElementById('messageInput').disabled = false;
@@ -90,6 +94,22 @@ async function confirmNewChat() {
     }
 }
 
+// 闯关模式：在标题下显示当前关卡
+async function showLevelBadge(levelId) {
+    try {
+        const response = await fetch('/api/levels');
+        if (!response.ok) return;
+        const data = await response.json();
+        const level = (data.levels || []).find(l => l.id === levelId);
+        if (!level) return;
+        const badge = document.getElementById('levelBadge');
+        badge.textContent = `${level.icon || '🧗'} 第 ${level.number} 关 · ${level.name}`;
+        badge.style.display = '';
+    } catch (error) {
+        console.error('加载关卡信息失败:', error);
+    }
+}
+
 function showCustomAlert(message, isSuccess = false) {
     const modal = document.createElement('div');
     modal.className = 'custom-alert-overlay';
@@ -123,10 +143,13 @@ async function loadConversation() {
         messagesDiv.innerHTML = '';
 
         conversation.messages.forEach(msg => {
-            addMessage(msg.role, msg.content);
+            addMessage(msg.role, msg.content, msg.imageUrl);
         });
 
         updateTurnCounter(conversation.turnCount, conversation.maxTurns);
+        if (conversation.level) {
+            showLevelBadge(conversation.level);
+        }
 
         const sendBtn = document.getElementById('sendBtn');
         const messageInput = document.getElementById('messageInput');
@@ -136,6 +159,9 @@ async function loadConversation() {
             sendBtn.disabled = true;
             messageInput.disabled = true;
         } else {
+            if (siteInfo && siteInfo.guessEnabled) {
+                document.getElementById('guessBtn').style.display = '';
+            }
             sendBtn.disabled = false;
             messageInput.disabled = false;
             messageInput.focus();
@@ -153,7 +179,45 @@ async function loadConversation() {
     }
 }
 
-function addMessage(role, content) {
+// 提交口令猜测（根据守护者的提示推断出口令后直接提交）
+async function submitGuess() {
+    const guess = prompt('你推断出的口令是？');
+    if (!guess || !guess.trim()) return;
+
+    try {
+        const resp = await fetch('/api/conversation/guess', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ conversationId, guess: guess.trim() })
+        });
+        const result = await resp.json();
+        if (!resp.ok) {
+            showCustomAlert(result.error || '提交失败，请重试');
+            return;
+        }
+
+        const left = result.remaining >= 0 ? `今日还可猜 ${result.remaining} 次` : '';
+        if (result.correct) {
+            document.getElementById('sendBtn').disabled = true;
+            document.getElementById('messageInput').disabled = true;
+            document.getElementById('guessBtn').style.display = 'none';
+            const levelNote = result.levelCleared ? '\n\n🧗 本关已通过，下一关已解锁！' : '';
+            if (result.soldOut) {
+                showCustomAlert(`🎉 猜对了！你推断出了${result.prizeType}口令：${result.password}\n\n但该奖项名额已发完${levelNote}`, false);
+            } else {
+                showCustomAlert(`🎉 猜对了！你推断出了${result.prizeType}口令：${result.password}\n\n请联系管理员QQ：${siteInfo.adminQQ} 微信：${siteInfo.adminWechat}兑奖${levelNote}`, true);
+            }
+            showStatus(`🎉 猜中${result.prizeType}口令！`, 'success');
+        } else {
+            showCustomAlert(`很遗憾，猜错了。${left}`);
+        }
+    } catch (error) {
+        console.error('提交猜测失败:', error);
+        showCustomAlert('提交失败，请重试');
+    }
+}
+
+function addMessage(role, content, imageUrl) {
     const messagesDiv = document.getElementById('chatMessages');
     const messageDiv = document.createElement('div');
     messageDiv.className = `message ${role}`;
@@ -161,9 +225,10 @@ function addMessage(role, content) {
     const contentDiv = document.createElement('div');
     contentDiv.className = 'message-content';
 
+    // 兼容旧版本把图片以 "[图片:url]" 拼在文本中的消息
     const imgMatch = content.match(/\[图片:(\/Pic\/[^\]]+)\]/);
-    if (imgMatch) {
-        const imgUrl = imgMatch[1];
+    if (imageUrl || imgMatch) {
+        const imgUrl = imageUrl || imgMatch[1];
         const textOnly = content.replace(/\[图片:\/Pic\/[^\]]+\]\n?/, '').trim();
 
         const img = document.createElement('img');
@@ -295,8 +360,8 @@ function handleImageSelect(e) {
         return;
     }
 
-    if (file.size > 10 * 1024 * 1024) {
-        showCustomAlert('图片大小不能超过10MB');
+    if (file.size > 5 * 1024 * 1024) {
+        showCustomAlert('图片大小不能超过5MB');
         return;
     }
 
@@ -369,9 +434,8 @@ async function sendMessage() {
     input.disabled = true;
 
     const imageUrl = pendingImageUrl;
-    const displayContent = imageUrl ? `[图片:${imageUrl}]\n${message}` : message;
 
-    addMessage('user', displayContent);
+    addMessage('user', message, imageUrl);
     input.value = '';
     updateCharCounter();
     input.style.height = 'auto';
@@ -466,21 +530,37 @@ async function sendMessage() {
                                 contentDiv.textContent = fullText;
                             }
 
+                            const levelNote = parsed.levelCleared ? '\n\n🧗 本关已通过，下一关已解锁！返回「我的对话」继续闯关' : '';
                             setTimeout(() => {
-                                if (parsed.isFirstWinner) {
-                                    showCustomAlert(`🎉🎉🎉 恭喜你成功拿到${parsed.prizeType}口令！\n\n口令是：${parsed.password}\n\n请联系管理员QQ：${siteInfo.adminQQ} 微信：${siteInfo.adminWechat}兑奖（${parsed.prizeAmount}红包）`, true);
+                                if (parsed.prizeSoldOut) {
+                                    showCustomAlert(`你成功得到了${parsed.prizeType}口令：${parsed.password}，但该奖项名额已发完${levelNote}`, false);
+                                    showStatus('奖项名额已发完', 'warning');
+                                } else if (parsed.isFirstWinner) {
+                                    showCustomAlert(`🎉🎉🎉 恭喜你成功拿到${parsed.prizeType}口令！\n\n口令是：${parsed.password}\n\n请联系管理员QQ：${siteInfo.adminQQ} 微信：${siteInfo.adminWechat}兑奖（${parsed.prizeAmount}红包）${levelNote}`, true);
                                     showStatus(`🎉 恭喜获得${parsed.prizeType}！口令：${parsed.password}`, 'success');
                                 } else {
-                                    showCustomAlert(`你成功得到了${parsed.prizeType}口令：${parsed.password}，但是已有用户抢先了，再试试吧！`, false);
+                                    showCustomAlert(`你成功得到了${parsed.prizeType}口令：${parsed.password}，但是已有用户抢先了，再试试吧！${levelNote}`, false);
                                     showStatus('口令已被使用，继续尝试！', 'warning');
                                 }
                             }, 1000);
                         } else if (parsed.type === 'bonus_offer') {
                             // 福利口令二选一弹窗
                             showBonusChoiceModal(parsed);
+                        } else if (parsed.type === 'warning') {
+                            // 输入检测提醒、输出过滤遮盖提醒：不影响本轮回复
+                            showStatus(parsed.content, 'warning');
+                        } else if (parsed.type === 'replace') {
+                            // 输出过滤拦截：已显示的回复整条替换为拒绝提示
+                            fullText = parsed.content;
+                            contentDiv.textContent = fullText;
+                            showStatus(parsed.content, 'warning');
                         } else if (parsed.type === 'error') {
                             contentDiv.textContent = parsed.content;
-                            showStatus('发送失败', 'error');
+                            if (parsed.code === 'budget_exhausted' || parsed.code === 'input_refused') {
+                                showStatus(parsed.content, 'warning');
+                            } else {
+                                showStatus('发送失败', 'error');
+                            }
                         }
                     } catch (e) {
                         // 忽略解析错误
@@ -628,7 +708,9 @@ function showBonusChoiceModal(bonusData) {
                 document.getElementById('messageInput').disabled = true;
 
                 // 展示获奖弹窗
-                if (result.isFirstWinner) {
+                if (result.soldOut) {
+                    showCustomAlert(`福利口令名额已发完，口令是：${result.password}`, false);
+                } else if (result.isFirstWinner) {
                     showCustomAlert(`🎉🎉🎉 恭喜！你领取了福利口令！\n\n口令是：${result.password}\n\n请联系管理员QQ：${siteInfo.adminQQ} 微信：${siteInfo.adminWechat}兑奖（${result.prizeAmount}红包）`, true);
                 } else {
                     showCustomAlert(`你领取了福利口令：${result.password}，但已有用户抢先了，再试试吧！`, false);
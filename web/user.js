@@ -1,6 +1,43 @@
 // user.js - 用户对话列表页面逻辑
 let currentPage = 1;
 const pageSize = 15;
+let levelNames = {}; // 关卡 ID → "第 N 关 名称"（闯关模式）
+
+// 闯关模式：加载关卡列表与闯关进度，未开启时不显示
+async function loadLevels() {
+    try {
+        const response = await fetch('/api/levels');
+        if (!response.ok) return;
+        const data = await response.json();
+        const container = document.getElementById('levelList');
+        container.innerHTML = '';
+
+        (data.levels || []).forEach(level => {
+            levelNames[level.id] = `第 ${level.number} 关 ${level.name}`;
+
+            const card = document.createElement('div');
+            card.className = `user-conversation-card ${level.cleared ? 'success' : ''} ${!level.unlocked ? 'inactive' : ''}`;
+            const statusText = level.cleared ? '✓ 已通关' : level.unlocked ? '可挑战' : '🔒 未解锁';
+            if (level.unlocked && !level.cleared) {
+                card.onclick = () => {
+                    window.location.href = `/chat.html?new=1&level=${encodeURIComponent(level.id)}`;
+                };
+            }
+
+            card.innerHTML = `
+                <div class="conv-card-top">
+                    <span class="conv-status ${level.cleared ? 'success' : level.unlocked ? 'active' : 'inactive'}">${statusText}</span>
+                    <span class="conv-time">已通关 ${level.winners} 人 · 每次 ${level.maxTurns} 轮</span>
+                </div>
+                <div class="conv-preview">${level.icon || '🧗'} ${levelNames[level.id]}${level.description ? ' — ' + level.description : ''}</div>
+            `;
+            container.appendChild(card);
+        });
+        container.style.display = '';
+    } catch (error) {
+        console.error('加载关卡失败:', error);
+    }
+}
 
 async function loadConversations(page = 1) {
     currentPage = page;
@@ -29,9 +66,12 @@ async function loadConversations(page = 1) {
                 window.location.href = `/chat.html?id=${conv.id}`;
             };
 
-            const statusText = conv.isSuccess ? '✓ 成功获取口令' :
+            let statusText = conv.isSuccess ? '✓ 成功获取口令' :
                 !conv.isActive ? '已结束' :
                     `进行中 (${conv.turnCount}/${conv.maxTurns})`;
+            if (conv.level) {
+                statusText = `${levelNames[conv.level] || conv.level} · ${statusText}`;
+            }
 
             card.innerHTML = `
                 <div class="conv-card-top">
@@ -118,4 +158,14 @@ function logout() {
     }
 }
 
-loadConversations();
+function logoutAll() {
+    if (confirm('确定要在所有设备上退出登录吗？')) {
+        fetch('/api/logout-all', { method: 'POST' })
+            .then(() => {
+                window.location.href = '/';
+            });
+    }
+}
+
+// 先加载关卡名称，对话列表中的关卡对话据此显示
+loadLevels().then(() => loadConversations());